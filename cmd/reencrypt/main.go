@@ -0,0 +1,65 @@
+// Command reencrypt encrypts the user fields stored as plaintext, and re-encrypts
+// those written with a master key other than the active one.
+//
+// Usage:
+//
+//	MONGO_URI=mongodb://... MONGO_DB=7tv \
+//	ENCRYPTION_KEYS=k2:<base64>,k1:<base64> ENCRYPTION_ACTIVE_KEY=k2 \
+//	go run ./cmd/reencrypt
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/mongo/encryption"
+	"github.com/seventv/common/structures/v3/mutations"
+	"go.uber.org/zap"
+)
+
+func main() {
+	logger, _ := zap.NewProduction()
+	zap.ReplaceGlobals(logger)
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	keys, err := encryption.ParseKeys(os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		zap.S().Fatalw("invalid encryption keys", "error", err)
+	}
+
+	keyring, err := encryption.NewKeyring(os.Getenv("ENCRYPTION_ACTIVE_KEY"), keys)
+	if err != nil {
+		zap.S().Fatalw("invalid keyring", "error", err)
+	}
+
+	inst, err := mongo.Setup(ctx, mongo.SetupOptions{
+		URI:     os.Getenv("MONGO_URI"),
+		DB:      os.Getenv("MONGO_DB"),
+		Keyring: keyring,
+	})
+	if err != nil {
+		zap.S().Fatalw("failed to connect to mongo", "error", err)
+	}
+
+	count, err := mutations.New(mutations.InstanceOptions{Mongo: inst}).ReencryptUsers(ctx, mutations.ReencryptUsersOptions{
+		KeyID: keyring.ActiveKeyID(),
+	})
+	if err != nil {
+		zap.S().Fatalw("re-encryption failed",
+			"error", err,
+			"count", count,
+		)
+	}
+
+	zap.S().Infow("re-encryption complete",
+		"count", count,
+		"key_id", keyring.ActiveKeyID(),
+	)
+}
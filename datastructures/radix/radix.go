@@ -0,0 +1,175 @@
+package radix
+
+import (
+	"net/netip"
+)
+
+// Tree is a path-compressed binary radix tree mapping IP prefixes to values
+//
+// IPv4 and IPv6 prefixes are kept in separate trees, and IPv4-mapped IPv6 addresses are matched as IPv4.
+// A Tree is not safe for concurrent writes
+type Tree[T any] struct {
+	v4   *node[T]
+	v6   *node[T]
+	size int
+}
+
+type node[T any] struct {
+	prefix   netip.Prefix
+	value    T
+	set      bool
+	children [2]*node[T]
+}
+
+// Len returns the amount of prefixes in the tree
+func (t *Tree[T]) Len() int {
+	return t.size
+}
+
+// Insert sets the value of a prefix, replacing the existing value if any
+func (t *Tree[T]) Insert(p netip.Prefix, value T) {
+	p = normalize(p)
+	if !p.IsValid() {
+		return
+	}
+
+	n := t.root(p.Addr())
+	for {
+		cur := *n
+		if cur == nil {
+			*n = &node[T]{prefix: p, value: value, set: true}
+			t.size++
+			return
+		}
+
+		common := commonBits(cur.prefix, p)
+		switch {
+		case common == cur.prefix.Bits() && common == p.Bits(): // same prefix
+			if !cur.set {
+				t.size++
+			}
+			cur.value = value
+			cur.set = true
+			return
+		case common == cur.prefix.Bits(): // the current node contains the prefix
+			n = &cur.children[bitAt(p.Addr(), common)]
+			continue
+		}
+
+		// Split the current node at the common bits
+		split := &node[T]{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+		split.children[bitAt(cur.prefix.Addr(), common)] = cur
+		if common == p.Bits() {
+			split.value = value
+			split.set = true
+		} else {
+			split.children[bitAt(p.Addr(), common)] = &node[T]{prefix: p, value: value, set: true}
+		}
+		*n = split
+		t.size++
+		return
+	}
+}
+
+// Lookup returns the value of the most specific prefix containing the address
+func (t *Tree[T]) Lookup(addr netip.Addr) (value T, ok bool) {
+	t.walk(addr, func(v T) bool {
+		value, ok = v, true
+		return true
+	})
+	return value, ok
+}
+
+// Matches returns the values of all prefixes containing the address, from least to most specific
+func (t *Tree[T]) Matches(addr netip.Addr) []T {
+	result := []T{}
+	t.walk(addr, func(v T) bool {
+		result = append(result, v)
+		return true
+	})
+	return result
+}
+
+// walk calls fn for each value on the path to the address, until fn returns false
+func (t *Tree[T]) walk(addr netip.Addr, fn func(v T) bool) {
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return
+	}
+
+	n := *t.root(addr)
+	for n != nil && n.prefix.Contains(addr) {
+		if n.set && !fn(n.value) {
+			return
+		}
+		if n.prefix.Bits() == addr.BitLen() {
+			return
+		}
+
+		n = n.children[bitAt(addr, n.prefix.Bits())]
+	}
+}
+
+func (t *Tree[T]) root(addr netip.Addr) **node[T] {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// normalize unmaps IPv4-mapped prefixes and zeroes the host bits
+func normalize(p netip.Prefix) netip.Prefix {
+	if !p.IsValid() {
+		return p
+	}
+
+	addr := p.Addr()
+	bits := p.Bits()
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+		bits -= 96
+		if bits < 0 {
+			bits = 0
+		}
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+// commonBits returns the length of the common leading bits of two prefixes of the same family
+func commonBits(a, b netip.Prefix) int {
+	max := a.Bits()
+	if b.Bits() < max {
+		max = b.Bits()
+	}
+
+	ab := a.Addr().AsSlice()
+	bb := b.Addr().AsSlice()
+
+	n := 0
+	for i := range ab {
+		if n >= max {
+			break
+		}
+		x := ab[i] ^ bb[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+
+	if n > max {
+		n = max
+	}
+	return n
+}
+
+// bitAt returns the bit of an address at the position, counting from the most significant bit
+func bitAt(addr netip.Addr, i int) int {
+	b := addr.AsSlice()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
@@ -0,0 +1,124 @@
+package radix
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func newTree(t *testing.T, prefixes ...string) *Tree[string] {
+	t.Helper()
+
+	tree := &Tree[string]{}
+	for _, s := range prefixes {
+		tree.Insert(netip.MustParsePrefix(s), s)
+	}
+	return tree
+}
+
+func TestLookupIPv4(t *testing.T) {
+	tree := newTree(t, "10.0.0.0/8", "192.168.1.0/24", "192.168.1.7/32")
+
+	cases := map[string]string{
+		"10.1.2.3":    "10.0.0.0/8",
+		"192.168.1.1": "192.168.1.0/24",
+		"192.168.1.7": "192.168.1.7/32",
+	}
+	for addr, want := range cases {
+		got, ok := tree.Lookup(netip.MustParseAddr(addr))
+		if !ok || got != want {
+			t.Errorf("Lookup(%s) = %q, %v; want %q", addr, got, ok, want)
+		}
+	}
+
+	for _, addr := range []string{"11.0.0.1", "192.168.2.1", "0.0.0.0"} {
+		if got, ok := tree.Lookup(netip.MustParseAddr(addr)); ok {
+			t.Errorf("Lookup(%s) = %q; want no match", addr, got)
+		}
+	}
+}
+
+func TestLookupIPv6(t *testing.T) {
+	tree := newTree(t, "2001:db8::/32", "2001:db8:abcd::/48", "2001:db8:abcd::1/128")
+
+	cases := map[string]string{
+		"2001:db8:1::1":      "2001:db8::/32",
+		"2001:db8:abcd::2":   "2001:db8:abcd::/48",
+		"2001:db8:abcd::1":   "2001:db8:abcd::1/128",
+		"2001:db8:abcd:ff::": "2001:db8:abcd::/48",
+	}
+	for addr, want := range cases {
+		got, ok := tree.Lookup(netip.MustParseAddr(addr))
+		if !ok || got != want {
+			t.Errorf("Lookup(%s) = %q, %v; want %q", addr, got, ok, want)
+		}
+	}
+
+	if got, ok := tree.Lookup(netip.MustParseAddr("2001:db9::1")); ok {
+		t.Errorf("Lookup(2001:db9::1) = %q; want no match", got)
+	}
+}
+
+func TestFamiliesAreSeparate(t *testing.T) {
+	tree := newTree(t, "0.0.0.0/0")
+
+	if _, ok := tree.Lookup(netip.MustParseAddr("::1")); ok {
+		t.Error("an IPv4 prefix matched an IPv6 address")
+	}
+
+	// IPv4-mapped addresses are matched as IPv4
+	if got, ok := tree.Lookup(netip.MustParseAddr("::ffff:10.0.0.1")); !ok || got != "0.0.0.0/0" {
+		t.Errorf("Lookup(::ffff:10.0.0.1) = %q, %v; want the IPv4 match", got, ok)
+	}
+
+	tree = newTree(t, "::ffff:10.0.0.0/104")
+	if got, ok := tree.Lookup(netip.MustParseAddr("10.1.1.1")); !ok || got != "::ffff:10.0.0.0/104" {
+		t.Errorf("Lookup(10.1.1.1) = %q, %v; want the mapped prefix", got, ok)
+	}
+}
+
+func TestMatchesOrder(t *testing.T) {
+	// Inserted out of order, so that nodes are split and reparented
+	tree := newTree(t, "10.1.2.0/24", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.128/25", "10.2.0.0/16")
+
+	got := tree.Matches(netip.MustParseAddr("10.1.2.200"))
+	want := []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.128/25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Matches() = %v; want %v", got, want)
+	}
+
+	got = tree.Matches(netip.MustParseAddr("10.1.2.1"))
+	want = []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Matches() = %v; want %v", got, want)
+	}
+
+	if got = tree.Matches(netip.MustParseAddr("11.0.0.1")); len(got) != 0 {
+		t.Errorf("Matches() = %v; want none", got)
+	}
+}
+
+func TestInsertReplacesAndCounts(t *testing.T) {
+	tree := &Tree[string]{}
+	tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), "a")
+	tree.Insert(netip.MustParsePrefix("10.0.0.0/8"), "b")
+	tree.Insert(netip.MustParsePrefix("10.255.1.1/8"), "c") // host bits are zeroed
+	tree.Insert(netip.MustParsePrefix("10.1.0.0/16"), "d")
+	tree.Insert(netip.MustParsePrefix("10.2.0.0/16"), "e") // splits below 10.0.0.0/8
+
+	if tree.Len() != 3 {
+		t.Errorf("Len() = %d; want 3", tree.Len())
+	}
+	if got, _ := tree.Lookup(netip.MustParseAddr("10.9.9.9")); got != "c" {
+		t.Errorf("Lookup() = %q; want the replaced value", got)
+	}
+
+	// A split node without a value does not match
+	tree = newTree(t, "10.1.0.0/16", "10.2.0.0/16")
+	if tree.Len() != 2 {
+		t.Errorf("Len() = %d; want 2", tree.Len())
+	}
+	if got, ok := tree.Lookup(netip.MustParseAddr("10.3.0.1")); ok {
+		t.Errorf("Lookup() = %q; want no match", got)
+	}
+}
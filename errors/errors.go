@@ -26,6 +26,8 @@ var (
 	ErrUnauthorized          apiErrorFn = DefineError(70401, "Sign-In Required", 401)       // client is not authenticated
 	ErrInsufficientPrivilege apiErrorFn = DefineError(70403, "Insufficient Privilege", 403) // client lacks privilege
 	ErrDontBeSilly           apiErrorFn = DefineError(70470, "Don't Be Silly", 403)         // client is trying to do something stupid
+	ErrRateLimited           apiErrorFn = DefineError(70429, "Rate Limit Reached", 429)     // client is sending too many requests
+	ErrBanned                apiErrorFn = DefineError(70471, "Banned", 403)                 // client is banned from doing this
 
 	// Client Not Found
 
@@ -59,6 +61,7 @@ var (
 	ErrEmoteVersionNameInvalid        apiErrorFn = DefineError(704614, "Bad Emote Version Name", 400)        // client sent an emote version name that did not pass validation
 	ErrEmoteVersionDescriptionInvalid apiErrorFn = DefineError(704615, "Bad Emote Version Description", 400) // client sent an emote version description that did not pass validation
 	ErrNoSpaceAvailable               apiErrorFn = DefineError(704620, "No Space Available", 403)            // the target object is full
+	ErrConnectionAlreadyLinked        apiErrorFn = DefineError(704630, "Connection Already Linked", 409)     // the connection is already linked to a user
 	ErrMissingRequiredField           apiErrorFn = DefineError(704680, "Missing Field", 400)
 
 	// Server Errors
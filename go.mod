@@ -6,6 +6,7 @@ require (
 	github.com/go-redis/redis/v8 v8.11.5
 	go.mongodb.org/mongo-driver v1.9.0
 	go.uber.org/zap v1.21.0
+	golang.org/x/image v0.0.0-20220902085622-e7cb96979f69
 )
 
 require (
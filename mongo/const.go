@@ -7,6 +7,7 @@ var (
 	CollectionNameAuditLogs    CollectionName = "audit_logs"
 	CollectionNameEmotes       CollectionName = "emotes"
 	CollectionNameEmoteSets    CollectionName = "emote_sets"
+	CollectionNameEmoteTags    CollectionName = "emote_tags"
 	CollectionNameUsers        CollectionName = "users"
 	CollectionNameRoles        CollectionName = "roles"
 	CollectionNameEntitlements CollectionName = "entitlements"
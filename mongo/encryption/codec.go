@@ -0,0 +1,177 @@
+package encryption
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// EncryptedString is a string encrypted at rest
+//
+// With a keyring registered on the client, it is written as an Envelope and read back as plaintext.
+// Empty strings are written as-is, and plaintext strings are read as-is, so existing documents remain
+// readable until they are migrated.
+//
+// Outside of the client, such as with bson.Marshal, the default keyring is used instead.
+// It is marshaled to JSON as plaintext, so values must be removed before caching or returning
+// objects where they should not be visible
+type EncryptedString string
+
+var (
+	defaultMx      sync.RWMutex
+	defaultKeyring *Keyring
+)
+
+// SetDefault sets the keyring used to encrypt and decrypt values outside of a client registry
+func SetDefault(kr *Keyring) {
+	defaultMx.Lock()
+	defaultKeyring = kr
+	defaultMx.Unlock()
+}
+
+// Default returns the default keyring, or nil if none was set
+func Default() *Keyring {
+	defaultMx.RLock()
+	defer defaultMx.RUnlock()
+
+	return defaultKeyring
+}
+
+// MarshalBSONValue encrypts the value with the default keyring, or writes it as plaintext if there is none
+func (s EncryptedString) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	kr := Default()
+	if s == "" || kr == nil {
+		return bsontype.String, bsoncore.AppendString(nil, string(s)), nil
+	}
+
+	env, err := kr.Encrypt([]byte(s))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	b, err := bson.Marshal(env)
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.EmbeddedDocument, b, nil
+}
+
+// UnmarshalBSONValue reads a plaintext value, or decrypts an envelope with the default keyring
+func (s *EncryptedString) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		v, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return fmt.Errorf("malformed string")
+		}
+		*s = EncryptedString(v)
+	case bsontype.EmbeddedDocument:
+		kr := Default()
+		if kr == nil {
+			return fmt.Errorf("cannot decrypt a value without a keyring")
+		}
+
+		env := Envelope{}
+		if err := bson.Unmarshal(data, &env); err != nil {
+			return err
+		}
+
+		b, err := kr.Decrypt(env)
+		if err != nil {
+			return err
+		}
+		*s = EncryptedString(b)
+	case bsontype.Null, bsontype.Undefined:
+		*s = ""
+	default:
+		return fmt.Errorf("cannot decode %v into an EncryptedString", t)
+	}
+
+	return nil
+}
+
+var (
+	tEncryptedString = reflect.TypeOf(EncryptedString(""))
+	tEnvelope        = reflect.TypeOf(Envelope{})
+)
+
+// Register adds the codec of encrypted values to a registry
+func (kr *Keyring) Register(rb *bsoncodec.RegistryBuilder) *bsoncodec.RegistryBuilder {
+	return rb.
+		RegisterTypeEncoder(tEncryptedString, bsoncodec.ValueEncoderFunc(kr.encodeValue)).
+		RegisterTypeDecoder(tEncryptedString, bsoncodec.ValueDecoderFunc(kr.decodeValue))
+}
+
+func (kr *Keyring) encodeValue(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tEncryptedString {
+		return bsoncodec.ValueEncoderError{Name: "EncryptedStringEncodeValue", Types: []reflect.Type{tEncryptedString}, Received: val}
+	}
+
+	s := val.String()
+	if s == "" {
+		return vw.WriteString("")
+	}
+
+	env, err := kr.Encrypt([]byte(s))
+	if err != nil {
+		return err
+	}
+
+	enc, err := ec.LookupEncoder(tEnvelope)
+	if err != nil {
+		return err
+	}
+
+	return enc.EncodeValue(ec, vw, reflect.ValueOf(env))
+}
+
+func (kr *Keyring) decodeValue(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tEncryptedString {
+		return bsoncodec.ValueDecoderError{Name: "EncryptedStringDecodeValue", Types: []reflect.Type{tEncryptedString}, Received: val}
+	}
+
+	switch vr.Type() {
+	case bsontype.String:
+		s, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		val.SetString(s)
+	case bsontype.EmbeddedDocument:
+		dec, err := dc.LookupDecoder(tEnvelope)
+		if err != nil {
+			return err
+		}
+
+		env := Envelope{}
+		if err = dec.DecodeValue(dc, vr, reflect.ValueOf(&env).Elem()); err != nil {
+			return err
+		}
+
+		b, err := kr.Decrypt(env)
+		if err != nil {
+			return err
+		}
+		val.SetString(string(b))
+	case bsontype.Null:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+		val.SetString("")
+	case bsontype.Undefined:
+		if err := vr.ReadUndefined(); err != nil {
+			return err
+		}
+		val.SetString("")
+	default:
+		return fmt.Errorf("cannot decode %v into an EncryptedString", vr.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of master keys and data keys, for AES-256
+const KeySize = 32
+
+// Keyring holds the master keys used for envelope encryption
+//
+// Each value is encrypted with a random data key, which is itself encrypted ("wrapped") with the active master key.
+// Older master keys are kept in the keyring so that values they wrapped can still be read after a rotation
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewKeyring: create a keyring from master keys by their ID
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	kr := &Keyring{
+		active: activeID,
+		keys:   make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for id, key := range keys {
+		if id == "" {
+			return nil, fmt.Errorf("master key id cannot be empty")
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		kr.keys[id] = aead
+	}
+
+	if _, ok := kr.keys[activeID]; !ok {
+		return nil, fmt.Errorf("active master key %s is not in the keyring", activeID)
+	}
+
+	return kr, nil
+}
+
+// ParseKeys parses master keys formatted as a comma-separated list of id:base64 pairs
+func ParseKeys(s string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, enc, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed key %q, expected id:base64", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		keys[id] = key
+	}
+
+	return keys, nil
+}
+
+// ActiveKeyID returns the ID of the master key used for new values
+func (kr *Keyring) ActiveKeyID() string {
+	return kr.active
+}
+
+// Envelope is an encrypted value, as stored in the database
+type Envelope struct {
+	// The ID of the master key which wrapped the data key
+	KeyID string `bson:"kid"`
+	// The wrapped data key, prefixed by its nonce
+	DataKey []byte `bson:"dk"`
+	// The encrypted value, prefixed by its nonce
+	Ciphertext []byte `bson:"ct"`
+}
+
+// Encrypt encrypts a value with a new data key, wrapped with the active master key
+func (kr *Keyring) Encrypt(plaintext []byte) (Envelope, error) {
+	dk := make([]byte, KeySize)
+	if _, err := rand.Read(dk); err != nil {
+		return Envelope{}, err
+	}
+
+	aead, err := newAEAD(dk)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	ct, err := seal(aead, plaintext, nil)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	// The key ID is authenticated along with the data key, so that it cannot be swapped
+	wrapped, err := seal(kr.keys[kr.active], dk, []byte(kr.active))
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		KeyID:      kr.active,
+		DataKey:    wrapped,
+		Ciphertext: ct,
+	}, nil
+}
+
+// Decrypt unwraps the data key of an envelope with its master key, and decrypts the value
+func (kr *Keyring) Decrypt(env Envelope) ([]byte, error) {
+	master, ok := kr.keys[env.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %s", env.KeyID)
+	}
+
+	dk, err := open(master, env.DataKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dk)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, env.Ciphertext, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+}
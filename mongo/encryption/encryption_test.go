@@ -0,0 +1,249 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeyring(t *testing.T, active string, keys map[string][]byte) *Keyring {
+	t.Helper()
+
+	kr, err := NewKeyring(active, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestSealOpen(t *testing.T) {
+	kr := newKeyring(t, "k1", map[string][]byte{"k1": newKey(t)})
+
+	for _, plaintext := range []string{"", "user@example.com", string(make([]byte, 4096))} {
+		env, err := kr.Encrypt([]byte(plaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.KeyID != "k1" {
+			t.Errorf("KeyID = %q; want the active key", env.KeyID)
+		}
+		if len(plaintext) > 0 && bytes.Contains(env.Ciphertext, []byte(plaintext)) {
+			t.Error("the ciphertext contains the plaintext")
+		}
+
+		b, err := kr.Decrypt(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != plaintext {
+			t.Errorf("Decrypt() = %q; want %q", b, plaintext)
+		}
+	}
+
+	// Each value has its own data key and nonces
+	a, _ := kr.Encrypt([]byte("same"))
+	b, _ := kr.Encrypt([]byte("same"))
+	if bytes.Equal(a.Ciphertext, b.Ciphertext) || bytes.Equal(a.DataKey, b.DataKey) {
+		t.Error("encrypting the same value twice gave the same envelope")
+	}
+}
+
+func TestRotatedKey(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+
+	before := newKeyring(t, "old", map[string][]byte{"old": oldKey})
+	env, err := before.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After a rotation, values wrapped by the old key remain readable
+	after := newKeyring(t, "new", map[string][]byte{"old": oldKey, "new": newKey})
+	b, err := after.Decrypt(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "secret" {
+		t.Errorf("Decrypt() = %q; want %q", b, "secret")
+	}
+
+	if env, _ = after.Encrypt([]byte("secret")); env.KeyID != "new" {
+		t.Errorf("KeyID = %q; want new values wrapped by the new key", env.KeyID)
+	}
+
+	// Once the old key is removed, they are not
+	removed := newKeyring(t, "new", map[string][]byte{"new": newKey})
+	if _, err = removed.Decrypt(Envelope{KeyID: "old", DataKey: env.DataKey, Ciphertext: env.Ciphertext}); err == nil {
+		t.Error("decrypted a value with a removed key")
+	}
+}
+
+func TestTamperDetection(t *testing.T) {
+	kr := newKeyring(t, "a", map[string][]byte{"a": newKey(t), "b": newKey(t)})
+
+	env, err := kr.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flip := func(b []byte, i int) []byte {
+		c := append([]byte{}, b...)
+		c[i] ^= 1
+		return c
+	}
+
+	cases := map[string]Envelope{
+		"ciphertext":     {KeyID: env.KeyID, DataKey: env.DataKey, Ciphertext: flip(env.Ciphertext, len(env.Ciphertext)-1)},
+		"nonce":          {KeyID: env.KeyID, DataKey: env.DataKey, Ciphertext: flip(env.Ciphertext, 0)},
+		"data key":       {KeyID: env.KeyID, DataKey: flip(env.DataKey, len(env.DataKey)-1), Ciphertext: env.Ciphertext},
+		"swapped key id": {KeyID: "b", DataKey: env.DataKey, Ciphertext: env.Ciphertext},
+		"unknown key id": {KeyID: "c", DataKey: env.DataKey, Ciphertext: env.Ciphertext},
+		"truncated":      {KeyID: env.KeyID, DataKey: env.DataKey, Ciphertext: env.Ciphertext[:4]},
+	}
+	for name, e := range cases {
+		if _, err := kr.Decrypt(e); err == nil {
+			t.Errorf("%s: tampered envelope was decrypted", name)
+		}
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	if _, err := NewKeyring("missing", map[string][]byte{"k": newKey(t)}); err == nil {
+		t.Error("accepted an active key which is not in the keyring")
+	}
+	if _, err := NewKeyring("k", map[string][]byte{"k": make([]byte, 16)}); err == nil {
+		t.Error("accepted a key of the wrong size")
+	}
+
+	keys, err := ParseKeys(" a:" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=, b:" + "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || len(keys["a"]) != KeySize || keys["b"][0] != 1 {
+		t.Errorf("ParseKeys() = %v", keys)
+	}
+	if _, err = ParseKeys("nocolon"); err == nil {
+		t.Error("accepted a malformed key")
+	}
+}
+
+type testDoc struct {
+	Email EncryptedString `bson:"email"`
+}
+
+func TestCodec(t *testing.T) {
+	kr := newKeyring(t, "k1", map[string][]byte{"k1": newKey(t)})
+	reg := kr.Register(bson.NewRegistryBuilder()).Build()
+
+	// Written as an envelope, and read back as plaintext
+	b, err := bson.MarshalWithRegistry(reg, testDoc{Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("user@example.com")) {
+		t.Error("the encoded document contains the plaintext")
+	}
+	if _, ok := bson.Raw(b).Lookup("email").DocumentOK(); !ok {
+		t.Error("the value was not written as an envelope")
+	}
+
+	doc := testDoc{}
+	if err = bson.UnmarshalWithRegistry(reg, b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Email != "user@example.com" {
+		t.Errorf("Email = %q; want the plaintext", doc.Email)
+	}
+
+	// Legacy plaintext values are read as-is
+	legacy, _ := bson.Marshal(bson.M{"email": "legacy@example.com"})
+	doc = testDoc{}
+	if err = bson.UnmarshalWithRegistry(reg, legacy, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Email != "legacy@example.com" {
+		t.Errorf("Email = %q; want the legacy plaintext", doc.Email)
+	}
+
+	// Empty and null values are not encrypted
+	b, _ = bson.MarshalWithRegistry(reg, testDoc{})
+	if s, ok := bson.Raw(b).Lookup("email").StringValueOK(); !ok || s != "" {
+		t.Error("an empty value was not written as an empty string")
+	}
+	null, _ := bson.Marshal(bson.M{"email": nil})
+	doc = testDoc{Email: "x"}
+	if err = bson.UnmarshalWithRegistry(reg, null, &doc); err != nil || doc.Email != "" {
+		t.Errorf("Email = %q, %v; want a null value read as empty", doc.Email, err)
+	}
+
+	// Envelopes cannot be read without the keyring
+	b, _ = bson.MarshalWithRegistry(reg, testDoc{Email: "user@example.com"})
+	if err = bson.Unmarshal(b, &testDoc{}); err == nil {
+		t.Error("an envelope was read without a keyring")
+	}
+}
+
+func TestDefaultKeyring(t *testing.T) {
+	kr := newKeyring(t, "k1", map[string][]byte{"k1": newKey(t)})
+	defer SetDefault(nil)
+
+	// Without a default keyring, values are written as plaintext
+	SetDefault(nil)
+	b, err := bson.Marshal(testDoc{Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := bson.Raw(b).Lookup("email").StringValueOK(); !ok || s != "user@example.com" {
+		t.Error("the value was not written as plaintext")
+	}
+
+	// With one, bson.Marshal encrypts, and both the default and the client codec can read the result
+	SetDefault(kr)
+	b, err = bson.Marshal(testDoc{Email: "user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bson.Raw(b).Lookup("email").DocumentOK(); !ok {
+		t.Fatal("the value was not written as an envelope")
+	}
+
+	doc := testDoc{}
+	if err = bson.Unmarshal(b, &doc); err != nil || doc.Email != "user@example.com" {
+		t.Errorf("Email = %q, %v; want the plaintext", doc.Email, err)
+	}
+	doc = testDoc{}
+	if err = bson.UnmarshalWithRegistry(kr.Register(bson.NewRegistryBuilder()).Build(), b, &doc); err != nil || doc.Email != "user@example.com" {
+		t.Errorf("Email = %q, %v; want the plaintext with the client codec", doc.Email, err)
+	}
+
+	legacy, _ := bson.Marshal(bson.M{"email": "legacy@example.com"})
+	doc = testDoc{}
+	if err = bson.Unmarshal(legacy, &doc); err != nil || doc.Email != "legacy@example.com" {
+		t.Errorf("Email = %q, %v; want the legacy plaintext", doc.Email, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(struct {
+		Email EncryptedString `json:"email"`
+	}{"user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"email":"user@example.com"}` {
+		t.Errorf("json.Marshal() = %s; want the plaintext", b)
+	}
+}
@@ -32,7 +32,7 @@ var DatabaseRefAPI = []collectionRef{
 				},
 				"dislay_name":   {BSONType: TList{BSONTypeString}},
 				"discriminator": {BSONType: TList{BSONTypeString}, MinLength: utils.PointerOf(int64(4)), MaxLength: utils.PointerOf(int64(4))},
-				"email":         {BSONType: TList{BSONTypeString}},
+				"email":         {BSONType: TList{BSONTypeString, BSONTypeObject}},
 				"role_ids": {
 					BSONType: TList{BSONTypeArray},
 					Items:    []*jsonSchema{{BSONType: TList{BSONTypeObjectId}}},
@@ -44,10 +44,14 @@ var DatabaseRefAPI = []collectionRef{
 						Required: []string{"id", "permissions"},
 						Properties: map[string]*jsonSchema{
 							"id":          {BSONType: TList{BSONTypeObjectId}},
-							"connections": {BSONType: TList{BSONTypeArray}, Items: []*jsonSchema{{BSONType: TList{BSONTypeObjectId}}}},
+							"connections": {BSONType: TList{BSONTypeArray}, Items: []*jsonSchema{{BSONType: TList{BSONTypeString}}}},
+							"emote_sets":  {BSONType: TList{BSONTypeArray}, Items: []*jsonSchema{{BSONType: TList{BSONTypeObjectId}}}},
 							"permissions": {BSONType: TList{BSONTypeInt32}},
 							"visible":     {BSONType: TList{BSONTypeBoolean}},
 							"added_at":    {BSONType: TList{BSONTypeDate}},
+							"pending":     {BSONType: TList{BSONTypeBoolean}},
+							"invited_by":  {BSONType: TList{BSONTypeObjectId}},
+							"expire_at":   {BSONType: TList{BSONTypeDate}},
 						},
 					}},
 				},
@@ -60,7 +64,7 @@ var DatabaseRefAPI = []collectionRef{
 						BSONType: TList{BSONTypeObject},
 						Properties: map[string]*jsonSchema{
 							"id":        {BSONType: TList{BSONTypeString}},
-							"platform":  {BSONType: TList{BSONTypeString}, Enum: []string{"TWITCH", "YOUTUBE"}},
+							"platform":  {BSONType: TList{BSONTypeString}, Enum: connectionPlatformEnum()},
 							"linked_at": {BSONType: TList{BSONTypeDate}},
 						},
 					}},
@@ -69,6 +73,22 @@ var DatabaseRefAPI = []collectionRef{
 		},
 	},
 
+	// Collection: Reports
+	{
+		Name: string(mongo.CollectionNameReports),
+		Indexes: []mongo.IndexModel{
+			// A user may only have one report open for the same target.
+			// Partial filters are equality-only so the index builds on MongoDB 5.0
+			{
+				Keys: bson.D{{Key: "reporter_id", Value: 1}, {Key: "target_id", Value: 1}},
+				Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+					"open": true,
+				}),
+			},
+			{Keys: bson.D{{Key: "reporter_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+	},
+
 	// Collection: Emotes
 	{
 		Name: "emotes",
@@ -138,6 +158,16 @@ var DatabaseRefAPI = []collectionRef{
 		},
 	},
 
+	// Collection: Emote Tags
+	{
+		Name: string(mongo.CollectionNameEmoteTags),
+		Indexes: []mongo.IndexModel{
+			{Keys: bson.M{"name": 1}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.M{"synonyms": 1}},
+			{Keys: bson.M{"usage_count": -1}},
+		},
+	},
+
 	// Collection: Roles
 	{
 		Name: string(mongo.CollectionNameRoles),
@@ -166,3 +196,14 @@ var DatabaseRefAPI = []collectionRef{
 		},
 	},
 }
+
+// connectionPlatformEnum lists the platforms of the connection registry
+func connectionPlatformEnum() []string {
+	platforms := structures.ConnectionPlatforms()
+
+	result := make([]string, len(platforms))
+	for i, p := range platforms {
+		result[i] = string(p)
+	}
+	return result
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/patrickmn/go-cache"
+	"github.com/seventv/common/mongo/encryption"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -13,6 +14,11 @@ import (
 
 var ErrNoDocuments = mongo.ErrNoDocuments
 
+// IsDuplicateKeyError returns whether or not the error was caused by a unique index violation
+func IsDuplicateKeyError(err error) bool {
+	return mongo.IsDuplicateKeyError(err)
+}
+
 type Lookup struct {
 	From         CollectionName `bson:"from"`
 	LocalField   string         `bson:"localField"`
@@ -28,7 +34,13 @@ type LookupWithPipeline struct {
 }
 
 func Setup(ctx context.Context, opt SetupOptions) (Instance, error) {
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(opt.URI).SetDirect(opt.Direct))
+	clientOptions := options.Client().ApplyURI(opt.URI).SetDirect(opt.Direct)
+	if opt.Keyring != nil {
+		clientOptions.SetRegistry(opt.Keyring.Register(bson.NewRegistryBuilder()).Build())
+		encryption.SetDefault(opt.Keyring) // for connection data, which is marshaled outside of the client
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -52,13 +64,17 @@ type SetupOptions struct {
 	URI    string
 	DB     string
 	Direct bool
+	// The keyring used to encrypt and decrypt fields at rest
+	Keyring *encryption.Keyring
 }
 
 type (
-	Pipeline       = mongo.Pipeline
-	WriteModel     = mongo.WriteModel
-	InsertOneModel = mongo.InsertOneModel
-	UpdateOneModel = mongo.UpdateOneModel
-	DeleteOneModel = mongo.DeleteOneModel
-	IndexModel     = mongo.IndexModel
+	Pipeline        = mongo.Pipeline
+	WriteModel      = mongo.WriteModel
+	InsertOneModel  = mongo.InsertOneModel
+	UpdateOneModel  = mongo.UpdateOneModel
+	UpdateManyModel = mongo.UpdateManyModel
+	DeleteOneModel  = mongo.DeleteOneModel
+	IndexModel      = mongo.IndexModel
+	SessionContext  = mongo.SessionContext
 )
@@ -3,19 +3,20 @@ package structures
 import (
 	"time"
 
+	"github.com/seventv/common/mongo/encryption"
 	"github.com/seventv/common/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type User struct {
-	ID           primitive.ObjectID   `json:"_id" bson:"_id,omitempty"`
-	Email        string               `json:"email" bson:"email"`
-	Rank         int32                `json:"rank" bson:"rank"`
-	EmoteIDs     []primitive.ObjectID `json:"emote_ids" bson:"emotes"`
-	EditorIDs    []primitive.ObjectID `json:"editor_ids" bson:"editors"`
-	RoleID       *primitive.ObjectID  `json:"role_id" bson:"role"`
-	TokenVersion string               `json:"token_version" bson:"token_version"`
+	ID           primitive.ObjectID         `json:"_id" bson:"_id,omitempty"`
+	Email        encryption.EncryptedString `json:"email" bson:"email"`
+	Rank         int32                      `json:"rank" bson:"rank"`
+	EmoteIDs     []primitive.ObjectID       `json:"emote_ids" bson:"emotes"`
+	EditorIDs    []primitive.ObjectID       `json:"editor_ids" bson:"editors"`
+	RoleID       *primitive.ObjectID        `json:"role_id" bson:"role"`
+	TokenVersion string                     `json:"token_version" bson:"token_version"`
 
 	// Twitch Data
 	TwitchID         string              `json:"twitch_id" bson:"id"`
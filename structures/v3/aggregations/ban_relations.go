@@ -69,12 +69,16 @@ var UserRelationBans = []bson.D{
 					Key: "$match",
 					Value: bson.M{
 						"$expr": bson.M{
-							"$eq": bson.A{"$victim_id", "$$user_id"},
-						},
-						"$or": bson.A{
-							bson.M{"expire_at": time.Time{}},
-							bson.M{
-								"expire_at": bson.M{"$gt": time.Now()},
+							"$and": bson.A{
+								bson.M{"$eq": bson.A{"$victim_id", "$$user_id"}},
+								// Omit revoked bans
+								bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$revoked_at", nil}}, nil}},
+								// Omit expired bans, unless permanent
+								bson.M{"$or": bson.A{
+									bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$expire_at", nil}}, nil}},
+									bson.M{"$eq": bson.A{"$expire_at", time.Time{}}},
+									bson.M{"$gt": bson.A{"$expire_at", "$$NOW"}},
+								}},
 							},
 						},
 					},
@@ -138,7 +138,10 @@ var UserRelationEditorOf = []bson.D{
 						"id":          "$_id", // Replace the _id field with "id"
 						"permissions": "$as_editor.permissions",
 						"connections": "$as_editor.connections",
+						"emote_sets":  "$as_editor.emote_sets",
 						"visible":     "$as_editor.visible",
+						"pending":     "$as_editor.pending",
+						"expire_at":   "$as_editor.expire_at",
 						"user":        "$user",
 					},
 				}},
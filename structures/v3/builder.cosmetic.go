@@ -0,0 +1,56 @@
+package structures
+
+type CosmeticBuilder[D CosmeticData] struct {
+	Update   UpdateMap
+	Cosmetic Cosmetic[D]
+
+	initial Cosmetic[D]
+	tainted bool
+}
+
+func NewCosmeticBuilder[D CosmeticData](cosmetic Cosmetic[D]) *CosmeticBuilder[D] {
+	return &CosmeticBuilder[D]{
+		Update:   UpdateMap{},
+		Cosmetic: cosmetic,
+		initial:  cosmetic,
+	}
+}
+
+// Initial returns a pointer to the value first passed to this Builder
+func (cb *CosmeticBuilder[D]) Initial() Cosmetic[D] {
+	return cb.initial
+}
+
+// IsTainted returns whether or not this Builder has been mutated before
+func (cb *CosmeticBuilder[D]) IsTainted() bool {
+	return cb.tainted
+}
+
+// MarkAsTainted taints the builder, preventing it from being mutated again
+func (cb *CosmeticBuilder[D]) MarkAsTainted() {
+	cb.tainted = true
+}
+
+func (cb *CosmeticBuilder[D]) SetKind(kind CosmeticKind) *CosmeticBuilder[D] {
+	cb.Cosmetic.Kind = kind
+	cb.Update.Set("kind", kind)
+	return cb
+}
+
+func (cb *CosmeticBuilder[D]) SetName(name string) *CosmeticBuilder[D] {
+	cb.Cosmetic.Name = name
+	cb.Update.Set("name", name)
+	return cb
+}
+
+func (cb *CosmeticBuilder[D]) SetPriority(priority int) *CosmeticBuilder[D] {
+	cb.Cosmetic.Priority = priority
+	cb.Update.Set("priority", priority)
+	return cb
+}
+
+func (cb *CosmeticBuilder[D]) SetData(data D) *CosmeticBuilder[D] {
+	cb.Cosmetic.Data = data
+	cb.Update.Set("data", data)
+	return cb
+}
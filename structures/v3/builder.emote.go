@@ -143,3 +143,47 @@ func (eb *EmoteBuilder) RemoveVersion(id ObjectID) *EmoteBuilder {
 	eb.Update.Pull("versions", bson.M{"id": id})
 	return eb
 }
+
+// AddOwnershipTransfer: add a pending ownership transfer to the emote
+func (eb *EmoteBuilder) AddOwnershipTransfer(t EmoteOwnershipTransfer) *EmoteBuilder {
+	for _, tt := range eb.Emote.State.Transfers {
+		if tt.RecipientID == t.RecipientID {
+			return eb // transfer already pending
+		}
+	}
+
+	eb.Emote.State.Transfers = append(eb.Emote.State.Transfers, t)
+	eb.Emote.State.Claimants = append(eb.Emote.State.Claimants, t.RecipientID)
+	eb.Update.Push("state.transfers", t)
+	eb.Update.AddToSet("state.claimants", t.RecipientID)
+	return eb
+}
+
+// RemoveOwnershipTransfer: remove the pending ownership transfer of a recipient
+func (eb *EmoteBuilder) RemoveOwnershipTransfer(recipientID ObjectID) *EmoteBuilder {
+	_, ind := eb.Emote.GetOwnershipTransfer(recipientID)
+	if ind == -1 {
+		return eb
+	}
+
+	copy(eb.Emote.State.Transfers[ind:], eb.Emote.State.Transfers[ind+1:])
+	eb.Emote.State.Transfers = eb.Emote.State.Transfers[:len(eb.Emote.State.Transfers)-1]
+	for i, id := range eb.Emote.State.Claimants {
+		if id == recipientID {
+			eb.Emote.State.Claimants = append(eb.Emote.State.Claimants[:i], eb.Emote.State.Claimants[i+1:]...)
+			break
+		}
+	}
+	eb.Update.Pull("state.transfers", bson.M{"recipient_id": recipientID})
+	eb.Update.Pull("state.claimants", recipientID)
+	return eb
+}
+
+// ClearOwnershipTransfers: remove all pending ownership transfers from the emote
+func (eb *EmoteBuilder) ClearOwnershipTransfers() *EmoteBuilder {
+	eb.Emote.State.Transfers = []EmoteOwnershipTransfer{}
+	eb.Emote.State.Claimants = []primitive.ObjectID{}
+	eb.Update.Set("state.transfers", eb.Emote.State.Transfers)
+	eb.Update.Set("state.claimants", eb.Emote.State.Claimants)
+	return eb
+}
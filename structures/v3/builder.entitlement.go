@@ -7,6 +7,7 @@ type EntitlementBuilder[D EntitlementData] struct {
 
 	User    *User
 	initial Entitlement[D]
+	tainted bool
 }
 
 func NewEntitlementBuilder[D EntitlementData](ent Entitlement[D]) *EntitlementBuilder[D] {
@@ -45,3 +46,24 @@ func (b *EntitlementBuilder[D]) SetApp(app EntitlementApp) *EntitlementBuilder[D
 	b.Entitlement.App = &app
 	return b
 }
+
+// SetDisabled: Change whether the entitlement is inactive
+func (b *EntitlementBuilder[D]) SetDisabled(disabled bool) *EntitlementBuilder[D] {
+	b.Entitlement.Disabled = disabled
+	return b
+}
+
+// Initial returns a pointer to the value first passed to this Builder
+func (b *EntitlementBuilder[D]) Initial() Entitlement[D] {
+	return b.initial
+}
+
+// IsTainted returns whether or not this Builder has been mutated before
+func (b *EntitlementBuilder[D]) IsTainted() bool {
+	return b.tainted
+}
+
+// MarkAsTainted taints the builder, preventing it from being mutated again
+func (b *EntitlementBuilder[D]) MarkAsTainted() {
+	b.tainted = true
+}
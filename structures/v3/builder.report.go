@@ -1,6 +1,7 @@
 package structures
 
 import (
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,16 +10,34 @@ import (
 type ReportBuilder struct {
 	Update UpdateMap
 	Report Report
+
+	initial Report
+	tainted bool
 }
 
 // NewReportBuilder: create a new report builder
 func NewReportBuilder(report Report) *ReportBuilder {
 	return &ReportBuilder{
-		Update: map[string]interface{}{},
-		Report: report,
+		Update:  map[string]interface{}{},
+		Report:  report,
+		initial: report,
 	}
 }
 
+func (rb *ReportBuilder) Initial() Report {
+	return rb.initial
+}
+
+// IsTainted returns whether or not this Builder has been mutated before
+func (rb *ReportBuilder) IsTainted() bool {
+	return rb.tainted
+}
+
+// MarkAsTainted taints the builder, preventing it from being mutated again
+func (rb *ReportBuilder) MarkAsTainted() {
+	rb.tainted = true
+}
+
 func (rb *ReportBuilder) SetTargetKind(kind ObjectKind) *ReportBuilder {
 	rb.Report.TargetKind = kind
 	rb.Update.Set("target_kind", kind)
@@ -63,7 +82,9 @@ func (rb *ReportBuilder) SetPriority(p int32) *ReportBuilder {
 
 func (rb *ReportBuilder) SetStatus(s ReportStatus) *ReportBuilder {
 	rb.Report.Status = s
+	rb.Report.Open = s != ReportStatusClosed
 	rb.Update.Set("status", s)
+	rb.Update.Set("open", rb.Report.Open)
 	return rb
 }
 
@@ -100,3 +121,31 @@ func (rb *ReportBuilder) AddNote(note ReportNote) *ReportBuilder {
 	rb.Update.AddToSet("notes", note)
 	return rb
 }
+
+// SetNoteReply: set the reporter's reply to a note
+func (rb *ReportBuilder) SetNoteReply(id primitive.ObjectID, reply string, t time.Time) *ReportBuilder {
+	_, ind := rb.Report.GetNote(id)
+	if ind == -1 {
+		return rb
+	}
+
+	rb.Report.Notes[ind].Reply = reply
+	rb.Report.Notes[ind].RepliedAt = t
+	rb.Report.Notes[ind].Read = true
+	rb.Update.Set(fmt.Sprintf("notes.%d.reply", ind), reply)
+	rb.Update.Set(fmt.Sprintf("notes.%d.replied_at", ind), t)
+	rb.Update.Set(fmt.Sprintf("notes.%d.read", ind), true)
+	return rb
+}
+
+func (rb *ReportBuilder) SetResolution(r ReportResolution) *ReportBuilder {
+	rb.Report.Resolution = r
+	rb.Update.Set("resolution", r)
+	return rb
+}
+
+func (rb *ReportBuilder) SetClosedAt(t time.Time) *ReportBuilder {
+	rb.Report.ClosedAt = t
+	rb.Update.Set("closed_at", t)
+	return rb
+}
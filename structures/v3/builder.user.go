@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/seventv/common/mongo/encryption"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -69,8 +70,8 @@ func (ub *UserBuilder) SetDiscriminator(discrim string) *UserBuilder {
 
 // SetEmail: set the email for the user
 func (ub *UserBuilder) SetEmail(email string) *UserBuilder {
-	ub.User.Email = email
-	ub.Update.Set("email", email)
+	ub.User.Email = encryption.EncryptedString(email)
+	ub.Update.Set("email", ub.User.Email)
 
 	return ub
 }
@@ -148,10 +149,82 @@ func (ub *UserBuilder) UpdateEditor(id ObjectID, permissions UserEditorPermissio
 	v := ub.User.Editors[ind]
 	v.Permissions = permissions
 	v.Visible = visible
+	ub.User.Editors[ind] = v
 	ub.Update.Set(fmt.Sprintf("editors.%d", ind), v)
 	return ub
 }
 
+// InviteEditor adds a pending editor, or renews the invitation of one already pending
+func (ub *UserBuilder) InviteEditor(id ObjectID, invitedBy ObjectID, permissions UserEditorPermission, visible bool, expireAt time.Time) *UserBuilder {
+	ed := UserEditor{
+		ID:          id,
+		Permissions: permissions,
+		Visible:     visible,
+		AddedAt:     time.Now(),
+		Pending:     true,
+		InvitedBy:   invitedBy,
+		ExpireAt:    expireAt,
+	}
+
+	for i, e := range ub.User.Editors {
+		if e.ID != id {
+			continue
+		}
+		if !e.Pending {
+			return ub // editor already accepted.
+		}
+
+		ub.User.Editors[i] = ed
+		ub.Update.Set(fmt.Sprintf("editors.%d", i), ed)
+		return ub
+	}
+
+	ub.User.Editors = append(ub.User.Editors, ed)
+	ub.Update.AddToSet("editors", ed)
+	return ub
+}
+
+// AcceptEditor makes a pending editor active
+func (ub *UserBuilder) AcceptEditor(id ObjectID) *UserBuilder {
+	for i, e := range ub.User.Editors {
+		if e.ID != id || !e.Pending {
+			continue
+		}
+
+		e.Pending = false
+		e.ExpireAt = time.Time{}
+		e.AddedAt = time.Now()
+		ub.User.Editors[i] = e
+		ub.Update.Set(fmt.Sprintf("editors.%d", i), e)
+		break
+	}
+	return ub
+}
+
+// SetEditorScope limits the permissions of an editor to connections and emote sets. Empty lists remove the limit
+func (ub *UserBuilder) SetEditorScope(id ObjectID, connections []string, emoteSets []ObjectID) *UserBuilder {
+	for i, e := range ub.User.Editors {
+		if e.ID != id {
+			continue
+		}
+
+		e.Connections = connections
+		e.EmoteSets = emoteSets
+		ub.User.Editors[i] = e
+
+		// The editor may be added by this same update
+		if added, ok := ub.Update["$addToSet"].(bson.M); ok {
+			if v, ok := added["editors"].(UserEditor); ok && v.ID == id {
+				ub.Update.AddToSet("editors", e)
+				break
+			}
+		}
+		ub.Update.Set(fmt.Sprintf("editors.%d", i), e)
+		break
+	}
+	return ub
+}
+
 func (ub *UserBuilder) RemoveEditor(id ObjectID) *UserBuilder {
 	ind := -1
 	for i := range ub.User.Editors {
@@ -0,0 +1,188 @@
+package structures
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// CosmeticColor decodes a color packed as 0xRRGGBBAA, as used by roles and paints
+func CosmeticColor(c int32) color.NRGBA {
+	u := uint32(c)
+
+	return color.NRGBA{
+		R: uint8(u >> 24),
+		G: uint8(u >> 16),
+		B: uint8(u >> 8),
+		A: uint8(u),
+	}
+}
+
+// CSS renders the paint as a CSS rule for the class name, for use by web renderers
+//
+// The paint is applied to the text of the element. If the paint is animated,
+// a keyframes rule named after the class is appended. The class name is escaped
+// as a CSS identifier. The output is deterministic for a given paint and class name
+func (p CosmeticDataPaint) CSS(class string) string {
+	var sb strings.Builder
+
+	ident := cssIdentifier(class)
+	sb.WriteString("." + ident + " {\n")
+	if p.Color != nil {
+		writeCSSDeclaration(&sb, "background-color", cssColor(*p.Color))
+	}
+	if img := p.cssBackgroundImage(); img != "" {
+		writeCSSDeclaration(&sb, "background-image", img)
+		writeCSSDeclaration(&sb, "background-size", "cover")
+	}
+	writeCSSDeclaration(&sb, "-webkit-background-clip", "text")
+	writeCSSDeclaration(&sb, "background-clip", "text")
+	writeCSSDeclaration(&sb, "-webkit-text-fill-color", "transparent")
+
+	if len(p.DropShadows) > 0 {
+		shadows := make([]string, len(p.DropShadows))
+		for i, ds := range p.DropShadows {
+			shadows[i] = fmt.Sprintf("drop-shadow(%s %s %s %s)", cssPx(ds.OffsetX), cssPx(ds.OffsetY), cssPx(ds.Radius), cssColor(ds.Color))
+		}
+		writeCSSDeclaration(&sb, "filter", strings.Join(shadows, " "))
+	}
+
+	a := p.Animation
+	if a != nil && len(a.Keyframes) > 0 {
+		writeCSSDeclaration(&sb, "animation", fmt.Sprintf("%s %dms linear infinite", ident, a.Speed))
+	}
+	sb.WriteString("}\n")
+
+	if a != nil && len(a.Keyframes) > 0 {
+		sb.WriteString("@keyframes " + ident + " {\n")
+		for _, kf := range a.Keyframes {
+			sb.WriteString(fmt.Sprintf("  %s%% { background-position: %s %s; }\n", cssNumber(kf.At*100), cssPx(kf.X), cssPx(kf.Y)))
+		}
+		sb.WriteString("}\n")
+	}
+
+	return sb.String()
+}
+
+// cssBackgroundImage returns the CSS image value of the paint's function, or an empty string if there is none
+func (p CosmeticDataPaint) cssBackgroundImage() string {
+	switch p.Function {
+	case CosmeticPaintFunctionImageURL:
+		if p.ImageURL == "" {
+			return ""
+		}
+		return "url(" + cssString(p.ImageURL) + ")"
+	case CosmeticPaintFunctionLinearGradient, CosmeticPaintFunctionRadialGradient:
+		if len(p.Stops) == 0 {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	args := make([]string, 0, len(p.Stops)+1)
+	name := "linear-gradient"
+	if p.Function == CosmeticPaintFunctionRadialGradient {
+		name = "radial-gradient"
+		shape := p.Shape
+		if shape == "" {
+			shape = "ellipse"
+		}
+		args = append(args, shape)
+	} else {
+		args = append(args, strconv.Itoa(int(p.Angle))+"deg")
+	}
+	if p.Repeat {
+		name = "repeating-" + name
+	}
+
+	for _, stop := range p.Stops {
+		args = append(args, cssColor(stop.Color)+" "+cssNumber(stop.At*100)+"%")
+	}
+
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func writeCSSDeclaration(sb *strings.Builder, property, value string) {
+	sb.WriteString("  " + property + ": " + value + ";\n")
+}
+
+// cssString quotes a string for CSS: quotes and backslashes are escaped, and control characters
+// are written as hexadecimal escapes
+func cssString(s string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r == 0:
+			sb.WriteRune('\uFFFD')
+		case r < 0x20 || r == 0x7f:
+			sb.WriteString(cssHexEscape(r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// cssIdentifier escapes a string for use as a CSS identifier, such as a class or animation name,
+// following the serialization of identifiers in CSSOM
+func cssIdentifier(s string) string {
+	if s == "-" {
+		return "\\-"
+	}
+
+	var sb strings.Builder
+	for i, r := range []rune(s) {
+		switch {
+		case r == 0:
+			sb.WriteRune('\uFFFD')
+		case r < 0x20 || r == 0x7f:
+			sb.WriteString(cssHexEscape(r))
+		case r >= '0' && r <= '9' && (i == 0 || (i == 1 && s[0] == '-')):
+			// Identifiers cannot start with a digit, or a hyphen followed by a digit
+			sb.WriteString(cssHexEscape(r))
+		case r >= 0x80 || r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
+
+// cssHexEscape escapes a character as its hexadecimal code point, terminated by a space
+func cssHexEscape(r rune) string {
+	return "\\" + strconv.FormatInt(int64(r), 16) + " "
+}
+
+func cssColor(c int32) string {
+	rgba := CosmeticColor(c)
+
+	return fmt.Sprintf("rgba(%d, %d, %d, %s)", rgba.R, rgba.G, rgba.B, cssNumber(float64(rgba.A)/255))
+}
+
+func cssPx(f float64) string {
+	return cssNumber(f) + "px"
+}
+
+// cssNumber formats a number with at most 3 decimals and no trailing zeroes
+func cssNumber(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 3, 64)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
+
+	return s
+}
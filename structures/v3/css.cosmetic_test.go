@@ -0,0 +1,62 @@
+package structures
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCSSString(t *testing.T) {
+	cases := map[string]string{
+		"https://cdn.7tv.app/paint.webp": `"https://cdn.7tv.app/paint.webp"`,
+		`a"b\c`:                          `"a\"b\\c"`,
+		"a\nb\x7f":                       `"a\a b\7f "`,
+		"\x00é":                          "\"\uFFFDé\"",
+		`x");} body { color: red`:        `"x\");} body { color: red"`,
+	}
+	for in, want := range cases {
+		if got := cssString(in); got != want {
+			t.Errorf("cssString(%q) = %s; want %s", in, got, want)
+		}
+	}
+}
+
+func TestCSSIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"paint-1_a": "paint-1_a",
+		"1paint":    `\31 paint`,
+		"-1paint":   `-\31 paint`,
+		"-":         `\-`,
+		"--x":       "--x",
+		"a b{}.c":   `a\ b\{\}\.c`,
+		"a\nb":      `a\a b`,
+		"ümlaut":    "ümlaut",
+	}
+	for in, want := range cases {
+		if got := cssIdentifier(in); got != want {
+			t.Errorf("cssIdentifier(%q) = %s; want %s", in, got, want)
+		}
+	}
+}
+
+func TestPaintCSSEscapesClass(t *testing.T) {
+	p := CosmeticDataPaint{
+		Function: CosmeticPaintFunctionImageURL,
+		ImageURL: `x") } body { color: red`,
+		Animation: &CosmeticPaintAnimation{
+			Speed:     1000,
+			Keyframes: []CosmeticPaintAnimationKeyframe{{At: 0}, {At: 1, X: 10}},
+		},
+	}
+
+	css := p.CSS("p} body {")
+	for _, want := range []string{
+		`.p\}\ body\ \{ {`,
+		`animation: p\}\ body\ \{ 1000ms linear infinite;`,
+		`@keyframes p\}\ body\ \{ {`,
+		`background-image: url("x\") } body { color: red");`,
+	} {
+		if !strings.Contains(css, want) {
+			t.Errorf("CSS() does not contain %q:\n%s", want, css)
+		}
+	}
+}
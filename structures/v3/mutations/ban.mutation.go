@@ -50,6 +50,10 @@ func (m *Mutate) CreateBan(ctx context.Context, bb *structures.BanBuilder, opt C
 		}
 	}
 
+	if err := validateBanIPs(bb.Ban); err != nil {
+		return err
+	}
+
 	// Write
 	result, err := m.mongo.Collection(mongo.CollectionNameBans).InsertOne(ctx, bb.Ban)
 	if err != nil {
@@ -60,6 +64,10 @@ func (m *Mutate) CreateBan(ctx context.Context, bb *structures.BanBuilder, opt C
 	// Get the newly created ban
 	_ = m.mongo.Collection(mongo.CollectionNameBans).FindOne(ctx, bson.M{"_id": bb.Ban.ID}).Decode(bb.Ban)
 
+	if len(bb.Ban.IPs) > 0 {
+		m.publishIPBans(ctx)
+	}
+
 	// Send a message to the victim
 	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
 		SetKind(structures.MessageKindInbox).
@@ -124,14 +132,215 @@ func (m *Mutate) EditBan(ctx context.Context, bb *structures.BanBuilder, opt Edi
 		}
 	}
 
+	if err := validateBanIPs(bb.Ban); err != nil {
+		return err
+	}
+
 	// Write the change
 	if _, err := m.mongo.Collection(mongo.CollectionNameBans).UpdateOne(ctx, bson.M{"_id": bb.Ban.ID}, bb.Update); err != nil {
 		return errors.ErrInternalServerError().SetDetail(err.Error())
 	}
 
+	if len(bb.Ban.IPs) > 0 || len(bb.Initial().IPs) > 0 {
+		m.publishIPBans(ctx)
+	}
+
 	return nil
 }
 
 type EditBanOptions struct {
 	Actor *structures.User
 }
+
+// RevokeBan: lift a ban before its expiry
+//
+// The ban is kept for the victim's history, and the victim is notified
+func (m *Mutate) RevokeBan(ctx context.Context, bb *structures.BanBuilder, opt RevokeBanOptions) error {
+	if bb == nil || bb.Ban.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if bb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+	if !actor.HasPermission(structures.RolePermissionManageBans) {
+		return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_BANS",
+		})
+	}
+	if !bb.Ban.IsActive() {
+		return errors.ErrInvalidRequest().SetDetail("This ban is no longer in effect")
+	}
+
+	// Write the change
+	now := time.Now()
+	bb.SetRevoked(now, actor.ID, opt.Reason)
+
+	res, err := m.mongo.Collection(mongo.CollectionNameBans).UpdateOne(ctx, bson.M{
+		"_id":        bb.Ban.ID,
+		"revoked_at": bson.M{"$exists": false},
+	}, bb.Update)
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.MatchedCount == 0 {
+		return errors.ErrInvalidRequest().SetDetail("This ban was already revoked")
+	}
+
+	// Write audit log
+	alb := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+		SetKind(structures.AuditLogKindUnban).
+		SetActor(actor.ID).
+		SetTargetKind(structures.ObjectKindUser).
+		SetTargetID(bb.Ban.VictimID).
+		AddChanges((&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "ban",
+		}).WriteSingleValues(nil, bb.Ban.ID))
+	if _, err = m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, alb.AuditLog); err != nil {
+		zap.S().Errorw("mongo, failed to write audit log entry for revoked ban",
+			"error", err,
+			"ban_id", bb.Ban.ID.Hex(),
+		)
+	}
+
+	if len(bb.Ban.IPs) > 0 {
+		m.publishIPBans(ctx)
+	}
+
+	// Send a message to the victim
+	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+		SetKind(structures.MessageKindInbox).
+		SetAuthorID(actor.ID).
+		SetTimestamp(now).
+		SetAnonymous(opt.AnonymousActor).
+		SetData(structures.MessageDataInbox{
+			Subject:   "inbox.generic.client_unbanned.subject",
+			Content:   "inbox.generic.client_unbanned.content",
+			Important: true,
+			Locale:    true,
+			Placeholders: map[string]string{
+				"BAN_REASON":    bb.Ban.Reason,
+				"REVOKE_REASON": opt.Reason,
+			},
+		})
+	if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+		Actor:      actor,
+		Recipients: []primitive.ObjectID{bb.Ban.VictimID},
+	}); err != nil {
+		zap.S().Errorw("failed to send inbox message to victim about revoked ban",
+			"error", err,
+			"actor_id", actor.ID.Hex(),
+			"victim_id", bb.Ban.VictimID.Hex(),
+			"ban_id", bb.Ban.ID.Hex(),
+		)
+	}
+
+	bb.MarkAsTainted()
+	return nil
+}
+
+type RevokeBanOptions struct {
+	Actor          *structures.User
+	AnonymousActor bool
+	Reason         string
+}
+
+// NotifyExpiredBans: notify the victims of bans which have lapsed
+//
+// This is meant to be run periodically by a cron job. Each lapsed ban is only notified once,
+// and bans which were revoked are skipped as their victim was already notified
+func (m *Mutate) NotifyExpiredBans(ctx context.Context, opt BanExpiryNotifyOptions) (int, error) {
+	actor := opt.Actor
+	if actor == nil {
+		return 0, errors.ErrUnauthorized()
+	}
+
+	now := time.Now()
+	cur, err := m.mongo.Collection(mongo.CollectionNameBans).Find(ctx, bson.M{
+		"expire_at": bson.M{
+			"$gt":  time.Time{},
+			"$lte": now,
+		},
+		"revoked_at":      bson.M{"$exists": false},
+		"expiry_notified": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	bans := []structures.Ban{}
+	if err = cur.All(ctx, &bans); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	count := 0
+	for _, ban := range bans {
+		// Mark the ban first so that a failed message is not sent again in a loop
+		res, err := m.mongo.Collection(mongo.CollectionNameBans).UpdateOne(ctx, bson.M{
+			"_id":             ban.ID,
+			"expiry_notified": bson.M{"$ne": true},
+		}, bson.M{"$set": bson.M{"expiry_notified": true}})
+		if err != nil {
+			return count, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if res.ModifiedCount == 0 {
+			continue // notified concurrently
+		}
+
+		mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+			SetKind(structures.MessageKindInbox).
+			SetAuthorID(actor.ID).
+			SetTimestamp(now).
+			SetData(structures.MessageDataInbox{
+				Subject:   "inbox.generic.client_ban_expired.subject",
+				Content:   "inbox.generic.client_ban_expired.content",
+				Important: true,
+				Locale:    true,
+				System:    true,
+				Placeholders: map[string]string{
+					"BAN_REASON":    ban.Reason,
+					"BAN_EXPIRE_AT": ban.ExpireAt.Format(time.RFC822),
+				},
+			})
+		if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+			Actor:      actor,
+			Recipients: []primitive.ObjectID{ban.VictimID},
+		}); err != nil {
+			zap.S().Errorw("failed to send inbox message to victim about expired ban",
+				"error", err,
+				"victim_id", ban.VictimID.Hex(),
+				"ban_id", ban.ID.Hex(),
+			)
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+type BanExpiryNotifyOptions struct {
+	// The user sending the notification to victims
+	Actor *structures.User
+}
+
+// validateBanIPs checks that the IPs of a ban are valid addresses or CIDR ranges
+func validateBanIPs(ban structures.Ban) error {
+	if _, err := ban.Prefixes(); err != nil {
+		return errors.ErrValidationRejected().SetDetail("Invalid IP address or range: %s", err.Error())
+	}
+	return nil
+}
+
+// publishIPBans notifies the query instances that the blocked IP ranges changed
+func (m *Mutate) publishIPBans(ctx context.Context) {
+	k := m.redis.ComposeKey("common", structures.IPBanUpdateChannel)
+	if err := m.redis.RawClient().Publish(ctx, k.String(), "1").Err(); err != nil {
+		zap.S().Errorw("redis, failed to publish ip ban update",
+			"error", err,
+		)
+	}
+}
@@ -0,0 +1,212 @@
+package mutations
+
+import (
+	"context"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// CreateCosmetic: create a new badge or paint
+func (m *Mutate) CreateCosmetic(ctx context.Context, cb *structures.CosmeticBuilder[bson.Raw], opt CosmeticMutationOptions) error {
+	if cb == nil {
+		return structures.ErrIncompleteMutation
+	} else if cb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkCosmeticPermission(opt.Actor); err != nil {
+		return err
+	}
+	if cb.Cosmetic.Name == "" {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a name")
+	}
+	if err := validateCosmetic(cb.Cosmetic); err != nil {
+		return err
+	}
+
+	// Write
+	cb.Cosmetic.ID = primitive.NewObjectID()
+	if cb.Cosmetic.UserIDs == nil {
+		cb.Cosmetic.UserIDs = []primitive.ObjectID{}
+	}
+	if _, err := m.mongo.Collection(mongo.CollectionNameCosmetics).InsertOne(ctx, cb.Cosmetic); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	m.logCosmetic(ctx, structures.AuditLogKindCreateCosmetic, opt, cb.Cosmetic.ID,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "name",
+		}).WriteSingleValues(nil, cb.Cosmetic.Name),
+	)
+
+	cb.MarkAsTainted()
+	return nil
+}
+
+// EditCosmetic: edit a badge or paint. Modify the CosmeticBuilder beforehand!
+func (m *Mutate) EditCosmetic(ctx context.Context, cb *structures.CosmeticBuilder[bson.Raw], opt CosmeticMutationOptions) error {
+	if cb == nil || cb.Cosmetic.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if cb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkCosmeticPermission(opt.Actor); err != nil {
+		return err
+	}
+	if len(cb.Update) == 0 {
+		return nil
+	}
+
+	init := cb.Initial()
+	if cb.Cosmetic.Kind != init.Kind {
+		return errors.ErrInvalidRequest().SetDetail("The kind of a cosmetic cannot be changed")
+	}
+	if cb.Cosmetic.Name == "" {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a name")
+	}
+	if err := validateCosmetic(cb.Cosmetic); err != nil {
+		return err
+	}
+
+	if err := m.mongo.Collection(mongo.CollectionNameCosmetics).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": cb.Cosmetic.ID},
+		cb.Update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&cb.Cosmetic); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrInvalidRequest().SetDetail("Cosmetic not found")
+		}
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Write audit log
+	changes := []*structures.AuditLogChange{}
+	if init.Name != cb.Cosmetic.Name {
+		changes = append(changes, (&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "name",
+		}).WriteSingleValues(init.Name, cb.Cosmetic.Name))
+	}
+	if init.Priority != cb.Cosmetic.Priority {
+		changes = append(changes, (&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "priority",
+		}).WriteSingleValues(init.Priority, cb.Cosmetic.Priority))
+	}
+	if !bsonEqual(init.Data, cb.Cosmetic.Data) {
+		changes = append(changes, (&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "data",
+		}).WriteSingleValues(init.Data, cb.Cosmetic.Data))
+	}
+	m.logCosmetic(ctx, structures.AuditLogKindUpdateCosmetic, opt, cb.Cosmetic.ID, changes...)
+
+	cb.MarkAsTainted()
+	return nil
+}
+
+// DeleteCosmetic: delete a badge or paint, and revoke it from every user
+func (m *Mutate) DeleteCosmetic(ctx context.Context, cb *structures.CosmeticBuilder[bson.Raw], opt CosmeticMutationOptions) error {
+	if cb == nil || cb.Cosmetic.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if cb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkCosmeticPermission(opt.Actor); err != nil {
+		return err
+	}
+
+	res, err := m.mongo.Collection(mongo.CollectionNameCosmetics).DeleteOne(ctx, bson.M{"_id": cb.Cosmetic.ID})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.DeletedCount == 0 {
+		return errors.ErrInvalidRequest().SetDetail("Cosmetic not found")
+	}
+
+	// Remove the entitlements to the cosmetic
+	if _, err = m.mongo.Collection(mongo.CollectionNameEntitlements).DeleteMany(ctx, bson.M{
+		"kind":     bson.M{"$in": bson.A{structures.EntitlementKindBadge, structures.EntitlementKindPaint}},
+		"data.ref": cb.Cosmetic.ID,
+	}); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	m.logCosmetic(ctx, structures.AuditLogKindDeleteCosmetic, opt, cb.Cosmetic.ID,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "name",
+		}).WriteSingleValues(cb.Cosmetic.Name, nil),
+	)
+
+	cb.MarkAsTainted()
+	return nil
+}
+
+type CosmeticMutationOptions struct {
+	// The user performing the mutation. If nil, the mutation is done by the system
+	Actor  *structures.User
+	Reason string
+}
+
+// checkCosmeticPermission checks that the actor may manage cosmetics
+func checkCosmeticPermission(actor *structures.User) error {
+	if actor != nil && !actor.HasPermission(structures.RolePermissionManageCosmetics) {
+		return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_COSMETICS",
+		})
+	}
+	return nil
+}
+
+// validateCosmetic validates the data of a cosmetic against its kind
+func validateCosmetic(c structures.Cosmetic[bson.Raw]) error {
+	switch c.Kind {
+	case structures.CosmeticKindBadge:
+		badge, err := structures.ConvertCosmetic[structures.CosmeticDataBadge](c)
+		if err != nil {
+			return errors.ErrValidationRejected().SetDetail(err.Error())
+		}
+		return badge.Data.Validator().Validate()
+	case structures.CosmeticKindNametagPaint:
+		paint, err := structures.ConvertCosmetic[structures.CosmeticDataPaint](c)
+		if err != nil {
+			return errors.ErrValidationRejected().SetDetail(err.Error())
+		}
+		return paint.Data.Validator().Validate()
+	}
+	return errors.ErrValidationRejected().SetDetail("Unknown cosmetic kind '%s'", c.Kind)
+}
+
+// logCosmetic writes an audit log entry for a change to a cosmetic
+func (m *Mutate) logCosmetic(
+	ctx context.Context,
+	kind structures.AuditLogKind,
+	opt CosmeticMutationOptions,
+	id primitive.ObjectID,
+	changes ...*structures.AuditLogChange,
+) {
+	alb := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+		SetKind(kind).
+		SetActor(actorIDOf(opt.Actor)).
+		SetTargetKind(structures.ObjectKindCosmetic).
+		SetTargetID(id).
+		AddChanges(changes...)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, alb.AuditLog); err != nil {
+		zap.S().Errorw("mongo, failed to write audit log entry for cosmetic",
+			"error", err,
+			"cosmetic_id", id.Hex(),
+		)
+	}
+}
+
+func bsonEqual(a, b bson.Raw) bool {
+	return string(a) == string(b)
+}
@@ -0,0 +1,319 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/redis"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	EMOTE_CHANNEL_COUNT_BATCH_SIZE = 1000
+	EMOTE_CHANNEL_COUNT_INTERVAL   = time.Hour * 6
+	// How many writes are sent to the database at once
+	EMOTE_CHANNEL_COUNT_WRITE_SIZE = 500
+)
+
+// UpdateEmoteChannelCounts: count how many channels have each emote version active
+// and rank the versions by that count
+//
+// This is meant to be run periodically by a cron job. Only versions whose count was last checked
+// longer than the specified interval ago are recounted, so each run processes a single batch
+func (m *Mutate) UpdateEmoteChannelCounts(ctx context.Context, opt EmoteChannelCountOptions) (*EmoteChannelCountResult, error) {
+	batchSize := utils.Ternary(opt.BatchSize > 0, opt.BatchSize, EMOTE_CHANNEL_COUNT_BATCH_SIZE)
+	interval := utils.Ternary(opt.Interval > 0, opt.Interval, EMOTE_CHANNEL_COUNT_INTERVAL)
+	now := time.Now()
+	result := &EmoteChannelCountResult{}
+
+	// Find the versions that are due for a recount
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmotes).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{"versions.id": 1, "versions.state.channel_count": 1, "versions.state.channel_count_check_at": 1}}},
+		{{Key: "$unwind", Value: "$versions"}},
+		{{
+			Key: "$match",
+			Value: bson.M{"$or": bson.A{
+				bson.M{"versions.state.channel_count_check_at": bson.M{"$lt": now.Add(-interval)}},
+				bson.M{"versions.state.channel_count_check_at": bson.M{"$exists": false}},
+			}},
+		}},
+		{{Key: "$sort", Value: bson.M{"versions.state.channel_count_check_at": 1}}},
+		{{Key: "$limit", Value: batchSize}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": bson.M{
+			"_id":   "$versions.id",
+			"count": bson.M{"$ifNull": bson.A{"$versions.state.channel_count", 0}},
+		}}}},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	due := []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int32              `bson:"count"`
+	}{}
+	if err = cur.All(ctx, &due); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	versionIDs := make([]primitive.ObjectID, len(due))
+	for i, v := range due {
+		versionIDs[i] = v.ID
+	}
+
+	// The range of counts in which ranks may have changed
+	rankFrom, rankTo := int32(math.MaxInt32), int32(-1)
+	if opt.FullRanking {
+		rankFrom, rankTo = 0, math.MaxInt32
+	}
+
+	if len(versionIDs) > 0 {
+		counts, err := m.aggregateEmoteChannelCounts(ctx, versionIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range due {
+			n := counts[v.ID]
+			if n == v.Count {
+				continue
+			}
+
+			lo, hi := utils.Ternary(n < v.Count, n, v.Count), utils.Ternary(n < v.Count, v.Count, n)
+			if lo < rankFrom {
+				rankFrom = lo
+			}
+			if hi > rankTo {
+				rankTo = hi
+			}
+		}
+
+		// Write the counts. Versions which aren't active anywhere are reset to zero
+		w := make([]mongo.WriteModel, len(versionIDs))
+		for i, id := range versionIDs {
+			w[i] = &mongo.UpdateOneModel{
+				Filter: bson.M{"versions.id": id},
+				Update: bson.M{"$set": bson.M{
+					"versions.$.state.channel_count":          counts[id],
+					"versions.$.state.channel_count_check_at": now,
+				}},
+			}
+		}
+		if err = m.bulkWriteEmotes(ctx, w); err != nil {
+			return nil, err
+		}
+		result.Checked = len(versionIDs)
+
+		// Invalidate the cached channel counts
+		keys := make([]redis.Key, len(versionIDs))
+		for i, id := range versionIDs {
+			keys[i] = m.redis.ComposeKey("gql-v3", fmt.Sprintf("emote:%s:channel_count", id.Hex()))
+		}
+		if _, err = m.redis.Del(ctx, keys...); err != nil {
+			zap.S().Errorw("redis, failed to invalidate emote channel counts",
+				"error", err,
+			)
+		}
+	}
+
+	if opt.SkipRanking || rankTo < rankFrom {
+		return result, nil
+	}
+
+	// Rank the versions whose rank may have changed
+	ranked, err := m.rankEmoteChannelCounts(ctx, rankFrom, rankTo)
+	if err != nil {
+		return result, err
+	}
+	result.Ranked = ranked
+
+	return result, nil
+}
+
+type EmoteChannelCountOptions struct {
+	// The maximum amount of versions to recount in this run
+	BatchSize int
+	// The minimum time between two counts of the same version
+	Interval time.Duration
+	// If true, ChannelCountRank will not be recalculated
+	SkipRanking bool
+	// If true, every version is ranked, rather than only those whose rank may have changed with the new counts.
+	// This must be used once to rank versions which were never ranked before
+	FullRanking bool
+}
+
+type EmoteChannelCountResult struct {
+	// The amount of versions which were recounted
+	Checked int `json:"checked"`
+	// The amount of versions whose rank changed
+	Ranked int `json:"ranked"`
+}
+
+// aggregateEmoteChannelCounts returns the amount of distinct users with the specified versions
+// active in an emote set bound to one of their connections
+func (m *Mutate) aggregateEmoteChannelCounts(ctx context.Context, versionIDs []primitive.ObjectID) (map[primitive.ObjectID]int32, error) {
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmoteSets).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"emotes.id": bson.M{"$in": versionIDs}}}},
+		{{Key: "$project", Value: bson.M{"emotes.id": 1}}},
+		{{
+			Key: "$lookup",
+			Value: mongo.Lookup{
+				From:         mongo.CollectionNameUsers,
+				LocalField:   "_id",
+				ForeignField: "connections.emote_set_id",
+				As:           "channels",
+			},
+		}},
+		{{Key: "$project", Value: bson.M{"emotes": "$emotes.id", "channels": "$channels._id"}}},
+		{{Key: "$unwind", Value: "$emotes"}},
+		{{Key: "$match", Value: bson.M{"emotes": bson.M{"$in": versionIDs}}}},
+		{{Key: "$unwind", Value: "$channels"}},
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id":      "$emotes",
+				"channels": bson.M{"$addToSet": "$channels"},
+			},
+		}},
+		{{Key: "$project", Value: bson.M{"count": bson.M{"$size": "$channels"}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	v := []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int32              `bson:"count"`
+	}{}
+	if err = cur.All(ctx, &v); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	counts := make(map[primitive.ObjectID]int32, len(v))
+	for _, c := range v {
+		counts[c.ID] = c.Count
+	}
+	return counts, nil
+}
+
+// rankEmoteChannelCounts sets the rank of the versions with a channel count within the range,
+// only writing the versions whose rank changed
+//
+// A version's rank is one more than the amount of versions with a higher count. When counts only changed
+// within the range, the ranks of versions outside of it stay the same, so they are not read
+func (m *Mutate) rankEmoteChannelCounts(ctx context.Context, from, to int32) (int, error) {
+	// versions returns a pipeline over all versions with their count, followed by the stages
+	versions := func(stages ...bson.D) mongo.Pipeline {
+		return append(mongo.Pipeline{
+			{{Key: "$project", Value: bson.M{"versions.id": 1, "versions.state": 1}}},
+			{{Key: "$unwind", Value: "$versions"}},
+			{{Key: "$set", Value: bson.M{"count": bson.M{"$ifNull": bson.A{"$versions.state.channel_count", 0}}}}},
+		}, stages...)
+	}
+
+	// The amount of versions ranked above the range
+	above := int32(0)
+	if to < math.MaxInt32 {
+		cur, err := m.mongo.Collection(mongo.CollectionNameEmotes).Aggregate(ctx, versions(
+			bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": to}}}},
+			bson.D{{Key: "$count", Value: "n"}},
+		), options.Aggregate().SetAllowDiskUse(true))
+		if err != nil {
+			return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		v := []struct {
+			N int32 `bson:"n"`
+		}{}
+		if err = cur.All(ctx, &v); err != nil {
+			return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if len(v) > 0 {
+			above = v[0].N
+		}
+	}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmotes).Aggregate(ctx, versions(
+		bson.D{{Key: "$match", Value: bson.M{"count": bson.M{"$gte": from, "$lte": to}}}},
+		bson.D{{Key: "$sort", Value: bson.M{"count": -1}}},
+		bson.D{{Key: "$project", Value: bson.M{
+			"_id":   "$versions.id",
+			"count": 1,
+			"rank":  bson.M{"$ifNull": bson.A{"$versions.state.channel_count_rank", 0}},
+		}}},
+	), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	defer cur.Close(ctx)
+
+	ranked := 0
+	w := []mongo.WriteModel{}
+	rank, position, prevCount := above, above, int32(-1)
+	for cur.Next(ctx) {
+		v := struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int32              `bson:"count"`
+			Rank  int32              `bson:"rank"`
+		}{}
+		if err = cur.Decode(&v); err != nil {
+			zap.S().Errorw("mongo, failed to decode emote channel count rank",
+				"error", err,
+			)
+			continue
+		}
+
+		// Versions with the same count share their rank
+		position++
+		if v.Count != prevCount {
+			rank, prevCount = position, v.Count
+		}
+		if v.Rank == rank {
+			continue
+		}
+
+		w = append(w, &mongo.UpdateOneModel{
+			Filter: bson.M{"versions.id": v.ID},
+			Update: bson.M{"$set": bson.M{"versions.$.state.channel_count_rank": rank}},
+		})
+		if len(w) >= EMOTE_CHANNEL_COUNT_WRITE_SIZE {
+			if err = m.bulkWriteEmotes(ctx, w); err != nil {
+				return ranked, err
+			}
+			ranked += len(w)
+			w = []mongo.WriteModel{}
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return ranked, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if err = m.bulkWriteEmotes(ctx, w); err != nil {
+		return ranked, err
+	}
+	ranked += len(w)
+
+	return ranked, nil
+}
+
+func (m *Mutate) bulkWriteEmotes(ctx context.Context, w []mongo.WriteModel) error {
+	for i := 0; i < len(w); i += EMOTE_CHANNEL_COUNT_WRITE_SIZE {
+		end := i + EMOTE_CHANNEL_COUNT_WRITE_SIZE
+		if end > len(w) {
+			end = len(w)
+		}
+		if _, err := m.mongo.Collection(mongo.CollectionNameEmotes).BulkWrite(ctx, w[i:end], options.BulkWrite().SetOrdered(false)); err != nil {
+			zap.S().Errorw("mongo, failed to write emote channel counts",
+				"error", err,
+			)
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package mutations
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// SuggestEmoteFlags: suggest content flags for an emote to the moderators
+//
+// The suggestion is sent as a mod request message, which remains in the queue until resolved
+func (m *Mutate) SuggestEmoteFlags(ctx context.Context, opt EmoteFlagSuggestionOptions) (*structures.Message[structures.MessageDataModRequest], error) {
+	actor := opt.Actor
+	if actor == nil {
+		return nil, errors.ErrUnauthorized()
+	}
+	if opt.Flags == 0 || opt.Flags&^structures.EmoteFlagsContent != 0 {
+		return nil, errors.ErrInvalidRequest().SetDetail("Only content flags can be suggested")
+	}
+
+	// Get the emote
+	emote := structures.Emote{}
+	if err := m.mongo.Collection(mongo.CollectionNameEmotes).FindOne(ctx, bson.M{"versions.id": opt.EmoteID}).Decode(&emote); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.ErrUnknownEmote()
+		}
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if emote.Flags&opt.Flags == opt.Flags {
+		return nil, errors.ErrInvalidRequest().SetDetail("The emote already has these flags")
+	}
+
+	// Check for a pending suggestion by the same user
+	ids, err := m.pendingEmoteFlagSuggestions(ctx, bson.M{
+		"author_id":      actor.ID,
+		"data.target_id": opt.EmoteID,
+		"data.flags":     bson.M{"$bitsAnySet": opt.Flags},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		return nil, errors.ErrInvalidRequest().SetDetail("You have already suggested these flags for this emote")
+	}
+
+	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataModRequest]{}).
+		SetKind(structures.MessageKindModRequest).
+		SetAuthorID(actor.ID).
+		SetTimestamp(time.Now()).
+		SetData(structures.MessageDataModRequest{
+			TargetKind: structures.ObjectKindEmote,
+			TargetID:   opt.EmoteID,
+			Flags:      opt.Flags,
+		})
+	if err := m.SendModRequestMessage(ctx, mb); err != nil {
+		return nil, err
+	}
+
+	return &mb.Message, nil
+}
+
+type EmoteFlagSuggestionOptions struct {
+	Actor *structures.User
+	// The ID of the emote version the flags are suggested for
+	EmoteID primitive.ObjectID
+	Flags   structures.EmoteFlag
+}
+
+// ResolveEmoteFlagSuggestions: apply or dismiss the pending suggestions of content flags for an emote
+//
+// When applied, the flags are added to the emote. In both cases, the flags are removed from
+// the suggestions, and those left without a content flag are marked as read and leave the queue
+func (m *Mutate) ResolveEmoteFlagSuggestions(ctx context.Context, opt EmoteFlagResolutionOptions) (int, error) {
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return 0, errors.ErrInsufficientPrivilege()
+	}
+	if opt.Flags == 0 || opt.Flags&^structures.EmoteFlagsContent != 0 {
+		return 0, errors.ErrInvalidRequest().SetDetail("Only content flags can be resolved")
+	}
+
+	ids, err := m.pendingEmoteFlagSuggestions(ctx, bson.M{
+		"data.target_id": opt.EmoteID,
+		"data.flags":     bson.M{"$bitsAnySet": opt.Flags},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if opt.Apply {
+		emote := structures.Emote{}
+		if err := m.mongo.Collection(mongo.CollectionNameEmotes).FindOne(ctx, bson.M{"versions.id": opt.EmoteID}).Decode(&emote); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return 0, errors.ErrUnknownEmote()
+			}
+			return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		// The edit writes the audit log entry for the flag change
+		if emote.Flags&opt.Flags != opt.Flags {
+			eb := structures.NewEmoteBuilder(emote)
+			eb.SetFlags(emote.Flags | opt.Flags)
+			if err := m.EditEmote(ctx, eb, EmoteEditOptions{Actor: actor}); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Remove the resolved flags, as suggestions may also carry flags which are still pending
+	if _, err := m.mongo.Collection(mongo.CollectionNameMessages).UpdateMany(ctx, bson.M{
+		"_id": bson.M{"$in": ids},
+	}, bson.M{"$bit": bson.M{
+		"data.flags": bson.M{"and": ^opt.Flags},
+	}}); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Remove the suggestions without any flag left from the queue
+	cur, err := m.mongo.Collection(mongo.CollectionNameMessages).Find(ctx, bson.M{
+		"_id":        bson.M{"$in": ids},
+		"data.flags": bson.M{"$bitsAllClear": structures.EmoteFlagsContent},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	resolved := []structures.Message[bson.Raw]{}
+	if err = cur.All(ctx, &resolved); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	closedIDs := make([]primitive.ObjectID, len(resolved))
+	for i, msg := range resolved {
+		closedIDs[i] = msg.ID
+	}
+	if len(closedIDs) > 0 {
+		if _, err := m.mongo.Collection(mongo.CollectionNameMessagesRead).UpdateMany(ctx, bson.M{
+			"message_id": bson.M{"$in": closedIDs},
+		}, bson.M{"$set": bson.M{
+			"read":    true,
+			"read_at": time.Now(),
+		}}); err != nil {
+			return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+	}
+
+	// Applied flags are logged by the edit, dismissals are logged here
+	if !opt.Apply {
+		c := &structures.AuditLogChange{
+			Key:    "flag_suggestions",
+			Format: structures.AuditLogChangeFormatArrayChange,
+		}
+		dismissed := make([]any, len(ids))
+		for i, id := range ids {
+			dismissed[i] = bson.M{"message_id": id, "flags": opt.Flags}
+		}
+		c.WriteArrayRemoved(dismissed...)
+
+		log := structures.NewAuditLogBuilder(structures.AuditLog{}).
+			SetKind(structures.AuditLogKindUpdateEmote).
+			SetActor(actor.ID).
+			SetTargetKind(structures.ObjectKindEmote).
+			SetTargetID(opt.EmoteID).
+			AddChanges(c)
+		if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+			zap.S().Errorw("mongo, failed to write audit log entry for dismissed emote flag suggestions",
+				"error", err,
+				"emote_id", opt.EmoteID.Hex(),
+			)
+		}
+	}
+
+	return len(ids), nil
+}
+
+type EmoteFlagResolutionOptions struct {
+	Actor *structures.User
+	// The ID of the emote version the flags were suggested for
+	EmoteID primitive.ObjectID
+	Flags   structures.EmoteFlag
+	// Whether to add the flags to the emote, or to dismiss the suggestions
+	Apply bool
+}
+
+// pendingEmoteFlagSuggestions returns the IDs of unread flag suggestion messages matching the filter
+func (m *Mutate) pendingEmoteFlagSuggestions(ctx context.Context, filter bson.M) ([]primitive.ObjectID, error) {
+	filter["kind"] = structures.MessageKindModRequest
+	filter["data.target_kind"] = structures.ObjectKindEmote
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameMessages).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	messages := []structures.Message[bson.Raw]{}
+	if err = cur.All(ctx, &messages); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	msgIDs := make([]primitive.ObjectID, len(messages))
+	for i, msg := range messages {
+		msgIDs[i] = msg.ID
+	}
+
+	cur, err = m.mongo.Collection(mongo.CollectionNameMessagesRead).Find(ctx, bson.M{
+		"message_id": bson.M{"$in": msgIDs},
+		"read":       bson.M{"$ne": true},
+	}, options.Find().SetProjection(bson.M{"message_id": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	reads := []structures.MessageRead{}
+	if err = cur.All(ctx, &reads); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	ids := make([]primitive.ObjectID, len(reads))
+	for i, rs := range reads {
+		ids[i] = rs.MessageID
+	}
+	return ids, nil
+}
@@ -3,7 +3,6 @@ package mutations
 import (
 	"context"
 	"strconv"
-	"time"
 
 	"github.com/seventv/common/errors"
 	"github.com/seventv/common/mongo"
@@ -63,6 +62,10 @@ func (m *Mutate) EditEmote(ctx context.Context, eb *structures.EmoteBuilder, opt
 		return errors.ErrUnauthorized()
 	}
 
+	// An ownership transfer requested by the edit, or whether the actor claims ownership
+	var transfer *structures.EmoteOwnershipTransfer
+	claim := false
+
 	// Set up audit logs
 	log := structures.NewAuditLogBuilder(structures.AuditLog{}).
 		SetKind(structures.AuditLogKindUpdateEmote).
@@ -96,67 +99,61 @@ func (m *Mutate) EditEmote(ctx context.Context, eb *structures.EmoteBuilder, opt
 			}
 
 			// If the user is not privileged:
-			// we will add the specified owner_id to list of claimants and send an inbox message
+			// the change is turned into an ownership transfer request
 			switch init.OwnerID == actorID { // original owner is actor?
 			case true: // yes: means emote owner is transferring away
 				if !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
-					if utils.Contains(emote.State.Claimants, emote.OwnerID) { // error if target new owner is already a claimant
-						return errors.ErrInsufficientPrivilege().SetDetail("Target user was already requested to claim ownership of this emote")
-					}
-					if len(emote.State.Claimants) > EMOTE_CLAIMANTS_MOST {
-						return errors.ErrInvalidRequest().SetDetail("Too Many Claimants (%d)", EMOTE_CLAIMANTS_MOST)
-					}
+					recipientID := emote.OwnerID
 
-					// Add to claimants
-					eb.Update.AddToSet("state.claimants", emote.OwnerID)
-
-					// Send a message to the claimant's inbox
-					mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
-						SetKind(structures.MessageKindInbox).
-						SetAuthorID(actorID).
-						SetTimestamp(time.Now()).
-						SetData(structures.MessageDataInbox{
-							Subject: "inbox.generic.emote_ownership_claim_request.subject",
-							Content: "inbox.generic.emote_ownership_claim_request.content",
-							Locale:  true,
-							Placeholders: map[string]string{
-								"OWNER_DISPLAY_NAME":  utils.Ternary(emote.Owner.DisplayName != "", emote.Owner.DisplayName, emote.Owner.Username),
-								"EMOTE_VERSION_COUNT": strconv.Itoa(len(emote.Versions)),
-								"EMOTE_NAME":          emote.Name,
-							},
-						})
-					if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
-						Actor:                actor,
-						Recipients:           []primitive.ObjectID{emote.OwnerID},
-						ConsiderBlockedUsers: true,
-					}); err != nil {
-						return err
-					}
 					// Undo owner update
 					eb.Update.UndoSet("owner_id")
 					emote.OwnerID = init.OwnerID
+
+					// The transfer is validated now and written along with the rest of the edit
+					t, err := m.newOwnershipTransfer(ctx, eb, EmoteOwnershipTransferOptions{
+						Actor:     actor,
+						Recipient: &structures.User{ID: recipientID},
+					})
+					if err != nil {
+						return err
+					}
+					eb.AddOwnershipTransfer(t)
+					transfer = &t
 				}
 			case false: // no: a user wants to claim ownership
+				_, ind := emote.GetOwnershipTransfer(actorID)
+				isClaimant := emote.OwnerID == actorID && (ind != -1 || utils.Contains(emote.State.Claimants, actorID))
+
 				// Check if actor is allowed to do that
 				if !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
 					if emote.OwnerID != actorID { //
 						return errors.ErrInsufficientPrivilege().SetDetail("You are not permitted to change this emote's owner")
 					}
-					if !utils.Contains(emote.State.Claimants, emote.OwnerID) {
+					if !isClaimant {
 						return errors.ErrInsufficientPrivilege().SetDetail("You are not allowed to claim ownership of this emote")
 					}
 				}
-				// At this point the actor has successfully claimed ownership of the emote and we clear the list of claimants
-				eb.Update.Set("state.claimants", []primitive.ObjectID{})
+
+				if isClaimant {
+					// The claim is written by AcceptOwnershipTransfer, which logs and notifies it
+					eb.Update.UndoSet("owner_id")
+					emote.OwnerID = init.OwnerID
+					claim = true
+				} else {
+					// A privileged user assigned the emote to someone else: pending transfers are dropped
+					eb.ClearOwnershipTransfers()
+				}
 			}
 
-			// Write as audit change
-			c := structures.AuditLogChange{
-				Key:    "owner_id",
-				Format: structures.AuditLogChangeFormatSingleValue,
+			// Write as audit change, unless the transfer is logged on its own
+			if transfer == nil && !claim {
+				c := structures.AuditLogChange{
+					Key:    "owner_id",
+					Format: structures.AuditLogChangeFormatSingleValue,
+				}
+				c.WriteSingleValues(init.OwnerID, emote.OwnerID)
+				log.AddChanges(&c)
 			}
-			c.WriteSingleValues(init.OwnerID, emote.OwnerID)
-			log.AddChanges(&c)
 		}
 		if init.Flags != emote.Flags {
 			f := emote.Flags
@@ -182,6 +179,35 @@ func (m *Mutate) EditEmote(ctx context.Context, eb *structures.EmoteBuilder, opt
 			c.WriteSingleValues(init.Flags, emote.Flags)
 			log.AddChanges(&c)
 		}
+		// Change: Tags
+		if len(diffEmoteTags(init.Tags, emote.Tags)) > 0 {
+			tags, blocked, err := m.resolveEmoteTags(ctx, emote.Tags)
+			if err != nil {
+				return err
+			}
+
+			// Only added tags are rejected if blocked, so that tags blocked
+			// after being added to the emote don't prevent unrelated edits
+			rejected := []string{}
+			for _, t := range blocked {
+				if utils.Contains(init.Tags, t) {
+					tags = append(tags, t)
+				} else {
+					rejected = append(rejected, t)
+				}
+			}
+			if len(rejected) > 0 {
+				return errors.ErrValidationRejected().SetDetail("Tags not allowed: %s", formatEmoteTags(rejected))
+			}
+			eb.SetTags(tags, true)
+
+			c := structures.AuditLogChange{
+				Key:    "tags",
+				Format: structures.AuditLogChangeFormatSingleValue,
+			}
+			c.WriteSingleValues(init.Tags, emote.Tags)
+			log.AddChanges(&c)
+		}
 		// Change versions
 		for i, ver := range emote.Versions {
 			oldVer := eb.InitialVersions()[i]
@@ -223,8 +249,29 @@ func (m *Mutate) EditEmote(ctx context.Context, eb *structures.EmoteBuilder, opt
 		}
 	}
 
+	// Drop operators left empty by undone changes
+	for op, v := range eb.Update {
+		if fields, ok := v.(bson.M); ok && len(fields) == 0 {
+			delete(eb.Update, op)
+		}
+	}
+
+	// Accept the claim before the rest of the edit is written, so that it isn't partially applied if the claim fails
+	if claim {
+		cb := structures.NewEmoteBuilder(*emote)
+		if err := m.AcceptOwnershipTransfer(ctx, cb, EmoteOwnershipTransferOptions{
+			Actor: actor,
+		}); err != nil {
+			return err
+		}
+		emote.OwnerID = cb.Emote.OwnerID
+		emote.State = cb.Emote.State
+	}
+
 	// Update the emote
 	if len(eb.Update) > 0 {
+		tagDelta := diffEmoteTags(eb.Initial().Tags, emote.Tags)
+
 		if err := m.mongo.Collection(mongo.CollectionNameEmotes).FindOneAndUpdate(
 			ctx,
 			bson.M{"versions.id": emote.ID},
@@ -244,9 +291,21 @@ func (m *Mutate) EditEmote(ctx context.Context, eb *structures.EmoteBuilder, opt
 					"error", err,
 				)
 			}
+
+			// Update the usage counts of changed tags
+			if err := m.adjustEmoteTagCounts(ctx, tagDelta); err != nil {
+				zap.S().Errorw("failed to update emote tag usage counts",
+					"error", err,
+				)
+			}
 		}()
 	}
 
+	if transfer != nil {
+		m.logOwnershipTransfer(ctx, structures.AuditLogKindRequestEmoteOwnershipTransfer, actorID, emote, *transfer)
+		m.notifyOwnershipTransfer(ctx, actor, emote, *transfer, "request")
+	}
+
 	eb.MarkAsTainted()
 	return nil
 }
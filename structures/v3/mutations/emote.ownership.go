@@ -0,0 +1,384 @@
+package mutations
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// The default duration after which a pending ownership transfer expires
+const EMOTE_OWNERSHIP_TRANSFER_EXPIRY = time.Hour * 24 * 7
+
+// RequestOwnershipTransfer: offer the ownership of an emote to another user
+//
+// The recipient must accept the transfer with AcceptOwnershipTransfer before it expires
+func (m *Mutate) RequestOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, opt EmoteOwnershipTransferOptions) error {
+	if eb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	transfer, err := m.newOwnershipTransfer(ctx, eb, opt)
+	if err != nil {
+		return err
+	}
+
+	actor := opt.Actor
+	emote := &eb.Emote
+	eb.AddOwnershipTransfer(transfer)
+
+	if err := m.writeOwnershipTransfer(ctx, eb, bson.M{"versions.id": emote.ID}); err != nil {
+		return err
+	}
+
+	m.logOwnershipTransfer(ctx, structures.AuditLogKindRequestEmoteOwnershipTransfer, actor.ID, emote, transfer)
+	m.notifyOwnershipTransfer(ctx, actor, emote, transfer, "request")
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+// newOwnershipTransfer: validate a request to transfer the ownership of an emote and return the transfer to add to it
+//
+// Expired transfers are cleared from the emote beforehand, so that they don't count towards the limit
+func (m *Mutate) newOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, opt EmoteOwnershipTransferOptions) (structures.EmoteOwnershipTransfer, error) {
+	if opt.Recipient == nil || opt.Recipient.ID.IsZero() {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrMissingRequiredField().SetDetail("Did not specify a recipient")
+	}
+
+	actor := opt.Actor
+	emote := &eb.Emote
+	recipient := opt.Recipient
+	if actor == nil {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrUnauthorized()
+	}
+	if !canManageOwnedEmote(actor, emote) {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrInsufficientPrivilege().SetDetail("You are not permitted to transfer the ownership of this emote")
+	}
+	if recipient.ID == emote.OwnerID {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrDontBeSilly().SetDetail("Target user already owns this emote")
+	}
+
+	// Clear out expired transfers so they don't count towards the limit
+	expired := []primitive.ObjectID{}
+	active := []structures.EmoteOwnershipTransfer{}
+	for _, t := range emote.State.Transfers {
+		if t.IsExpired() {
+			expired = append(expired, t.RecipientID)
+		} else {
+			active = append(active, t)
+		}
+	}
+	if len(expired) > 0 {
+		if _, err := m.mongo.Collection(mongo.CollectionNameEmotes).UpdateOne(ctx, bson.M{"versions.id": emote.ID}, bson.M{
+			"$pull": bson.M{
+				"state.transfers": bson.M{"recipient_id": bson.M{"$in": expired}},
+				"state.claimants": bson.M{"$in": expired},
+			},
+		}); err != nil {
+			return structures.EmoteOwnershipTransfer{}, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		emote.State.Transfers = active
+	}
+	if t, ind := emote.GetOwnershipTransfer(recipient.ID); ind != -1 && !t.IsExpired() {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrInvalidRequest().SetDetail("Target user was already requested to claim ownership of this emote")
+	}
+	// Legacy claimants without a transfer entry count towards the limit too
+	claimants := len(emote.State.Transfers)
+	for _, id := range emote.State.Claimants {
+		if _, ind := emote.GetOwnershipTransfer(id); ind == -1 && !utils.Contains(expired, id) {
+			claimants++
+		}
+	}
+	if claimants >= EMOTE_CLAIMANTS_MOST {
+		return structures.EmoteOwnershipTransfer{}, errors.ErrInvalidRequest().SetDetail("Too Many Claimants (%d)", EMOTE_CLAIMANTS_MOST)
+	}
+
+	// Verify that the recipient exists
+	if err := m.mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{"_id": recipient.ID}).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return structures.EmoteOwnershipTransfer{}, errors.ErrUnknownUser()
+		}
+		return structures.EmoteOwnershipTransfer{}, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	expiry := utils.Ternary(opt.Expiry > 0, opt.Expiry, EMOTE_OWNERSHIP_TRANSFER_EXPIRY)
+	return structures.EmoteOwnershipTransfer{
+		RecipientID: recipient.ID,
+		RequesterID: actor.ID,
+		CreatedAt:   time.Now(),
+		ExpireAt:    time.Now().Add(expiry),
+	}, nil
+}
+
+// AcceptOwnershipTransfer: the actor accepts a pending transfer and becomes the owner of the emote
+func (m *Mutate) AcceptOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, opt EmoteOwnershipTransferOptions) error {
+	if eb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	emote := &eb.Emote
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	// The filter ensures the transfer was not cancelled in the meantime
+	filter := bson.M{
+		"versions.id":                  emote.ID,
+		"state.transfers.recipient_id": actor.ID,
+	}
+
+	transfer, ind := emote.GetOwnershipTransfer(actor.ID)
+	if ind == -1 {
+		if !utils.Contains(emote.State.Claimants, actor.ID) {
+			return errors.ErrInsufficientPrivilege().SetDetail("You are not allowed to claim ownership of this emote")
+		}
+
+		// Legacy claimants were added without a transfer entry, and never expire
+		transfer = structures.EmoteOwnershipTransfer{
+			RecipientID: actor.ID,
+			RequesterID: emote.OwnerID,
+		}
+		filter = bson.M{
+			"versions.id":     emote.ID,
+			"state.claimants": actor.ID,
+		}
+	}
+	if transfer.IsExpired() {
+		return errors.ErrInvalidRequest().SetDetail("This ownership transfer has expired")
+	}
+
+	// Change the owner and drop all other pending transfers
+	oldOwnerID := emote.OwnerID
+	eb.SetOwnerID(actor.ID)
+	eb.ClearOwnershipTransfers()
+
+	if err := m.writeOwnershipTransfer(ctx, eb, filter); err != nil {
+		return err
+	}
+
+	log := structures.NewAuditLogBuilder(structures.AuditLog{}).
+		SetKind(structures.AuditLogKindAcceptEmoteOwnershipTransfer).
+		SetActor(actor.ID).
+		SetTargetKind(structures.ObjectKindEmote).
+		SetTargetID(emote.ID)
+	c := structures.AuditLogChange{
+		Key:    "owner_id",
+		Format: structures.AuditLogChangeFormatSingleValue,
+	}
+	c.WriteSingleValues(oldOwnerID, actor.ID)
+	log.AddChanges(&c)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+
+	m.notifyOwnershipTransfer(ctx, actor, emote, transfer, "accept")
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+// DeclineOwnershipTransfer: the actor declines a pending transfer offered to them
+func (m *Mutate) DeclineOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, opt EmoteOwnershipTransferOptions) error {
+	if eb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	emote := &eb.Emote
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	transfer, ind := emote.GetOwnershipTransfer(actor.ID)
+	if ind == -1 {
+		return errors.ErrInvalidRequest().SetDetail("There is no pending ownership transfer for you on this emote")
+	}
+
+	eb.RemoveOwnershipTransfer(actor.ID)
+	if err := m.writeOwnershipTransfer(ctx, eb, bson.M{"versions.id": emote.ID}); err != nil {
+		return err
+	}
+
+	m.logOwnershipTransfer(ctx, structures.AuditLogKindDeclineEmoteOwnershipTransfer, actor.ID, emote, transfer)
+	m.notifyOwnershipTransfer(ctx, actor, emote, transfer, "decline")
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+// CancelOwnershipTransfer: withdraw a pending transfer before the recipient has accepted it
+func (m *Mutate) CancelOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, opt EmoteOwnershipTransferOptions) error {
+	if eb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if opt.Recipient == nil || opt.Recipient.ID.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a recipient")
+	}
+
+	actor := opt.Actor
+	emote := &eb.Emote
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	transfer, ind := emote.GetOwnershipTransfer(opt.Recipient.ID)
+	if ind == -1 {
+		return errors.ErrInvalidRequest().SetDetail("There is no pending ownership transfer for this user")
+	}
+	// The requester may always cancel their own request
+	if transfer.RequesterID != actor.ID && !canManageOwnedEmote(actor, emote) {
+		return errors.ErrInsufficientPrivilege().SetDetail("You are not permitted to cancel this ownership transfer")
+	}
+
+	eb.RemoveOwnershipTransfer(opt.Recipient.ID)
+	if err := m.writeOwnershipTransfer(ctx, eb, bson.M{"versions.id": emote.ID}); err != nil {
+		return err
+	}
+
+	m.logOwnershipTransfer(ctx, structures.AuditLogKindCancelEmoteOwnershipTransfer, actor.ID, emote, transfer)
+	m.notifyOwnershipTransfer(ctx, actor, emote, transfer, "cancel")
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+type EmoteOwnershipTransferOptions struct {
+	Actor *structures.User
+	// The user who is offered ownership of the emote
+	Recipient *structures.User
+	// How long the transfer stays valid for. Defaults to EMOTE_OWNERSHIP_TRANSFER_EXPIRY
+	Expiry time.Duration
+}
+
+func (m *Mutate) writeOwnershipTransfer(ctx context.Context, eb *structures.EmoteBuilder, filter bson.M) error {
+	if err := m.mongo.Collection(mongo.CollectionNameEmotes).FindOneAndUpdate(
+		ctx,
+		filter,
+		eb.Update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&eb.Emote); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrUnknownEmote()
+		}
+		zap.S().Errorw("mongo, couldn't update emote ownership transfers",
+			"error", err,
+			"emote_id", eb.Emote.ID.Hex(),
+		)
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return nil
+}
+
+func (m *Mutate) logOwnershipTransfer(
+	ctx context.Context,
+	kind structures.AuditLogKind,
+	actorID primitive.ObjectID,
+	emote *structures.Emote,
+	transfer structures.EmoteOwnershipTransfer,
+) {
+	c := structures.AuditLogChange{
+		Key:    "transfers",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	switch kind {
+	case structures.AuditLogKindRequestEmoteOwnershipTransfer:
+		c.WriteArrayAdded(transfer)
+	default:
+		c.WriteArrayRemoved(transfer)
+	}
+
+	log := structures.NewAuditLogBuilder(structures.AuditLog{}).
+		SetKind(kind).
+		SetActor(actorID).
+		SetTargetKind(structures.ObjectKindEmote).
+		SetTargetID(emote.ID).
+		AddChanges(&c)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+}
+
+// notifyOwnershipTransfer sends an inbox message about the transfer to both the requester and the recipient
+func (m *Mutate) notifyOwnershipTransfer(
+	ctx context.Context,
+	actor *structures.User,
+	emote *structures.Emote,
+	transfer structures.EmoteOwnershipTransfer,
+	action string,
+) {
+	ownerName := ""
+	if emote.Owner != nil {
+		ownerName = utils.Ternary(emote.Owner.DisplayName != "", emote.Owner.DisplayName, emote.Owner.Username)
+	}
+
+	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+		SetKind(structures.MessageKindInbox).
+		SetAuthorID(actor.ID).
+		SetTimestamp(time.Now()).
+		SetData(structures.MessageDataInbox{
+			Subject: "inbox.generic.emote_ownership_transfer." + action + ".subject",
+			Content: "inbox.generic.emote_ownership_transfer." + action + ".content",
+			Locale:  true,
+			Placeholders: map[string]string{
+				"OWNER_DISPLAY_NAME":  ownerName,
+				"EMOTE_VERSION_COUNT": strconv.Itoa(len(emote.Versions)),
+				"EMOTE_NAME":          emote.Name,
+				"EMOTE_ID":            emote.ID.Hex(),
+				"EXPIRE_AT":           transfer.ExpireAt.Format(time.RFC822),
+			},
+		})
+	if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+		Actor:                actor,
+		Recipients:           []primitive.ObjectID{transfer.RequesterID, transfer.RecipientID},
+		ConsiderBlockedUsers: true,
+	}); err != nil {
+		zap.S().Errorw("failed to send inbox message about emote ownership transfer",
+			"error", err,
+			"action", action,
+			"actor_id", actor.ID.Hex(),
+			"emote_id", emote.ID.Hex(),
+		)
+	}
+}
+
+// canManageOwnedEmote returns whether the actor is the owner of the emote,
+// an editor of the owner with the "manage owned emotes" permission, or privileged
+func canManageOwnedEmote(actor *structures.User, emote *structures.Emote) bool {
+	if actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return true
+	}
+	if emote.OwnerID.IsZero() {
+		return false
+	}
+	if emote.OwnerID == actor.ID {
+		return true
+	}
+	for _, ed := range actor.EditorOf {
+		if ed.ID == emote.OwnerID && ed.HasPermission(structures.UserEditorPermissionManageOwnedEmotes) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,487 @@
+package mutations
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// How many tag usage count writes are sent to the database at once
+const EMOTE_TAG_COUNT_WRITE_SIZE = 500
+
+// RetagEmotes: replace tags on all emotes using them
+//
+// If To is empty, the tags are removed from the emotes without a replacement
+func (m *Mutate) RetagEmotes(ctx context.Context, opt RetagEmotesOptions) (int, error) {
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return 0, errors.ErrInsufficientPrivilege()
+	}
+
+	from := normalizeEmoteTags(opt.From)
+	if len(from) == 0 {
+		return 0, errors.ErrMissingRequiredField().SetDetail("From")
+	}
+
+	to := structures.NormalizeEmoteTag(opt.To)
+	if to != "" {
+		if !structures.IsValidEmoteTag(to) {
+			return 0, errors.ErrValidationRejected().SetDetail("Invalid tag %s", to)
+		}
+		if _, blocked, err := m.resolveEmoteTags(ctx, []string{to}); err != nil {
+			return 0, err
+		} else if len(blocked) > 0 {
+			return 0, errors.ErrValidationRejected().SetDetail("Tag %s is blocked", to)
+		}
+	}
+
+	// Find the emotes using the tags
+	filter := bson.M{}
+	for k, v := range opt.Filter {
+		filter[k] = v
+	}
+	filter["tags"] = bson.M{"$in": from}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmotes).Find(ctx, filter, options.Find().SetProjection(bson.M{"tags": 1}))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	emotes := []structures.Emote{}
+	if err = cur.All(ctx, &emotes); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(emotes) == 0 {
+		return 0, nil
+	}
+
+	w := make([]mongo.WriteModel, len(emotes))
+	logs := make([]interface{}, len(emotes))
+	delta := map[string]int32{}
+	for i, e := range emotes {
+		tags := make([]string, 0, len(e.Tags))
+		for _, t := range e.Tags {
+			if utils.Contains(from, t) {
+				delta[t]--
+				continue
+			}
+			tags = append(tags, t)
+		}
+		if to != "" && !utils.Contains(tags, to) {
+			tags = append(tags, to)
+			delta[to]++
+		}
+
+		w[i] = &mongo.UpdateOneModel{
+			Filter: bson.M{"_id": e.ID},
+			Update: bson.M{"$set": bson.M{"tags": tags}},
+		}
+
+		c := &structures.AuditLogChange{
+			Key:    "tags",
+			Format: structures.AuditLogChangeFormatSingleValue,
+		}
+		c.WriteSingleValues(e.Tags, tags)
+
+		log := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+			SetKind(structures.AuditLogKindUpdateEmote).
+			SetActor(actor.ID).
+			SetTargetKind(structures.ObjectKindEmote).
+			SetTargetID(e.ID).
+			AddChanges(c)
+		logs[i] = log.AuditLog
+	}
+
+	if err = m.bulkWriteEmotes(ctx, w); err != nil {
+		return 0, err
+	}
+
+	if _, err = m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertMany(ctx, logs); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+
+	if err = m.adjustEmoteTagCounts(ctx, delta); err != nil {
+		zap.S().Errorw("failed to update emote tag usage counts",
+			"error", err,
+		)
+	}
+
+	return len(emotes), nil
+}
+
+type RetagEmotesOptions struct {
+	Actor *structures.User
+	// The tags to replace
+	From []string
+	// The tag to replace them with
+	To string
+	// Limits the emotes which are retagged
+	Filter bson.M
+	Reason string
+}
+
+// MergeEmoteTags: merge tags into another tag, making them its synonyms
+//
+// Emotes using the merged tags are retagged with the target tag
+func (m *Mutate) MergeEmoteTags(ctx context.Context, opt MergeEmoteTagsOptions) (*structures.EmoteTag, error) {
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return nil, errors.ErrInsufficientPrivilege()
+	}
+
+	target := structures.NormalizeEmoteTag(opt.Target)
+	if !structures.IsValidEmoteTag(target) {
+		return nil, errors.ErrValidationRejected().SetDetail("Invalid tag %s", target)
+	}
+
+	sources := []string{}
+	for _, t := range normalizeEmoteTags(opt.Sources) {
+		if t != target {
+			sources = append(sources, t)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, errors.ErrMissingRequiredField().SetDetail("Sources")
+	}
+
+	// Synonyms of the merged tags become synonyms of the target
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmoteTags).Find(ctx, bson.M{"name": bson.M{"$in": sources}})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	sourceTags := []structures.EmoteTag{}
+	if err = cur.All(ctx, &sourceTags); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	synonyms := append([]string{}, sources...)
+	for _, t := range sourceTags {
+		for _, s := range t.Synonyms {
+			if s != target && !utils.Contains(synonyms, s) {
+				synonyms = append(synonyms, s)
+			}
+		}
+	}
+
+	if _, blocked, err := m.resolveEmoteTags(ctx, []string{target}); err != nil {
+		return nil, err
+	} else if len(blocked) > 0 {
+		return nil, errors.ErrValidationRejected().SetDetail("Tag %s is blocked", target)
+	}
+
+	tag := &structures.EmoteTag{}
+	if err = m.mongo.Collection(mongo.CollectionNameEmoteTags).FindOneAndUpdate(ctx, bson.M{
+		"name": target,
+	}, bson.M{
+		"$addToSet": bson.M{"synonyms": bson.M{"$each": synonyms}},
+		"$set":      bson.M{"updated_at": time.Now()},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(tag); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Remove the merged tags from the catalog
+	if _, err = m.mongo.Collection(mongo.CollectionNameEmoteTags).DeleteMany(ctx, bson.M{"name": bson.M{"$in": sources}}); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if _, err = m.mongo.Collection(mongo.CollectionNameEmoteTags).UpdateMany(ctx, bson.M{
+		"_id":      bson.M{"$ne": tag.ID},
+		"synonyms": bson.M{"$in": synonyms},
+	}, bson.M{
+		"$pull": bson.M{"synonyms": bson.M{"$in": synonyms}},
+	}); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	c := &structures.AuditLogChange{
+		Key:    "synonyms",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	added := make([]any, len(synonyms))
+	for i, s := range synonyms {
+		added[i] = s
+	}
+	c.WriteArrayAdded(added...)
+
+	log := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+		SetKind(structures.AuditLogKindMergeEmoteTags).
+		SetActor(actor.ID).
+		SetTargetKind(structures.ObjectKindEmoteTag).
+		SetTargetID(tag.ID).
+		AddChanges(c)
+	if _, err = m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+
+	// Retag the emotes using the merged tags
+	if _, err = m.RetagEmotes(ctx, RetagEmotesOptions{
+		Actor:  actor,
+		From:   sources,
+		To:     target,
+		Reason: opt.Reason,
+	}); err != nil {
+		return tag, err
+	}
+
+	return tag, nil
+}
+
+type MergeEmoteTagsOptions struct {
+	Actor *structures.User
+	// The tag to merge into
+	Target string
+	// The tags to merge
+	Sources []string
+	Reason  string
+}
+
+// SetEmoteTagBlocked: add or remove a tag from the blocklist
+//
+// Blocked tags can no longer be added to emotes
+func (m *Mutate) SetEmoteTagBlocked(ctx context.Context, opt EmoteTagBlockOptions) (*structures.EmoteTag, error) {
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return nil, errors.ErrInsufficientPrivilege()
+	}
+
+	name := structures.NormalizeEmoteTag(opt.Tag)
+	if name == "" {
+		return nil, errors.ErrMissingRequiredField().SetDetail("Tag")
+	}
+
+	tag := &structures.EmoteTag{}
+	if err := m.mongo.Collection(mongo.CollectionNameEmoteTags).FindOneAndUpdate(ctx, bson.M{
+		"name": name,
+	}, bson.M{
+		"$set": bson.M{
+			"blocked":        opt.Blocked,
+			"blocked_reason": utils.Ternary(opt.Blocked, opt.Reason, ""),
+			"updated_at":     time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(tag); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	c := &structures.AuditLogChange{
+		Key:    "blocked",
+		Format: structures.AuditLogChangeFormatSingleValue,
+	}
+	c.WriteSingleValues(!opt.Blocked, opt.Blocked)
+
+	log := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+		SetKind(utils.Ternary(opt.Blocked, structures.AuditLogKindBlockEmoteTag, structures.AuditLogKindUnblockEmoteTag)).
+		SetActor(actor.ID).
+		SetTargetKind(structures.ObjectKindEmoteTag).
+		SetTargetID(tag.ID).
+		AddChanges(c)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+
+	// Remove the tag and its synonyms from all emotes
+	if opt.Blocked && opt.Purge {
+		if _, err := m.RetagEmotes(ctx, RetagEmotesOptions{
+			Actor:  actor,
+			From:   append([]string{tag.Name}, tag.Synonyms...),
+			Reason: opt.Reason,
+		}); err != nil {
+			return tag, err
+		}
+	}
+
+	return tag, nil
+}
+
+type EmoteTagBlockOptions struct {
+	Actor   *structures.User
+	Tag     string
+	Blocked bool
+	Reason  string
+	// If true, blocking the tag also removes it from all emotes
+	Purge bool
+}
+
+// resolveEmoteTags maps synonyms to their canonical tag,
+// and returns the tags which are blocked separately
+func (m *Mutate) resolveEmoteTags(ctx context.Context, tags []string) ([]string, []string, error) {
+	if len(tags) == 0 {
+		return tags, nil, nil
+	}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmoteTags).Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"name": bson.M{"$in": tags}},
+		bson.M{"synonyms": bson.M{"$in": tags}},
+	}})
+	if err != nil {
+		return nil, nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	catalog := []structures.EmoteTag{}
+	if err = cur.All(ctx, &catalog); err != nil {
+		return nil, nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	tagMap := make(map[string]structures.EmoteTag, len(catalog))
+	for _, t := range catalog {
+		for _, s := range t.Synonyms {
+			tagMap[s] = t
+		}
+	}
+	for _, t := range catalog {
+		tagMap[t.Name] = t
+	}
+
+	resolved := []string{}
+	blocked := []string{}
+	for _, t := range tags {
+		name := t
+		if ct, ok := tagMap[t]; ok {
+			if ct.Blocked {
+				blocked = append(blocked, t)
+				continue
+			}
+			name = ct.Name
+		}
+		if !utils.Contains(resolved, name) {
+			resolved = append(resolved, name)
+		}
+	}
+
+	return resolved, blocked, nil
+}
+
+// adjustEmoteTagCounts changes the usage counts of tags,
+// adding the tags which are not yet in the catalog
+func (m *Mutate) adjustEmoteTagCounts(ctx context.Context, delta map[string]int32) error {
+	w := []mongo.WriteModel{}
+	for t, d := range delta {
+		if d == 0 {
+			continue
+		}
+		w = append(w, &mongo.UpdateOneModel{
+			Filter: bson.M{"name": t},
+			Update: bson.M{
+				"$inc":         bson.M{"usage_count": d},
+				"$setOnInsert": bson.M{"synonyms": []string{}, "blocked": false},
+			},
+			Upsert: utils.PointerOf(d > 0),
+		})
+	}
+	if len(w) == 0 {
+		return nil
+	}
+
+	_, err := m.mongo.Collection(mongo.CollectionNameEmoteTags).BulkWrite(ctx, w, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// RecountEmoteTags: rebuild the usage counts of the tag catalog from the tags of all emotes
+//
+// Usage counts are otherwise only adjusted by the changes made to emotes, so this is meant to be run
+// once to seed the catalog, and periodically by a cron job to correct drift from failed writes.
+// Returns the amount of tags whose count was written
+func (m *Mutate) RecountEmoteTags(ctx context.Context) (int, error) {
+	cur, err := m.mongo.Collection(mongo.CollectionNameEmotes).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.M{"tags": 1}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	counts := []struct {
+		Tag   string `bson:"_id"`
+		Count int32  `bson:"count"`
+	}{}
+	if err = cur.All(ctx, &counts); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	now := time.Now()
+	names := make([]string, 0, len(counts))
+	w := make([]mongo.WriteModel, 0, len(counts)+1)
+	for _, c := range counts {
+		if c.Tag == "" {
+			continue
+		}
+		names = append(names, c.Tag)
+		w = append(w, &mongo.UpdateOneModel{
+			Filter: bson.M{"name": c.Tag},
+			Update: bson.M{
+				"$set":         bson.M{"usage_count": c.Count},
+				"$setOnInsert": bson.M{"synonyms": []string{}, "blocked": false},
+			},
+			Upsert: utils.PointerOf(true),
+		})
+	}
+
+	// Tags no longer used by any emote
+	w = append(w, &mongo.UpdateManyModel{
+		Filter: bson.M{"name": bson.M{"$nin": names}, "usage_count": bson.M{"$ne": 0}},
+		Update: bson.M{"$set": bson.M{"usage_count": 0}},
+	})
+
+	for i := 0; i < len(w); i += EMOTE_TAG_COUNT_WRITE_SIZE {
+		end := i + EMOTE_TAG_COUNT_WRITE_SIZE
+		if end > len(w) {
+			end = len(w)
+		}
+		if _, err := m.mongo.Collection(mongo.CollectionNameEmoteTags).BulkWrite(ctx, w[i:end], options.BulkWrite().SetOrdered(false)); err != nil {
+			zap.S().Errorw("mongo, failed to write emote tag usage counts",
+				"error", err,
+			)
+			return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+	}
+
+	zap.S().Infow("recounted emote tag usage",
+		"tags", len(names),
+		"duration", time.Since(now),
+	)
+
+	return len(names), nil
+}
+
+// diffEmoteTags returns the tags which were added and removed between two lists of tags
+func diffEmoteTags(old []string, new []string) map[string]int32 {
+	delta := map[string]int32{}
+	for _, t := range old {
+		if !utils.Contains(new, t) {
+			delta[t]--
+		}
+	}
+	for _, t := range new {
+		if !utils.Contains(old, t) {
+			delta[t]++
+		}
+	}
+	return delta
+}
+
+func normalizeEmoteTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		t = structures.NormalizeEmoteTag(t)
+		if t != "" && !utils.Contains(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// formatEmoteTags joins tags for use in error details
+func formatEmoteTags(tags []string) string {
+	return strings.Join(tags, ", ")
+}
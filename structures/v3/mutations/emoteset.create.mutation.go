@@ -65,7 +65,28 @@ func (m *Mutate) EditEmoteSet(ctx context.Context, esb *structures.EmoteSetBuild
 		return errors.ErrInsufficientPrivilege().SetDetail("emote set is privileged")
 	}
 	if actor.ID != set.OwnerID && !actor.HasPermission(structures.RolePermissionEditAnyEmoteSet) {
-		return errors.ErrInsufficientPrivilege().SetDetail("you do not own this emote set")
+		// Editors of the owner may manage the set if it is within their scope
+		owner := set.Owner
+		if owner == nil {
+			owner = &structures.User{}
+			if err := m.mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{"_id": set.OwnerID}).Decode(owner); err != nil {
+				if err == mongo.ErrNoDocuments {
+					return errors.ErrUnknownUser().SetDetail("emote set owner")
+				}
+				return errors.ErrInternalServerError().SetDetail(err.Error())
+			}
+		}
+
+		ed, ok, _ := owner.GetEditor(actor.ID)
+		if !ok {
+			return errors.ErrInsufficientPrivilege().SetDetail("you do not own this emote set")
+		}
+		if !ed.HasEmoteSetPermission(structures.UserEditorPermissionManageEmoteSets, set.ID, owner.Connections) {
+			return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+				"MISSING_EDITOR_PERMISSION": "MANAGE_EMOTE_SETS",
+				"EMOTE_SET_ID":              set.ID.Hex(),
+			})
+		}
 	}
 
 	u := esb.Update
@@ -96,9 +96,10 @@ func (m *Mutate) EditEmotesInSet(ctx context.Context, esb *structures.EmoteSetBu
 				if ed.ID != actor.ID {
 					continue
 				}
-				if !ed.HasPermission(structures.UserEditorPermissionModifyEmotes) {
+				if !ed.HasEmoteSetPermission(structures.UserEditorPermissionModifyEmotes, set.ID, set.Owner.Connections) {
 					return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
 						"MISSING_EDITOR_PERMISSION": "MODIFY_EMOTES",
+						"EMOTE_SET_ID":              set.ID.Hex(),
 					})
 				}
 				break
@@ -106,6 +107,17 @@ func (m *Mutate) EditEmotesInSet(ctx context.Context, esb *structures.EmoteSetBu
 		}
 	}
 
+	// Resolve the emote slot limit, which the set's active connections may lower
+	var slotLimit structures.EmoteSlotLimit
+	if !actor.HasPermission(structures.RolePermissionEditAnyEmoteSet) {
+		limit, err := m.emoteSlotLimit(ctx, set, set.Owner)
+		if err != nil {
+			return err
+		}
+		slotLimit = limit
+	}
+	added := 0
+
 	// Make a map of active set emotes
 	activeEmotes := map[primitive.ObjectID]*structures.Emote{}
 	for _, e := range set.Emotes {
@@ -170,10 +182,8 @@ func (m *Mutate) EditEmotesInSet(ctx context.Context, esb *structures.EmoteSetBu
 
 			// Verify that the set has available slots
 			if !actor.HasPermission(structures.RolePermissionEditAnyEmoteSet) {
-				if len(set.Emotes) >= int(set.EmoteSlots) {
-					return errors.ErrNoSpaceAvailable().
-						SetDetail("This set does not have enough slots").
-						SetFields(errors.Fields{"SLOTS": set.EmoteSlots})
+				if len(set.Emotes)+added >= int(slotLimit.Slots) {
+					return errEmoteSlots(slotLimit, "This set does not have enough slots")
 				}
 			}
 
@@ -192,6 +202,7 @@ func (m *Mutate) EditEmotesInSet(ctx context.Context, esb *structures.EmoteSetBu
 			// Add active emote
 			at := time.Now()
 			esb.AddActiveEmote(tgt.ID, tgt.Name, at, &actor.ID)
+			added++
 			c.WriteArrayAdded(structures.ActiveEmote{
 				ID:        tgt.ID,
 				Name:      tgt.Name,
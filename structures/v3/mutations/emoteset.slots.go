@@ -0,0 +1,118 @@
+package mutations
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// connectionEmoteSlots: resolve the emote slot limits of a user's connections, by connection ID,
+// as well as the slots granted to the user by entitlements
+//
+// Roles granted by entitlements count toward the role defaults, and so do their prerequisites
+func (m *Mutate) connectionEmoteSlots(ctx context.Context, user *structures.User) (map[string]structures.EmoteSlotLimit, int32, error) {
+	cur, err := m.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, bson.M{
+		"user_id":  user.ID,
+		"kind":     bson.M{"$in": []structures.EntitlementKind{structures.EntitlementKindRole, structures.EntitlementKindEmoteSlots}},
+		"disabled": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return nil, 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	ents := []structures.Entitlement[bson.Raw]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return nil, 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	roleEnts := []structures.Entitlement[structures.EntitlementDataRole]{}
+	slotEnts := []structures.Entitlement[structures.EntitlementDataEmoteSlots]{}
+	for _, ent := range ents {
+		switch ent.Kind {
+		case structures.EntitlementKindRole:
+			if e, err := structures.ConvertEntitlement[structures.EntitlementDataRole](ent); err == nil {
+				roleEnts = append(roleEnts, e)
+			}
+		case structures.EntitlementKindEmoteSlots:
+			if e, err := structures.ConvertEntitlement[structures.EntitlementDataEmoteSlots](ent); err == nil {
+				slotEnts = append(slotEnts, e)
+			}
+		}
+	}
+
+	// Resolve the user's roles, including the default role
+	cur, err = m.mongo.Collection(mongo.CollectionNameRoles).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	allRoles := []structures.Role{}
+	if err = cur.All(ctx, &allRoles); err != nil {
+		return nil, 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	roleMap := make(map[primitive.ObjectID]structures.Role, len(allRoles))
+	base := make([]primitive.ObjectID, 0, len(user.RoleIDs)+1)
+	for _, r := range allRoles {
+		roleMap[r.ID] = r
+		if r.Default {
+			base = append(base, r.ID)
+		}
+	}
+	base = append(base, user.RoleIDs...)
+
+	now := time.Now()
+	roles := []structures.Role{}
+	for _, id := range structures.ResolveEntitledRoles(base, roleEnts, now) {
+		if r, ok := roleMap[id]; ok {
+			roles = append(roles, r)
+		}
+	}
+
+	result := make(map[string]structures.EmoteSlotLimit, len(user.Connections))
+	for _, conn := range user.Connections {
+		result[conn.ID] = structures.ResolveConnectionEmoteSlots(conn, roles, slotEnts, now)
+	}
+
+	return result, structures.EmoteSlotBonus(roles, slotEnts, now), nil
+}
+
+// emoteSlotLimit: resolve the effective emote slot limit of a set owned by the user
+func (m *Mutate) emoteSlotLimit(ctx context.Context, set structures.EmoteSet, owner *structures.User) (structures.EmoteSlotLimit, error) {
+	if owner == nil {
+		return structures.ResolveEmoteSlotLimit(set, 0), nil
+	}
+
+	connLimits, bonus, err := m.connectionEmoteSlots(ctx, owner)
+	if err != nil {
+		return structures.EmoteSlotLimit{}, err
+	}
+
+	limits := []structures.EmoteSlotLimit{}
+	for _, conn := range owner.Connections {
+		if conn.EmoteSetID == set.ID {
+			limits = append(limits, connLimits[conn.ID])
+		}
+	}
+
+	return structures.ResolveEmoteSlotLimit(set, bonus, limits...), nil
+}
+
+// errEmoteSlots: the error returned when a set would go over its emote slot limit
+func errEmoteSlots(limit structures.EmoteSlotLimit, detail string) errors.APIError {
+	fields := errors.Fields{
+		"SLOTS":             limit.Slots,
+		"SOURCE":            limit.Source,
+		"ENTITLEMENT_BONUS": limit.Bonus,
+	}
+	if limit.ConnectionID != "" {
+		fields["CONNECTION_ID"] = limit.ConnectionID
+	}
+
+	return errors.ErrNoSpaceAvailable().SetDetail(detail).SetFields(fields)
+}
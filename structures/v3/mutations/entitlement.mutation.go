@@ -0,0 +1,367 @@
+package mutations
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// ENTITLEMENT_APP_MANUAL is the name of the app recorded on entitlements granted by hand
+const ENTITLEMENT_APP_MANUAL = "MANUAL"
+
+// GrantEntitlement: grant an item to a user
+//
+// The referenced item must exist. Granting a role is subject to the same hierarchy as assigning it
+func (m *Mutate) GrantEntitlement(ctx context.Context, eb *structures.EntitlementBuilder[bson.Raw], opt EntitlementMutationOptions) error {
+	if eb == nil {
+		return structures.ErrIncompleteMutation
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkEntitlementPermission(opt.Actor); err != nil {
+		return err
+	}
+
+	ent := eb.Entitlement
+	if ent.Kind == "" {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a kind")
+	}
+	if ent.UserID.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a user")
+	}
+
+	data, err := structures.ConvertEntitlement[structures.EntitlementDataBaseSelectable](ent)
+	if err != nil {
+		return errors.ErrInvalidRequest().SetDetail(err.Error())
+	}
+	if ent.Kind == structures.EntitlementKindEmoteSlots {
+		// Emote slots do not reference an item
+		slots, err := structures.ConvertEntitlement[structures.EntitlementDataEmoteSlots](ent)
+		if err != nil {
+			return errors.ErrInvalidRequest().SetDetail(err.Error())
+		}
+		if slots.Data.Slots <= 0 {
+			return errors.ErrValidationRejected().SetDetail("Emote slot entitlements must grant at least one slot")
+		}
+	} else if err = m.checkEntitlementReference(ctx, opt.Actor, ent.Kind, data.Data.ObjectReference); err != nil {
+		return err
+	}
+
+	// Record the issuing app
+	if opt.App != nil {
+		eb.SetApp(*opt.App)
+	} else if eb.Entitlement.App == nil {
+		eb.SetApp(structures.EntitlementApp{
+			Name:  ENTITLEMENT_APP_MANUAL,
+			State: map[string]any{"actor_id": actorIDOf(opt.Actor)},
+		})
+	}
+
+	// Write
+	eb.Entitlement.ID = primitive.NewObjectID()
+	if _, err = m.mongo.Collection(mongo.CollectionNameEntitlements).InsertOne(ctx, eb.Entitlement); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	if data.Data.Selected && isSelectableEntitlement(ent.Kind) {
+		if err = m.deselectEntitlements(ctx, eb.Entitlement); err != nil {
+			return err
+		}
+	}
+
+	m.logEntitlement(ctx, structures.AuditLogKindCreateEntitlement, opt, eb.Entitlement,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "ref",
+		}).WriteSingleValues(nil, data.Data.ObjectReference),
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "user_id",
+		}).WriteSingleValues(nil, ent.UserID),
+	)
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+// RevokeEntitlement: remove an item granted to a user
+func (m *Mutate) RevokeEntitlement(ctx context.Context, eb *structures.EntitlementBuilder[bson.Raw], opt EntitlementMutationOptions) error {
+	if eb == nil || eb.Entitlement.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkEntitlementPermission(opt.Actor); err != nil {
+		return err
+	}
+
+	data, _ := structures.ConvertEntitlement[structures.EntitlementDataBase](eb.Entitlement)
+	if eb.Entitlement.Kind == structures.EntitlementKindRole {
+		if err := m.checkEntitlementReference(ctx, opt.Actor, eb.Entitlement.Kind, data.Data.ObjectReference); err != nil {
+			return err
+		}
+	}
+
+	res, err := m.mongo.Collection(mongo.CollectionNameEntitlements).DeleteOne(ctx, bson.M{"_id": eb.Entitlement.ID})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.DeletedCount == 0 {
+		return errors.ErrInvalidRequest().SetDetail("Entitlement not found")
+	}
+
+	m.logEntitlement(ctx, structures.AuditLogKindDeleteEntitlement, opt, eb.Entitlement,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "ref",
+		}).WriteSingleValues(data.Data.ObjectReference, nil),
+	)
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+// SetEntitlementDisabled: enable or disable an entitlement without revoking it
+//
+// Set the new state on the builder beforehand with SetDisabled.
+// Toggling a role entitlement within its date window dispatches a user update, as its scheduled transitions do
+func (m *Mutate) SetEntitlementDisabled(ctx context.Context, eb *structures.EntitlementBuilder[bson.Raw], opt EntitlementMutationOptions) error {
+	if eb == nil || eb.Entitlement.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkEntitlementPermission(opt.Actor); err != nil {
+		return err
+	}
+
+	disabled := eb.Entitlement.Disabled
+	if disabled == eb.Initial().Disabled {
+		return nil // nothing to change
+	}
+
+	update := bson.M{"disabled": disabled}
+
+	// A role entitlement within its date window grants or revokes its role right away.
+	// The scheduler's state is saved so it does not dispatch the transition again
+	var (
+		roleEnt    structures.Entitlement[structures.EntitlementDataRole]
+		transition bool
+	)
+	if eb.Entitlement.Kind == structures.EntitlementKindRole {
+		ent, err := structures.ConvertEntitlement[structures.EntitlementDataRole](eb.Entitlement)
+		if err != nil {
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		if ent.Condition.InWindow(time.Now()) {
+			roleEnt, transition = ent, true
+			update["last_active"] = !disabled
+		}
+	}
+
+	if _, err := m.mongo.Collection(mongo.CollectionNameEntitlements).UpdateOne(ctx, bson.M{
+		"_id": eb.Entitlement.ID,
+	}, bson.M{"$set": update}); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	if transition {
+		if err := m.publishRoleEntitlementTransition(ctx, roleEnt, !disabled); err != nil {
+			zap.S().Errorw("failed to publish user update for entitlement transition",
+				"error", err,
+				"entitlement_id", roleEnt.ID.Hex(),
+				"user_id", roleEnt.UserID.Hex(),
+			)
+		}
+	}
+
+	kind := utils.Ternary(disabled, structures.AuditLogKindDisableEntitlement, structures.AuditLogKindEnableEntitlement)
+	m.logEntitlement(ctx, kind, opt, eb.Entitlement,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "disabled",
+		}).WriteSingleValues(eb.Initial().Disabled, disabled),
+	)
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+type EntitlementMutationOptions struct {
+	// The user performing the mutation. If nil, the mutation is done by the system
+	Actor *structures.User
+	// The app issuing the entitlement. Defaults to a manual grant by the actor
+	App    *structures.EntitlementApp
+	Reason string
+}
+
+// SelectEntitlement: make a badge or paint the one displayed by its user
+//
+// Only one item of each kind may be selected, so the user's other items of the kind are deselected
+func (m *Mutate) SelectEntitlement(ctx context.Context, eb *structures.EntitlementBuilder[bson.Raw], opt EntitlementSelectOptions) error {
+	if eb == nil || eb.Entitlement.ID.IsZero() {
+		return structures.ErrIncompleteMutation
+	} else if eb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+	if actor.ID != eb.Entitlement.UserID && !actor.HasPermission(structures.RolePermissionManageCosmetics) {
+		return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_COSMETICS",
+		})
+	}
+	if !isSelectableEntitlement(eb.Entitlement.Kind) {
+		return errors.ErrInvalidRequest().SetDetail("Only badges and paints can be selected")
+	}
+
+	ent := eb.Entitlement
+	if !opt.Deselect && (ent.Disabled || !ent.Condition.InWindow(time.Now())) {
+		return errors.ErrInvalidRequest().SetDetail("This entitlement is not currently active")
+	}
+
+	if !opt.Deselect {
+		if err := m.deselectEntitlements(ctx, ent); err != nil {
+			return err
+		}
+	}
+
+	if _, err := m.mongo.Collection(mongo.CollectionNameEntitlements).UpdateOne(ctx, bson.M{
+		"_id": ent.ID,
+	}, bson.M{"$set": bson.M{"data.selected": !opt.Deselect}}); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	m.logEntitlement(ctx, structures.AuditLogKindSelectEntitlement, EntitlementMutationOptions{Actor: actor}, ent,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "selected",
+		}).WriteSingleValues(opt.Deselect, !opt.Deselect),
+	)
+
+	eb.MarkAsTainted()
+	return nil
+}
+
+type EntitlementSelectOptions struct {
+	Actor *structures.User
+	// Whether to deselect the item rather than select it
+	Deselect bool
+}
+
+// checkEntitlementPermission checks that the actor may manage entitlements
+func checkEntitlementPermission(actor *structures.User) error {
+	if actor != nil && !actor.HasPermission(structures.RolePermissionManageCosmetics) {
+		return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_COSMETICS",
+		})
+	}
+	return nil
+}
+
+// checkEntitlementReference checks that the item referenced by an entitlement exists and may be granted by the actor
+func (m *Mutate) checkEntitlementReference(ctx context.Context, actor *structures.User, kind structures.EntitlementKind, ref primitive.ObjectID) error {
+	if ref.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify the entitled item")
+	}
+
+	var (
+		col    mongo.CollectionName
+		filter = bson.M{"_id": ref}
+	)
+	switch kind {
+	case structures.EntitlementKindRole:
+		role := structures.Role{}
+		if err := m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, filter).Decode(&role); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return errors.ErrUnknownRole()
+			}
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		auth, err := authorizeRoles(actor)
+		if err != nil {
+			return err
+		}
+		return auth.CanManage(role)
+	case structures.EntitlementKindBadge:
+		col = mongo.CollectionNameCosmetics
+		filter["kind"] = structures.CosmeticKindBadge
+	case structures.EntitlementKindPaint:
+		col = mongo.CollectionNameCosmetics
+		filter["kind"] = structures.CosmeticKindNametagPaint
+	case structures.EntitlementKindEmoteSet:
+		col = mongo.CollectionNameEmoteSets
+	case structures.EntitlementKindSubscription: // references an external subscription
+		return nil
+	default:
+		return errors.ErrValidationRejected().SetDetail("Unknown entitlement kind %s", kind)
+	}
+
+	count, err := m.mongo.Collection(col).CountDocuments(ctx, filter)
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if count == 0 {
+		return errors.ErrInvalidRequest().SetDetail("The entitled %s does not exist", strings.ToLower(string(kind)))
+	}
+	return nil
+}
+
+// deselectEntitlements deselects the user's other items of the same kind as the entitlement
+func (m *Mutate) deselectEntitlements(ctx context.Context, ent structures.Entitlement[bson.Raw]) error {
+	if _, err := m.mongo.Collection(mongo.CollectionNameEntitlements).UpdateMany(ctx, bson.M{
+		"_id":           bson.M{"$ne": ent.ID},
+		"user_id":       ent.UserID,
+		"kind":          ent.Kind,
+		"data.selected": true,
+	}, bson.M{"$set": bson.M{"data.selected": false}}); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return nil
+}
+
+// logEntitlement writes an audit log entry for a change to an entitlement
+func (m *Mutate) logEntitlement(
+	ctx context.Context,
+	kind structures.AuditLogKind,
+	opt EntitlementMutationOptions,
+	ent structures.Entitlement[bson.Raw],
+	changes ...*structures.AuditLogChange,
+) {
+	alb := structures.NewAuditLogBuilder(structures.AuditLog{Reason: opt.Reason}).
+		SetKind(kind).
+		SetActor(actorIDOf(opt.Actor)).
+		SetTargetKind(structures.ObjectKindEntitlement).
+		SetTargetID(ent.ID).
+		AddChanges(changes...)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, alb.AuditLog); err != nil {
+		zap.S().Errorw("mongo, failed to write audit log entry for entitlement",
+			"error", err,
+			"entitlement_id", ent.ID.Hex(),
+		)
+	}
+}
+
+func isSelectableEntitlement(kind structures.EntitlementKind) bool {
+	return kind == structures.EntitlementKindBadge || kind == structures.EntitlementKindPaint
+}
+
+func actorIDOf(actor *structures.User) primitive.ObjectID {
+	if actor == nil {
+		return primitive.NilObjectID
+	}
+	return actor.ID
+}
@@ -0,0 +1,167 @@
+package mutations
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/events"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+const ENTITLEMENT_SCHEDULER_INTERVAL = time.Minute
+
+// RunEntitlementScheduler: dispatch user update events when scheduled role grants start or end
+//
+// Each tick, the role entitlements whose date window opened or closed since it was last evaluated are dispatched.
+// The evaluated state is stored on the entitlement, so transitions are not lost across restarts.
+// This blocks until the context is canceled
+func (m *Mutate) RunEntitlementScheduler(ctx context.Context, opt EntitlementSchedulerOptions) {
+	interval := opt.Interval
+	if interval <= 0 {
+		interval = ENTITLEMENT_SCHEDULER_INTERVAL
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	dispatch := func(now time.Time) {
+		count, err := m.DispatchEntitlementTransitions(ctx, now)
+		if err != nil {
+			zap.S().Errorw("failed to dispatch entitlement transitions",
+				"error", err,
+			)
+			return // the unsaved transitions are retried on the next tick
+		}
+		if count > 0 {
+			zap.S().Infow("dispatched entitlement transitions",
+				"count", count,
+			)
+		}
+	}
+
+	dispatch(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			dispatch(now)
+		}
+	}
+}
+
+type EntitlementSchedulerOptions struct {
+	// How often transitions are checked
+	Interval time.Duration
+}
+
+// DispatchEntitlementTransitions: dispatch user update events for the role entitlements
+// whose date window opened or closed since they were last evaluated
+//
+// Entitlements evaluated for the first time only have their state saved.
+// Returns the amount of events dispatched
+func (m *Mutate) DispatchEntitlementTransitions(ctx context.Context, now time.Time) (int, error) {
+	inWindow := bson.A{
+		bson.M{"$or": bson.A{
+			bson.M{"condition.min_date": bson.M{"$exists": false}},
+			bson.M{"condition.min_date": bson.M{"$lte": now}},
+		}},
+		bson.M{"$or": bson.A{
+			bson.M{"condition.max_date": bson.M{"$exists": false}},
+			bson.M{"condition.max_date": bson.M{"$gt": now}},
+		}},
+	}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, bson.M{
+		"kind":     structures.EntitlementKindRole,
+		"disabled": bson.M{"$ne": true},
+		"$or": bson.A{
+			// opened, or not evaluated yet
+			bson.M{
+				"last_active": bson.M{"$ne": true},
+				"$and": append(inWindow, bson.M{"$or": bson.A{
+					bson.M{"condition.min_date": bson.M{"$exists": true}},
+					bson.M{"condition.max_date": bson.M{"$exists": true}},
+				}}),
+			},
+			// closed, or not evaluated yet
+			bson.M{
+				"last_active": bson.M{"$ne": false},
+				"$or": bson.A{
+					bson.M{"condition.min_date": bson.M{"$gt": now}},
+					bson.M{"condition.max_date": bson.M{"$lte": now}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	ents := []structures.Entitlement[structures.EntitlementDataRole]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	count := 0
+	w := []mongo.WriteModel{}
+	for _, ent := range ents {
+		active := ent.Condition.InWindow(now)
+		save := &mongo.UpdateOneModel{
+			Filter: bson.M{"_id": ent.ID},
+			Update: bson.M{"$set": bson.M{"last_active": active}},
+		}
+
+		if ent.LastActive == nil || *ent.LastActive == active {
+			w = append(w, save)
+			continue
+		}
+
+		if err := m.publishRoleEntitlementTransition(ctx, ent, active); err != nil {
+			zap.S().Errorw("failed to publish user update for entitlement transition",
+				"error", err,
+				"entitlement_id", ent.ID.Hex(),
+				"user_id", ent.UserID.Hex(),
+			)
+			continue // the state is not saved, so the transition is retried
+		}
+
+		w = append(w, save)
+		count++
+	}
+
+	if len(w) > 0 {
+		if _, err = m.mongo.Collection(mongo.CollectionNameEntitlements).BulkWrite(ctx, w); err != nil {
+			return count, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+	}
+
+	return count, nil
+}
+
+// publishRoleEntitlementTransition dispatches a user update adding or removing the role granted by the entitlement
+func (m *Mutate) publishRoleEntitlementTransition(ctx context.Context, ent structures.Entitlement[structures.EntitlementDataRole], active bool) error {
+	cm := events.ChangeMap{
+		ID:   ent.UserID,
+		Kind: structures.ObjectKindUser,
+	}
+
+	field := events.ChangeField{Key: "roles"}
+	if active {
+		field.NewValue = ent.Data.ObjectReference
+		cm.Added = []events.ChangeField{field}
+	} else {
+		field.OldValue = ent.Data.ObjectReference
+		cm.Removed = []events.ChangeField{field}
+	}
+
+	msg := events.NewMessage(events.OpcodeDispatch, events.DispatchPayload{
+		Type: events.EventTypeUpdateUser,
+		Body: cm,
+	})
+	return events.Publish(ctx, msg, m.redis)
+}
@@ -0,0 +1,452 @@
+package mutations
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	REPORT_SUBJECT_MAX_LENGTH = 100
+	REPORT_BODY_MAX_LENGTH    = 4000
+	REPORT_NOTE_MAX_LENGTH    = 2000
+
+	// How many reports a user may create within the rate limit window
+	REPORT_RATE_LIMIT        = 5
+	REPORT_RATE_LIMIT_WINDOW = time.Hour
+)
+
+// CreateReport: create a new report. Modify the ReportBuilder beforehand!
+//
+// A user may only have one report open for the same target
+func (m *Mutate) CreateReport(ctx context.Context, rb *structures.ReportBuilder, opt ReportCreateOptions) error {
+	if rb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if rb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionReportCreate) {
+		return errors.ErrInsufficientPrivilege().SetDetail("You are not allowed to create reports")
+	}
+
+	// Validate the report
+	report := rb.Report
+	if report.TargetID.IsZero() || report.TargetKind.CollectionName() == "" {
+		return errors.ErrInvalidRequest().SetDetail("Invalid report target")
+	}
+	if report.Subject == "" || len(report.Subject) > REPORT_SUBJECT_MAX_LENGTH {
+		return errors.ErrValidationRejected().SetDetail("Subject must be between 1 and %d characters", REPORT_SUBJECT_MAX_LENGTH)
+	}
+	if len(report.Body) > REPORT_BODY_MAX_LENGTH {
+		return errors.ErrValidationRejected().SetDetail("Body must be shorter than %d characters", REPORT_BODY_MAX_LENGTH)
+	}
+
+	// Verify that the target exists
+	filter := bson.M{"_id": report.TargetID}
+	if report.TargetKind == structures.ObjectKindEmote {
+		filter = bson.M{"versions.id": report.TargetID}
+	}
+	if err := m.mongo.Collection(mongo.CollectionName(report.TargetKind.CollectionName())).FindOne(ctx, filter).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrInvalidRequest().SetDetail("Target item doesn't exist")
+		}
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Check the rate limit
+	if !actor.HasPermission(structures.RolePermissionManageReports) {
+		count, err := m.mongo.Collection(mongo.CollectionNameReports).CountDocuments(ctx, bson.M{
+			"reporter_id": actor.ID,
+			"created_at":  bson.M{"$gt": time.Now().Add(-REPORT_RATE_LIMIT_WINDOW)},
+		})
+		if err != nil {
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if count >= REPORT_RATE_LIMIT {
+			return errors.ErrRateLimited().SetDetail("You are creating too many reports, try again later")
+		}
+	}
+
+	// Create the report
+	rb.Report.ID = primitive.NewObjectID()
+	rb.SetReporterID(actor.ID).
+		SetStatus(structures.ReportStatusOpen).
+		SetCreatedAt(time.Now())
+	if rb.Report.AssigneeIDs == nil {
+		rb.Report.AssigneeIDs = []primitive.ObjectID{}
+	}
+	if rb.Report.Notes == nil {
+		rb.Report.Notes = []structures.ReportNote{}
+	}
+
+	// Duplicate reports are rejected by the unique index on open reports
+	if _, err := m.mongo.Collection(mongo.CollectionNameReports).InsertOne(ctx, rb.Report); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errors.ErrInvalidRequest().SetDetail("You already have an open report for this target")
+		}
+		zap.S().Errorw("mongo, failed to create report",
+			"error", err,
+		)
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Score the reports on the target, now including this one
+	if err := m.PrioritizeReports(ctx, rb.Report.TargetKind, rb.Report.TargetID); err != nil {
+		zap.S().Errorw("failed to prioritize reports",
+			"error", err,
+			"target_id", rb.Report.TargetID.Hex(),
+		)
+	}
+
+	m.logReport(ctx, actor, &rb.Report, structures.AuditLogKindCreateReport)
+	m.notifyReporter(ctx, actor, &rb.Report, "created", nil)
+
+	rb.MarkAsTainted()
+	return nil
+}
+
+type ReportCreateOptions struct {
+	Actor *structures.User
+}
+
+// AssignReport: add or remove a moderator from the assignees of a report
+func (m *Mutate) AssignReport(ctx context.Context, rb *structures.ReportBuilder, opt ReportAssignOptions) error {
+	if rb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if rb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionManageReports) {
+		return errors.ErrInsufficientPrivilege()
+	}
+	if opt.Assignee == nil {
+		return errors.ErrMissingRequiredField().SetDetail("Assignee")
+	}
+	if rb.Report.Status == structures.ReportStatusClosed {
+		return errors.ErrInvalidRequest().SetDetail("This report is closed")
+	}
+
+	assigned := utils.Contains(rb.Report.AssigneeIDs, opt.Assignee.ID)
+	c := &structures.AuditLogChange{
+		Key:    "assignee_ids",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	if opt.Unassign {
+		if !assigned {
+			return errors.ErrInvalidRequest().SetDetail("This user is not assigned to the report")
+		}
+		rb.RemoveAssignee(opt.Assignee.ID)
+		c.WriteArrayRemoved(opt.Assignee.ID)
+	} else {
+		if assigned {
+			return errors.ErrInvalidRequest().SetDetail("This user is already assigned to the report")
+		}
+		if !opt.Assignee.HasPermission(structures.RolePermissionManageReports) {
+			return errors.ErrInsufficientPrivilege().SetDetail("This user cannot be assigned to reports")
+		}
+		rb.AddAssignee(opt.Assignee.ID)
+		c.WriteArrayAdded(opt.Assignee.ID)
+	}
+
+	// The report is assigned as long as anyone is assigned to it
+	rb.SetStatus(utils.Ternary(len(rb.Report.AssigneeIDs) > 0, structures.ReportStatusAssigned, structures.ReportStatusOpen))
+
+	if err := m.writeReport(ctx, rb); err != nil {
+		return err
+	}
+
+	m.logReport(ctx, actor, &rb.Report, structures.AuditLogKindUpdateReport, c)
+	if !opt.Unassign {
+		m.notifyReporter(ctx, actor, &rb.Report, "assigned", nil)
+	}
+
+	rb.MarkAsTainted()
+	return nil
+}
+
+type ReportAssignOptions struct {
+	Actor    *structures.User
+	Assignee *structures.User
+	// If true, the assignee is removed from the report instead
+	Unassign bool
+}
+
+// AddReportNote: add a moderator note to a report
+//
+// Internal notes are only visible to moderators, and the reporter is not notified of them
+func (m *Mutate) AddReportNote(ctx context.Context, rb *structures.ReportBuilder, opt ReportNoteOptions) (*structures.ReportNote, error) {
+	if rb == nil {
+		return nil, errors.ErrInternalIncompleteMutation()
+	} else if rb.IsTainted() {
+		return nil, errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionManageReports) {
+		return nil, errors.ErrInsufficientPrivilege()
+	}
+	if opt.Content == "" || len(opt.Content) > REPORT_NOTE_MAX_LENGTH {
+		return nil, errors.ErrValidationRejected().SetDetail("Note must be between 1 and %d characters", REPORT_NOTE_MAX_LENGTH)
+	}
+
+	note := structures.ReportNote{
+		ID:        primitive.NewObjectID(),
+		Timestamp: time.Now(),
+		AuthorID:  actor.ID,
+		Content:   opt.Content,
+		Internal:  opt.Internal,
+	}
+	if len(rb.Report.Notes) == 0 {
+		rb.Report.Notes = []structures.ReportNote{note}
+		rb.Update.Set("notes", rb.Report.Notes)
+	} else {
+		rb.AddNote(note)
+	}
+
+	if err := m.writeReport(ctx, rb); err != nil {
+		return nil, err
+	}
+
+	c := &structures.AuditLogChange{
+		Key:    "notes",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	c.WriteArrayAdded(note)
+	m.logReport(ctx, actor, &rb.Report, structures.AuditLogKindUpdateReport, c)
+
+	if !note.Internal {
+		m.notifyReporter(ctx, actor, &rb.Report, "note", map[string]string{
+			"NOTE_CONTENT": note.Content,
+		})
+	}
+
+	rb.MarkAsTainted()
+	return &note, nil
+}
+
+type ReportNoteOptions struct {
+	Actor    *structures.User
+	Content  string
+	Internal bool
+}
+
+// ReplyReportNote: reply to a public note as the reporter
+//
+// The author of the note is notified of the reply
+func (m *Mutate) ReplyReportNote(ctx context.Context, rb *structures.ReportBuilder, opt ReportReplyOptions) error {
+	if rb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if rb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil || actor.ID != rb.Report.ReporterID {
+		return errors.ErrInsufficientPrivilege().SetDetail("Only the reporter can reply to notes")
+	}
+	if rb.Report.Status == structures.ReportStatusClosed {
+		return errors.ErrInvalidRequest().SetDetail("This report is closed")
+	}
+	if opt.Content == "" || len(opt.Content) > REPORT_NOTE_MAX_LENGTH {
+		return errors.ErrValidationRejected().SetDetail("Reply must be between 1 and %d characters", REPORT_NOTE_MAX_LENGTH)
+	}
+
+	if opt.NoteID.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("NoteID")
+	}
+
+	note, ind := rb.Report.GetNote(opt.NoteID)
+	if ind == -1 || note.Internal {
+		return errors.ErrInvalidRequest().SetDetail("Unknown note")
+	}
+	if note.Reply != "" {
+		return errors.ErrInvalidRequest().SetDetail("This note was already replied to")
+	}
+
+	rb.SetNoteReply(note.ID, opt.Content, time.Now())
+	if err := m.writeReport(ctx, rb); err != nil {
+		return err
+	}
+
+	c := &structures.AuditLogChange{
+		Key:    "notes",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	c.WriteArrayUpdated(structures.AuditLogChangeSingleValue{
+		Old:      note,
+		New:      rb.Report.Notes[ind],
+		Position: int32(ind),
+	})
+	m.logReport(ctx, actor, &rb.Report, structures.AuditLogKindUpdateReport, c)
+
+	m.sendReportMessage(ctx, actor, &rb.Report, "reply", []primitive.ObjectID{note.AuthorID}, map[string]string{
+		"REPLY_CONTENT": opt.Content,
+	})
+
+	rb.MarkAsTainted()
+	return nil
+}
+
+type ReportReplyOptions struct {
+	Actor   *structures.User
+	NoteID  primitive.ObjectID
+	Content string
+}
+
+// CloseReport: close a report with a resolution
+func (m *Mutate) CloseReport(ctx context.Context, rb *structures.ReportBuilder, opt ReportCloseOptions) error {
+	if rb == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if rb.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionManageReports) {
+		return errors.ErrInsufficientPrivilege()
+	}
+	if rb.Report.Status == structures.ReportStatusClosed {
+		return errors.ErrInvalidRequest().SetDetail("This report is already closed")
+	}
+	if !opt.Resolution.IsValid() {
+		return errors.ErrInvalidRequest().SetDetail("Invalid resolution")
+	}
+
+	init := rb.Report
+	rb.SetStatus(structures.ReportStatusClosed).
+		SetResolution(opt.Resolution).
+		SetClosedAt(time.Now())
+
+	if err := m.writeReport(ctx, rb); err != nil {
+		return err
+	}
+
+	c := &structures.AuditLogChange{
+		Key:    "status",
+		Format: structures.AuditLogChangeFormatSingleValue,
+	}
+	c.WriteSingleValues(init.Status, rb.Report.Status)
+	rc := &structures.AuditLogChange{
+		Key:    "resolution",
+		Format: structures.AuditLogChangeFormatSingleValue,
+	}
+	rc.WriteSingleValues(init.Resolution, rb.Report.Resolution)
+	m.logReport(ctx, actor, &rb.Report, structures.AuditLogKindCloseReport, c, rc)
+
+	m.notifyReporter(ctx, actor, &rb.Report, "closed", map[string]string{
+		"REPORT_RESOLUTION": string(opt.Resolution),
+	})
+
+	rb.MarkAsTainted()
+	return nil
+}
+
+type ReportCloseOptions struct {
+	Actor      *structures.User
+	Resolution structures.ReportResolution
+}
+
+func (m *Mutate) writeReport(ctx context.Context, rb *structures.ReportBuilder) error {
+	if len(rb.Update) == 0 {
+		return nil
+	}
+
+	if err := m.mongo.Collection(mongo.CollectionNameReports).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": rb.Report.ID},
+		rb.Update,
+	).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrUnknownReport()
+		}
+		zap.S().Errorw("mongo, failed to update report",
+			"error", err,
+			"report_id", rb.Report.ID.Hex(),
+		)
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return nil
+}
+
+func (m *Mutate) logReport(
+	ctx context.Context,
+	actor *structures.User,
+	report *structures.Report,
+	kind structures.AuditLogKind,
+	changes ...*structures.AuditLogChange,
+) {
+	log := structures.NewAuditLogBuilder(structures.AuditLog{}).
+		SetKind(kind).
+		SetActor(actor.ID).
+		SetTargetKind(structures.ObjectKindReport).
+		SetTargetID(report.ID).
+		AddChanges(changes...)
+
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("failed to write audit log",
+			"error", err,
+		)
+	}
+}
+
+// notifyReporter sends an inbox message about the report to the reporter
+func (m *Mutate) notifyReporter(
+	ctx context.Context,
+	actor *structures.User,
+	report *structures.Report,
+	action string,
+	placeholders map[string]string,
+) {
+	m.sendReportMessage(ctx, actor, report, action, []primitive.ObjectID{report.ReporterID}, placeholders)
+}
+
+func (m *Mutate) sendReportMessage(
+	ctx context.Context,
+	actor *structures.User,
+	report *structures.Report,
+	action string,
+	recipients []primitive.ObjectID,
+	placeholders map[string]string,
+) {
+	p := map[string]string{
+		"REPORT_ID":      report.ID.Hex(),
+		"REPORT_SUBJECT": report.Subject,
+	}
+	for k, v := range placeholders {
+		p[k] = v
+	}
+
+	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+		SetKind(structures.MessageKindInbox).
+		SetAuthorID(actor.ID).
+		SetTimestamp(time.Now()).
+		SetData(structures.MessageDataInbox{
+			Subject:      "inbox.generic.report." + action + ".subject",
+			Content:      "inbox.generic.report." + action + ".content",
+			Locale:       true,
+			System:       true,
+			Placeholders: p,
+		})
+	if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+		Actor:      actor,
+		Recipients: recipients,
+	}); err != nil {
+		zap.S().Errorw("failed to send inbox message about report",
+			"error", err,
+			"action", action,
+			"actor_id", actor.ID.Hex(),
+			"report_id", report.ID.Hex(),
+		)
+	}
+}
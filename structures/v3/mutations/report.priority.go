@@ -0,0 +1,396 @@
+package mutations
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	REPORT_ESCALATION_AGE       = time.Hour * 24
+	REPORT_ESCALATION_INCREMENT = 10
+)
+
+// PrioritizeReports: score the open reports on a target and raise their priority accordingly
+//
+// The priority of a report is never lowered, so a priority set by hand is kept if it is higher than the score
+func (m *Mutate) PrioritizeReports(ctx context.Context, targetKind structures.ObjectKind, targetID primitive.ObjectID) error {
+	cur, err := m.mongo.Collection(mongo.CollectionNameReports).Find(ctx, bson.M{
+		"target_id": targetID,
+		"status":    bson.M{"$ne": structures.ReportStatusClosed},
+	})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	reports := []structures.Report{}
+	if err = cur.All(ctx, &reports); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+
+	// Factors shared by all reports on the target
+	reporterIDs := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, r := range reports {
+		if !seen[r.ReporterID] {
+			seen[r.ReporterID] = true
+			reporterIDs = append(reporterIDs, r.ReporterID)
+		}
+	}
+
+	factors := structures.ReportPriorityFactors{
+		Reporters: int32(len(reporterIDs)),
+	}
+
+	ownerID := targetID
+	if targetKind == structures.ObjectKindEmote {
+		emote := structures.Emote{}
+		if err = m.mongo.Collection(mongo.CollectionNameEmotes).FindOne(ctx, bson.M{"versions.id": targetID}).Decode(&emote); err != nil && err != mongo.ErrNoDocuments {
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if ver, ind := emote.GetVersion(targetID); ind != -1 {
+			factors.ChannelCount = ver.State.ChannelCount
+		}
+		ownerID = emote.OwnerID
+	} else if targetKind != structures.ObjectKindUser {
+		ownerID = primitive.NilObjectID
+	}
+
+	if !ownerID.IsZero() {
+		count, err := m.mongo.Collection(mongo.CollectionNameBans).CountDocuments(ctx, bson.M{"victim_id": ownerID})
+		if err != nil {
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		factors.TargetBans = int32(count)
+	}
+
+	accuracy, err := m.reporterAccuracy(ctx, reporterIDs)
+	if err != nil {
+		return err
+	}
+
+	// Raise the priority of each report
+	w := []mongo.WriteModel{}
+	for _, r := range reports {
+		f := factors
+		f.ReporterAccuracy = accuracy[r.ReporterID]
+
+		score := f.Score()
+		if score <= r.Priority {
+			continue
+		}
+
+		w = append(w, &mongo.UpdateOneModel{
+			Filter: bson.M{"_id": r.ID},
+			Update: bson.M{"$set": bson.M{"priority": score}},
+		})
+	}
+	if len(w) == 0 {
+		return nil
+	}
+
+	if _, err = m.mongo.Collection(mongo.CollectionNameReports).BulkWrite(ctx, w, options.BulkWrite().SetOrdered(false)); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return nil
+}
+
+// reporterAccuracy returns the share of each reporter's closed reports which led to action
+//
+// The value is smoothed so that reporters without history are neutral (0.5)
+func (m *Mutate) reporterAccuracy(ctx context.Context, reporterIDs []primitive.ObjectID) (map[primitive.ObjectID]float64, error) {
+	cur, err := m.mongo.Collection(mongo.CollectionNameReports).Aggregate(ctx, mongo.Pipeline{
+		{{
+			Key: "$match",
+			Value: bson.M{
+				"reporter_id": bson.M{"$in": reporterIDs},
+				"status":      structures.ReportStatusClosed,
+			},
+		}},
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id":    "$reporter_id",
+				"closed": bson.M{"$sum": 1},
+				"actioned": bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$resolution", structures.ReportResolutionActionTaken}}, 1, 0},
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	v := []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Closed   int32              `bson:"closed"`
+		Actioned int32              `bson:"actioned"`
+	}{}
+	if err = cur.All(ctx, &v); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	result := make(map[primitive.ObjectID]float64, len(reporterIDs))
+	for _, id := range reporterIDs {
+		result[id] = 0.5
+	}
+	for _, a := range v {
+		result[a.ID] = float64(a.Actioned+1) / float64(a.Closed+2)
+	}
+	return result, nil
+}
+
+// EscalateStaleReports: raise the priority of reports which were left open for too long,
+// and notify the moderators who can manage reports
+//
+// This is meant to be run periodically by a cron job. A report is escalated again
+// each time it stays open for another period
+func (m *Mutate) EscalateStaleReports(ctx context.Context, opt ReportEscalationOptions) (int, error) {
+	actor := opt.Actor
+	if actor == nil {
+		return 0, errors.ErrUnauthorized()
+	}
+
+	age := opt.Age
+	if age <= 0 {
+		age = REPORT_ESCALATION_AGE
+	}
+	increment := opt.Increment
+	if increment <= 0 {
+		increment = REPORT_ESCALATION_INCREMENT
+	}
+
+	now := time.Now()
+	threshold := now.Add(-age)
+	filter := bson.M{
+		"status":     structures.ReportStatusOpen,
+		"created_at": bson.M{"$lt": threshold},
+		"$or": bson.A{
+			bson.M{"escalated_at": bson.M{"$exists": false}},
+			bson.M{"escalated_at": bson.M{"$lt": threshold}},
+		},
+	}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameReports).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "priority": 1}))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	reports := []structures.Report{}
+	if err = cur.All(ctx, &reports); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(reports) == 0 {
+		return 0, nil
+	}
+
+	w := make([]mongo.WriteModel, len(reports))
+	for i, r := range reports {
+		priority := r.Priority + increment
+		if priority > structures.ReportPriorityMax {
+			priority = structures.ReportPriorityMax
+		}
+
+		w[i] = &mongo.UpdateOneModel{
+			Filter: bson.M{"_id": r.ID},
+			Update: bson.M{"$set": bson.M{
+				"priority":     priority,
+				"escalated_at": now,
+			}},
+		}
+	}
+	if _, err = m.mongo.Collection(mongo.CollectionNameReports).BulkWrite(ctx, w, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Notify the moderators
+	moderatorIDs, err := m.usersWithPermission(ctx, structures.RolePermissionManageReports)
+	if err != nil {
+		return len(reports), err
+	}
+	if len(moderatorIDs) > 0 {
+		mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+			SetKind(structures.MessageKindInbox).
+			SetAuthorID(actor.ID).
+			SetTimestamp(now).
+			SetData(structures.MessageDataInbox{
+				Subject:   "inbox.generic.report.escalated.subject",
+				Content:   "inbox.generic.report.escalated.content",
+				Important: true,
+				Locale:    true,
+				System:    true,
+				Placeholders: map[string]string{
+					"REPORT_COUNT": strconv.Itoa(len(reports)),
+					"REPORT_AGE":   age.String(),
+				},
+			})
+		if err = m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+			Actor:      actor,
+			Recipients: moderatorIDs,
+		}); err != nil {
+			zap.S().Errorw("failed to send inbox message about escalated reports",
+				"error", err,
+			)
+		}
+	}
+
+	return len(reports), nil
+}
+
+type ReportEscalationOptions struct {
+	// The user sending the notification to moderators
+	Actor *structures.User
+	// How long a report may stay open before it is escalated
+	Age time.Duration
+	// How much the priority of an escalated report is raised by
+	Increment int32
+}
+
+// usersWithPermission returns the IDs of users whose final permissions include the permission
+//
+// Candidates are users with a role allowing the permission, either directly or through an entitlement.
+// Their permission is then resolved from all of their roles and bans, as it would be for the user
+func (m *Mutate) usersWithPermission(ctx context.Context, permission structures.RolePermission) ([]primitive.ObjectID, error) {
+	cur, err := m.mongo.Collection(mongo.CollectionNameRoles).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	roles := []structures.Role{}
+	if err = cur.All(ctx, &roles); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	roleMap := make(map[primitive.ObjectID]structures.Role, len(roles))
+	defaultRoleIDs := []primitive.ObjectID{}
+	roleIDs := []primitive.ObjectID{}
+	for _, r := range roles {
+		roleMap[r.ID] = r
+		if r.Default {
+			defaultRoleIDs = append(defaultRoleIDs, r.ID)
+		}
+		if r.Allowed&(permission|structures.RolePermissionSuperAdministrator) != 0 {
+			roleIDs = append(roleIDs, r.ID)
+		}
+	}
+	if len(roleIDs) == 0 {
+		return nil, nil
+	}
+
+	// Find the candidates
+	candidates := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+
+	cur, err = m.mongo.Collection(mongo.CollectionNameUsers).Find(ctx, bson.M{
+		"role_ids": bson.M{"$in": roleIDs},
+	}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	users := []structures.User{}
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	for _, u := range users {
+		if !seen[u.ID] {
+			seen[u.ID] = true
+			candidates = append(candidates, u.ID)
+		}
+	}
+
+	cur, err = m.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, bson.M{
+		"kind":     structures.EntitlementKindRole,
+		"data.ref": bson.M{"$in": roleIDs},
+		"disabled": bson.M{"$ne": true},
+	}, options.Find().SetProjection(bson.M{"user_id": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	ents := []structures.Entitlement[bson.Raw]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	for _, e := range ents {
+		if !seen[e.UserID] {
+			seen[e.UserID] = true
+			candidates = append(candidates, e.UserID)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// Resolve the roles and bans of the candidates
+	cur, err = m.mongo.Collection(mongo.CollectionNameUsers).Find(ctx, bson.M{
+		"_id": bson.M{"$in": candidates},
+	}, options.Find().SetProjection(bson.M{"_id": 1, "role_ids": 1}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	users = []structures.User{}
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	cur, err = m.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, bson.M{
+		"user_id":  bson.M{"$in": candidates},
+		"kind":     structures.EntitlementKindRole,
+		"disabled": bson.M{"$ne": true},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	ents = []structures.Entitlement[bson.Raw]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	roleEnts := map[primitive.ObjectID][]structures.Entitlement[structures.EntitlementDataRole]{}
+	for _, e := range ents {
+		if ent, err := structures.ConvertEntitlement[structures.EntitlementDataRole](e); err == nil {
+			roleEnts[e.UserID] = append(roleEnts[e.UserID], ent)
+		}
+	}
+
+	now := time.Now()
+	cur, err = m.mongo.Collection(mongo.CollectionNameBans).Find(ctx, bson.M{"$and": bson.A{
+		bson.M{"victim_id": bson.M{"$in": candidates}},
+		structures.ActiveBanFilter(now),
+	}})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	bans := []structures.Ban{}
+	if err = cur.All(ctx, &bans); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	bansByUser := map[primitive.ObjectID][]structures.Ban{}
+	for _, b := range bans {
+		bansByUser[b.VictimID] = append(bansByUser[b.VictimID], b)
+	}
+
+	userIDs := []primitive.ObjectID{}
+	for _, u := range users {
+		base := append(append([]primitive.ObjectID{}, defaultRoleIDs...), u.RoleIDs...)
+		for _, id := range structures.ResolveEntitledRoles(base, roleEnts[u.ID], now) {
+			if r, ok := roleMap[id]; ok {
+				u.Roles = append(u.Roles, r)
+			}
+		}
+		u.Bans = bansByUser[u.ID]
+
+		if u.HasPermission(permission) {
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+
+	return userIDs, nil
+}
@@ -0,0 +1,86 @@
+package mutations
+
+import (
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/structures/v3"
+)
+
+// roleAuthorization checks an actor's authority over roles
+//
+// An actor may only manage roles positioned below their highest role,
+// and may only grant the permissions they hold themselves
+type roleAuthorization struct {
+	actor       *structures.User
+	highest     structures.Role
+	permissions structures.RolePermission
+}
+
+// authorizeRoles returns the role authorization of an actor, or an error if they cannot manage roles at all
+//
+// A nil actor is a system action, and is allowed everything
+func authorizeRoles(actor *structures.User) (*roleAuthorization, error) {
+	if actor == nil {
+		return &roleAuthorization{}, nil
+	}
+	if !actor.HasPermission(structures.RolePermissionManageRoles) {
+		return nil, errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_ROLES",
+		})
+	}
+
+	return &roleAuthorization{
+		actor:       actor,
+		highest:     actor.GetHighestRole(),
+		permissions: actor.FinalPermission(),
+	}, nil
+}
+
+// CanManage checks that the role is positioned below the actor's highest role
+func (ra *roleAuthorization) CanManage(role structures.Role) error {
+	if ra.actor == nil {
+		return nil
+	}
+	if role.Position >= ra.highest.Position {
+		return errors.ErrInsufficientPrivilege().
+			SetDetail("Role has an equal or higher position than your highest role").
+			SetFields(errors.Fields{
+				"ACTOR_ROLE_POSITION":  ra.highest.Position,
+				"TARGET_ROLE_POSITION": role.Position,
+			})
+	}
+	return nil
+}
+
+// CanSetPosition checks that a role may be moved to the position
+func (ra *roleAuthorization) CanSetPosition(pos int32) error {
+	if ra.actor == nil {
+		return nil
+	}
+	if pos < 0 {
+		return errors.ErrValidationRejected().SetDetail("Role position cannot be negative")
+	}
+	if pos >= ra.highest.Position {
+		return errors.ErrInsufficientPrivilege().
+			SetDetail("Cannot move a role at or above your highest role").
+			SetFields(errors.Fields{
+				"ACTOR_ROLE_POSITION":  ra.highest.Position,
+				"TARGET_ROLE_POSITION": pos,
+			})
+	}
+	return nil
+}
+
+// CanGrant checks that the actor holds every permission bit they grant
+func (ra *roleAuthorization) CanGrant(allowed structures.RolePermission) error {
+	if ra.actor == nil || ra.permissions&structures.RolePermissionSuperAdministrator != 0 {
+		return nil
+	}
+	if missing := allowed &^ ra.permissions; missing != 0 {
+		return errors.ErrInsufficientPrivilege().
+			SetDetail("Cannot grant permissions you do not have").
+			SetFields(errors.Fields{
+				"MISSING_PERMISSIONS": int64(missing),
+			})
+	}
+	return nil
+}
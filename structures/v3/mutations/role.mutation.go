@@ -22,8 +22,15 @@ func (m *Mutate) CreateRole(ctx context.Context, rb *structures.RoleBuilder, opt
 	}
 
 	// Check actor's permissions
-	if opt.Actor != nil && !opt.Actor.HasPermission(structures.RolePermissionManageRoles) {
-		return structures.ErrInsufficientPrivilege
+	auth, err := authorizeRoles(opt.Actor)
+	if err != nil {
+		return err
+	}
+	if err = auth.CanSetPosition(rb.Role.Position); err != nil {
+		return err
+	}
+	if err = auth.CanGrant(rb.Role.Allowed); err != nil {
+		return err
 	}
 
 	// Create the role
@@ -34,7 +41,7 @@ func (m *Mutate) CreateRole(ctx context.Context, rb *structures.RoleBuilder, opt
 	}
 
 	// Get the newly created role
-	if err = m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(rb.Role); err != nil {
+	if err = m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&rb.Role); err != nil {
 		return err
 	}
 
@@ -48,20 +55,26 @@ func (m *Mutate) EditRole(ctx context.Context, rb *structures.RoleBuilder, opt R
 	}
 
 	// Check actor's permissions
-	actor := opt.Actor
-	if actor != nil {
-		if !actor.HasPermission(structures.RolePermissionManageRoles) {
-			return structures.ErrInsufficientPrivilege
-		}
-		if len(opt.Actor.Roles) > 0 {
-			// ensure that the actor's role is higher than the role being deleted
-			actor.SortRoles()
-			highestRole := actor.Roles[0]
-			if opt.OriginalPosition >= highestRole.Position {
-				return structures.ErrInsufficientPrivilege
-			}
+	auth, err := authorizeRoles(opt.Actor)
+	if err != nil {
+		return err
+	}
+
+	init := rb.Initial()
+	if opt.OriginalPosition > init.Position {
+		init.Position = opt.OriginalPosition
+	}
+	if err = auth.CanManage(init); err != nil {
+		return err
+	}
+	if rb.Role.Position != init.Position {
+		if err = auth.CanSetPosition(rb.Role.Position); err != nil {
+			return err
 		}
 	}
+	if err = auth.CanGrant(rb.Role.Allowed &^ init.Allowed); err != nil { // only newly allowed bits
+		return err
+	}
 
 	// Update the role
 	if err := m.mongo.Collection(mongo.CollectionNameRoles).FindOneAndUpdate(
@@ -77,25 +90,50 @@ func (m *Mutate) EditRole(ctx context.Context, rb *structures.RoleBuilder, opt R
 }
 
 // Delete: delete the role
-func (m *Mutate) DeleteRole(ctx context.Context, rb *structures.RoleBuilder, opt RoleMutationOptions) error {
+//
+// Users and entitlements which had the role are moved to the replacement role.
+// If none is specified, the highest role below the deleted role is used, or else the default role
+func (m *Mutate) DeleteRole(ctx context.Context, rb *structures.RoleBuilder, opt RoleDeleteOptions) error {
 	if rb == nil {
 		return structures.ErrIncompleteMutation
 	}
+	if rb.Role.Default {
+		return errors.ErrInvalidRequest().SetDetail("Cannot delete the default role")
+	}
 
 	// Check actor's permissions
-	actor := opt.Actor
-	if actor != nil {
-		if !actor.HasPermission(structures.RolePermissionManageRoles) {
-			return structures.ErrInsufficientPrivilege
+	auth, err := authorizeRoles(opt.Actor)
+	if err != nil {
+		return err
+	}
+	if err = auth.CanManage(rb.Role); err != nil {
+		return err
+	}
+
+	// Get the replacement role
+	replacement := structures.Role{}
+	if replacementID := opt.ReplacementRoleID; !replacementID.IsZero() {
+		if replacementID == rb.Role.ID {
+			return errors.ErrInvalidRequest().SetDetail("Cannot replace a role with itself")
 		}
-		if len(opt.Actor.Roles) > 0 {
-			// ensure that the actor's role is higher than the role being deleted
-			actor.SortRoles()
-			highestRole := actor.Roles[0]
-			if rb.Role.Position >= highestRole.Position {
-				return structures.ErrInsufficientPrivilege
+
+		if err = m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, bson.M{"_id": replacementID}).Decode(&replacement); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return errors.ErrUnknownRole().SetDetail("Replacement role not found")
 			}
+			return errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if err = auth.CanManage(replacement); err != nil {
+			return err
 		}
+	} else if replacement, err = m.fallbackRole(ctx, rb.Role); err != nil {
+		return err
+	}
+
+	// The default role is implicit, so there is nothing to move to it
+	replacementID := replacement.ID
+	if replacement.Default {
+		replacementID = primitive.NilObjectID
 	}
 
 	// Delete the role
@@ -103,8 +141,37 @@ func (m *Mutate) DeleteRole(ctx context.Context, rb *structures.RoleBuilder, opt
 		return err
 	}
 
+	// Reassign the role of any user who had it
+	if !replacementID.IsZero() {
+		if _, err = m.mongo.Collection(mongo.CollectionNameUsers).UpdateMany(ctx, bson.M{
+			"role_ids": rb.Role.ID,
+		}, bson.M{
+			"$addToSet": bson.M{
+				"role_ids": replacementID,
+			},
+		}); err != nil {
+			return err
+		}
+
+		if _, err = m.mongo.Collection(mongo.CollectionNameEntitlements).UpdateMany(ctx, bson.M{
+			"kind":     structures.EntitlementKindRole,
+			"data.ref": rb.Role.ID,
+		}, bson.M{
+			"$set": bson.M{
+				"data.ref": replacementID,
+			},
+		}); err != nil {
+			return err
+		}
+	} else if _, err = m.mongo.Collection(mongo.CollectionNameEntitlements).DeleteMany(ctx, bson.M{
+		"kind":     structures.EntitlementKindRole,
+		"data.ref": rb.Role.ID,
+	}); err != nil {
+		return err
+	}
+
 	// Remove the role from any user who had it
-	_, err := m.mongo.Collection(mongo.CollectionNameUsers).UpdateMany(ctx, bson.M{
+	_, err = m.mongo.Collection(mongo.CollectionNameUsers).UpdateMany(ctx, bson.M{
 		"role_ids": rb.Role.ID,
 	}, bson.M{
 		"$pull": bson.M{
@@ -118,11 +185,40 @@ func (m *Mutate) DeleteRole(ctx context.Context, rb *structures.RoleBuilder, opt
 	return nil
 }
 
+// fallbackRole returns the role replacing a deleted role when none was specified:
+// the highest role positioned below it, or else the default role.
+// A zero role is returned if there is neither
+func (m *Mutate) fallbackRole(ctx context.Context, deleted structures.Role) (structures.Role, error) {
+	role := structures.Role{}
+
+	err := m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, bson.M{
+		"_id":      bson.M{"$ne": deleted.ID},
+		"position": bson.M{"$lt": deleted.Position},
+		"default":  bson.M{"$ne": true},
+	}, options.FindOne().SetSort(bson.D{{Key: "position", Value: -1}})).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		err = m.mongo.Collection(mongo.CollectionNameRoles).FindOne(ctx, bson.M{"default": true}).Decode(&role)
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		return role, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return role, nil
+}
+
 type RoleMutationOptions struct {
 	Actor *structures.User
 }
 
 type RoleEditOptions struct {
-	Actor            *structures.User
+	Actor *structures.User
+	// Deprecated: the original position is read from the builder's initial value
 	OriginalPosition int32
 }
+
+type RoleDeleteOptions struct {
+	Actor *structures.User
+	// The role given to users who had the deleted role.
+	// If not set, the highest role below the deleted role is used, or else the default role
+	ReplacementRoleID primitive.ObjectID
+}
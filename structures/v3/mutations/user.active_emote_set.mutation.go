@@ -28,8 +28,8 @@ func (m *Mutate) SetUserConnectionActiveEmoteSet(ctx context.Context, ub *struct
 				continue
 			}
 			// actor is editor
-			// actor has permission to modify victim's emotes
-			if ed.HasPermission(structures.UserEditorPermissionModifyEmotes) {
+			// actor has permission to modify victim's emotes on this connection
+			if ed.HasConnectionPermission(structures.UserEditorPermissionModifyEmotes, opt.ConnectionID) {
 				ok = true
 			}
 		}
@@ -38,6 +38,12 @@ func (m *Mutate) SetUserConnectionActiveEmoteSet(ctx context.Context, ub *struct
 		}
 	}
 
+	// Get the connection
+	conn := ub.GetConnection(opt.Platform, opt.ConnectionID)
+	if conn == nil {
+		return errors.ErrUnknownUserConnection()
+	}
+
 	// Validate that the emote set exists and can be enabled
 	if !opt.EmoteSetID.IsZero() {
 		set := &structures.EmoteSet{}
@@ -55,12 +61,19 @@ func (m *Mutate) SetUserConnectionActiveEmoteSet(ctx context.Context, ub *struct
 				SetFields(errors.Fields{"owner_id": set.OwnerID.Hex()}).
 				SetDetail("You do not own this emote set")
 		}
-	}
 
-	// Get the connection
-	conn := ub.GetConnection(opt.Platform, opt.ConnectionID)
-	if conn == nil {
-		return errors.ErrUnknownUserConnection()
+		// The set's emotes must fit in the connection's slots
+		if !actor.HasPermission(structures.RolePermissionEditAnyEmoteSet) {
+			limits, _, err := m.connectionEmoteSlots(ctx, victim)
+			if err != nil {
+				return err
+			}
+
+			limit := limits[conn.UserConnection.ID]
+			if limit.Slots > 0 && len(set.Emotes) > int(limit.Slots) {
+				return errEmoteSlots(limit, "This set has more emotes than the connection has slots")
+			}
+		}
 	}
 
 	conn.SetActiveEmoteSet(opt.EmoteSetID)
@@ -0,0 +1,62 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seventv/common/mongo/encryption"
+	"github.com/seventv/common/structures/v3"
+)
+
+// FakeGrantProvider is a GrantProvider issuing made-up tokens, for use in tests and local development
+type FakeGrantProvider struct {
+	// How long the issued grants are valid for
+	Lifetime time.Duration
+	// If set, refreshes fail with this error
+	Err error
+	// How long each refresh takes
+	Delay time.Duration
+
+	mx    sync.Mutex
+	calls int
+}
+
+func (p *FakeGrantProvider) Refresh(ctx context.Context, grant structures.UserConnectionGrant) (structures.UserConnectionGrant, error) {
+	if p.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return structures.UserConnectionGrant{}, ctx.Err()
+		case <-time.After(p.Delay):
+		}
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.calls++
+	if p.Err != nil {
+		return structures.UserConnectionGrant{}, p.Err
+	}
+
+	lifetime := p.Lifetime
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+
+	return structures.UserConnectionGrant{
+		AccessToken:  encryption.EncryptedString(fmt.Sprintf("fake-access-%d", p.calls)),
+		RefreshToken: encryption.EncryptedString(fmt.Sprintf("fake-refresh-%d", p.calls)),
+		Scope:        grant.Scope,
+		ExpiresAt:    time.Now().Add(lifetime),
+	}, nil
+}
+
+// Calls returns the amount of refreshes requested from the provider
+func (p *FakeGrantProvider) Calls() int {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return p.calls
+}
@@ -0,0 +1,410 @@
+package mutations
+
+import (
+	"context"
+	goerrors "errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	GRANT_REFRESH_INTERVAL = time.Minute
+	// Grants expiring within this window are refreshed
+	GRANT_REFRESH_WINDOW = time.Minute * 10
+	// How long to wait before retrying a failed refresh
+	GRANT_REFRESH_BACKOFF = time.Minute * 5
+	GRANT_REFRESH_LIMIT   = 500
+	// How long a refresh may hold its lock
+	GRANT_REFRESH_LOCK_TTL = time.Second * 30
+)
+
+// ErrGrantRevoked is returned by a GrantProvider when the grant can no longer be refreshed
+var ErrGrantRevoked = goerrors.New("grant was revoked")
+
+// GrantProvider refreshes the OAuth2 grants of a connection platform
+type GrantProvider interface {
+	// Refresh exchanges the grant's refresh token for a new grant
+	//
+	// If the platform did not rotate the refresh token, the returned grant's refresh token may be empty.
+	// ErrGrantRevoked should be returned (or wrapped) if the refresh token was rejected
+	Refresh(ctx context.Context, grant structures.UserConnectionGrant) (structures.UserConnectionGrant, error)
+}
+
+// GrantManager keeps the OAuth2 grants of user connections fresh
+//
+// Refreshes of the same connection are serialized, both within the process and across instances
+type GrantManager struct {
+	m         *Mutate
+	store     grantStore
+	providers map[structures.UserConnectionPlatform]GrantProvider
+
+	mx    sync.Mutex
+	locks map[string]*grantLock
+}
+
+type grantLock struct {
+	mx   sync.Mutex
+	refs int
+}
+
+// NewGrantManager: create a manager refreshing grants with the providers of each platform
+func (m *Mutate) NewGrantManager(providers map[structures.UserConnectionPlatform]GrantProvider) *GrantManager {
+	return &GrantManager{
+		m:         m,
+		store:     mongoGrantStore{m.mongo},
+		providers: providers,
+		locks:     map[string]*grantLock{},
+	}
+}
+
+// Run: refresh grants nearing expiry on an interval. This blocks until the context is canceled
+func (gm *GrantManager) Run(ctx context.Context, opt GrantRefreshOptions) {
+	interval := opt.Interval
+	if interval <= 0 {
+		interval = GRANT_REFRESH_INTERVAL
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			count, err := gm.RefreshExpiring(ctx, opt)
+			if err != nil {
+				zap.S().Errorw("failed to refresh expiring grants",
+					"error", err,
+				)
+				continue
+			}
+			if count > 0 {
+				zap.S().Infow("refreshed expiring grants",
+					"count", count,
+				)
+			}
+		}
+	}
+}
+
+type GrantRefreshOptions struct {
+	// How often grants are checked
+	Interval time.Duration
+	// Grants expiring within this window are refreshed
+	Window time.Duration
+	// The maximum amount of users processed at once
+	Limit int64
+}
+
+// RefreshExpiring: refresh the grants expiring within the window
+//
+// Returns the amount of grants successfully refreshed
+func (gm *GrantManager) RefreshExpiring(ctx context.Context, opt GrantRefreshOptions) (int, error) {
+	if opt.Window <= 0 {
+		opt.Window = GRANT_REFRESH_WINDOW
+	}
+	if opt.Limit <= 0 {
+		opt.Limit = GRANT_REFRESH_LIMIT
+	}
+
+	platforms := bson.A{}
+	for p := range gm.providers {
+		platforms = append(platforms, p)
+	}
+	if len(platforms) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	users, err := gm.store.expiring(ctx, platforms, now, opt.Window, opt.Limit)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, u := range users {
+		for _, conn := range u.Connections {
+			if !grantNeedsRefresh(conn.Grant, now, opt.Window) || gm.providers[conn.Platform] == nil {
+				continue
+			}
+
+			if _, err := gm.refresh(ctx, u.ID, conn.Platform, conn.ID, opt.Window); err != nil {
+				zap.S().Warnw("failed to refresh connection grant",
+					"error", err,
+					"user_id", u.ID.Hex(),
+					"platform", conn.Platform,
+					"connection_id", conn.ID,
+				)
+				continue
+			}
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Refresh: refresh the grant of a connection, and persist the result
+//
+// Unless forced, the grant is only refreshed if it is nearing expiry,
+// so that callers waiting on a concurrent refresh reuse its result
+func (gm *GrantManager) Refresh(
+	ctx context.Context,
+	userID structures.ObjectID,
+	platform structures.UserConnectionPlatform,
+	connectionID string,
+	force bool,
+) (*structures.UserConnectionGrant, error) {
+	return gm.refresh(ctx, userID, platform, connectionID, utils.Ternary(force, time.Duration(-1), GRANT_REFRESH_WINDOW))
+}
+
+// refresh refreshes the grant of a connection if it expires within the window. A negative window forces the refresh
+func (gm *GrantManager) refresh(
+	ctx context.Context,
+	userID structures.ObjectID,
+	platform structures.UserConnectionPlatform,
+	connectionID string,
+	window time.Duration,
+) (*structures.UserConnectionGrant, error) {
+	provider := gm.providers[platform]
+	if provider == nil {
+		return nil, errors.ErrInvalidRequest().SetDetail("No grant provider for platform '%s'", platform)
+	}
+
+	unlock, err := gm.lock(ctx, platform, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Read the grant once the lock is held, as a concurrent refresh may have replaced it
+	connections, err := gm.store.connections(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, ind := findUserConnection(connections, platform, connectionID)
+	if ind == -1 {
+		return nil, errors.ErrUnknownUserConnection()
+	}
+	if conn.Grant == nil || conn.Grant.RefreshToken == "" {
+		return nil, errors.ErrInvalidRequest().SetDetail("Connection has no refreshable grant")
+	}
+	if conn.Grant.Revoked {
+		return nil, errors.ErrInvalidRequest().SetDetail("Connection grant was revoked")
+	}
+	if window >= 0 && time.Until(conn.Grant.ExpiresAt) > window {
+		return conn.Grant, nil
+	}
+
+	grant, err := provider.Refresh(ctx, *conn.Grant)
+	if err != nil {
+		failed := *conn.Grant
+		failed.RefreshFailedAt = time.Now()
+		failed.RefreshError = err.Error()
+		failed.Revoked = goerrors.Is(err, ErrGrantRevoked)
+
+		if perr := gm.store.save(ctx, userID, conn, failed); perr != nil {
+			zap.S().Errorw("mongo, failed to mark connection grant refresh as failed",
+				"error", perr,
+				"user_id", userID.Hex(),
+				"connection_id", connectionID,
+			)
+		}
+		return nil, errors.ErrInternalServerError().SetDetail("Grant refresh failed: %s", err.Error())
+	}
+
+	if grant.RefreshToken == "" {
+		grant.RefreshToken = conn.Grant.RefreshToken
+	}
+	if len(grant.Scope) == 0 {
+		grant.Scope = conn.Grant.Scope
+	}
+	grant.RefreshFailedAt = time.Time{}
+	grant.RefreshError = ""
+	grant.Revoked = false
+
+	if err = gm.store.save(ctx, userID, conn, grant); err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+// grantStore reads and writes the grants of user connections
+type grantStore interface {
+	// expiring returns the users with grants of the platforms expiring within the window, with only their connections
+	expiring(ctx context.Context, platforms bson.A, now time.Time, window time.Duration, limit int64) ([]structures.User, error)
+	// connections returns the connections of a user
+	connections(ctx context.Context, userID structures.ObjectID) ([]structures.UserConnection[bson.Raw], error)
+	// save writes the grant of a connection
+	save(ctx context.Context, userID structures.ObjectID, conn structures.UserConnection[bson.Raw], grant structures.UserConnectionGrant) error
+}
+
+// mongoGrantStore keeps the grants on the user documents
+type mongoGrantStore struct {
+	mongo mongo.Instance
+}
+
+func (s mongoGrantStore) expiring(ctx context.Context, platforms bson.A, now time.Time, window time.Duration, limit int64) ([]structures.User, error) {
+	cur, err := s.mongo.Collection(mongo.CollectionNameUsers).Find(ctx, bson.M{
+		"connections": bson.M{"$elemMatch": expiringGrantFilter(platforms, now, window)},
+	}, options.Find().SetProjection(bson.M{"connections": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	users := []structures.User{}
+	if err = cur.All(ctx, &users); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return users, nil
+}
+
+func (s mongoGrantStore) connections(ctx context.Context, userID structures.ObjectID) ([]structures.UserConnection[bson.Raw], error) {
+	user := structures.User{}
+	if err := s.mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"_id": userID,
+	}, options.FindOne().SetProjection(bson.M{"connections": 1})).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errors.ErrUnknownUser()
+		}
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return user.Connections, nil
+}
+
+func (s mongoGrantStore) save(
+	ctx context.Context,
+	userID structures.ObjectID,
+	conn structures.UserConnection[bson.Raw],
+	grant structures.UserConnectionGrant,
+) error {
+	cb := structures.NewUserConnectionBuilder(conn)
+	cb.UserConnection.Grant = &grant
+	cb.Update.Set("connections.$.grant", grant)
+
+	res, err := s.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, bson.M{
+		"_id":         userID,
+		"connections": connectionElemMatch(conn.Platform, conn.ID),
+	}, cb.Update)
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.MatchedCount == 0 {
+		return errors.ErrUnknownUserConnection()
+	}
+
+	return nil
+}
+
+// lock acquires the refresh lock of a connection
+//
+// The lock is first acquired within the process, then in redis so that other instances are excluded too
+func (gm *GrantManager) lock(ctx context.Context, platform structures.UserConnectionPlatform, connectionID string) (func(), error) {
+	key := fmt.Sprintf("%s:%s", platform, connectionID)
+
+	gm.mx.Lock()
+	l := gm.locks[key]
+	if l == nil {
+		l = &grantLock{}
+		gm.locks[key] = l
+	}
+	l.refs++
+	gm.mx.Unlock()
+
+	release := func() {
+		l.mx.Unlock()
+
+		gm.mx.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(gm.locks, key)
+		}
+		gm.mx.Unlock()
+	}
+
+	l.mx.Lock()
+	if gm.m.redis == nil {
+		return release, nil
+	}
+
+	// The token identifies this holder, so that a lock which expired and was taken over is not released by it
+	token, err := utils.GenerateRandomString(16)
+	if err != nil {
+		release()
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	k := gm.m.redis.ComposeKey("common", "grant-refresh", key)
+	for {
+		ok, err := gm.m.redis.RawClient().SetNX(ctx, k.String(), token, GRANT_REFRESH_LOCK_TTL).Result()
+		if err != nil {
+			release()
+			return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+
+	return func() {
+		if err := releaseGrantLockScript.Run(context.Background(), gm.m.redis.RawClient(), []string{k.String()}, token).Err(); err != nil {
+			zap.S().Errorw("redis, failed to release grant refresh lock",
+				"error", err,
+				"key", k,
+			)
+		}
+		release()
+	}, nil
+}
+
+// releaseGrantLockScript deletes the lock only if it is still held by the token
+var releaseGrantLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func expiringGrantFilter(platforms bson.A, now time.Time, window time.Duration) bson.M {
+	return bson.M{
+		"platform":            bson.M{"$in": platforms},
+		"grant.refresh_token": bson.M{"$nin": bson.A{nil, ""}},
+		"grant.expires_at":    bson.M{"$lte": now.Add(window)},
+		"grant.revoked":       bson.M{"$ne": true},
+		"grant.refresh_failed_at": bson.M{"$not": bson.M{
+			"$gt": now.Add(-GRANT_REFRESH_BACKOFF),
+		}},
+	}
+}
+
+// grantNeedsRefresh mirrors expiringGrantFilter for a single grant
+func grantNeedsRefresh(g *structures.UserConnectionGrant, now time.Time, window time.Duration) bool {
+	if g == nil || g.RefreshToken == "" || g.Revoked {
+		return false
+	}
+	if g.ExpiresAt.After(now.Add(window)) {
+		return false
+	}
+
+	return g.RefreshFailedAt.IsZero() || !g.RefreshFailedAt.After(now.Add(-GRANT_REFRESH_BACKOFF))
+}
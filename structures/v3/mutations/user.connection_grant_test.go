@@ -0,0 +1,285 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memGrantStore is an in-memory grantStore
+type memGrantStore struct {
+	mx    sync.Mutex
+	users map[primitive.ObjectID]structures.UserConnectionList
+}
+
+func (s *memGrantStore) expiring(ctx context.Context, platforms bson.A, now time.Time, window time.Duration, limit int64) ([]structures.User, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	result := []structures.User{}
+	for id, conns := range s.users {
+		for _, c := range conns {
+			if grantNeedsRefresh(c.Grant, now, window) {
+				result = append(result, structures.User{ID: id, Connections: s.copy(conns)})
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *memGrantStore) connections(ctx context.Context, userID structures.ObjectID) ([]structures.UserConnection[bson.Raw], error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	conns, ok := s.users[userID]
+	if !ok {
+		return nil, errors.ErrUnknownUser()
+	}
+	return s.copy(conns), nil
+}
+
+func (s *memGrantStore) save(ctx context.Context, userID structures.ObjectID, conn structures.UserConnection[bson.Raw], grant structures.UserConnectionGrant) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for i, c := range s.users[userID] {
+		if c.Platform == conn.Platform && c.ID == conn.ID {
+			s.users[userID][i].Grant = &grant
+			return nil
+		}
+	}
+	return errors.ErrUnknownUserConnection()
+}
+
+// grant returns the stored grant of a connection
+func (s *memGrantStore) grant(userID primitive.ObjectID, connectionID string) structures.UserConnectionGrant {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, c := range s.users[userID] {
+		if c.ID == connectionID {
+			return *c.Grant
+		}
+	}
+	return structures.UserConnectionGrant{}
+}
+
+// copy deep copies connections, so that grants are not shared with the caller
+func (s *memGrantStore) copy(conns structures.UserConnectionList) structures.UserConnectionList {
+	result := make(structures.UserConnectionList, len(conns))
+	for i, c := range conns {
+		if c.Grant != nil {
+			g := *c.Grant
+			c.Grant = &g
+		}
+		result[i] = c
+	}
+	return result
+}
+
+type grantTestEnv struct {
+	gm       *GrantManager
+	store    *memGrantStore
+	provider *FakeGrantProvider
+}
+
+func newGrantTestEnv() *grantTestEnv {
+	provider := &FakeGrantProvider{}
+	store := &memGrantStore{users: map[primitive.ObjectID]structures.UserConnectionList{}}
+
+	gm := (&Mutate{}).NewGrantManager(map[structures.UserConnectionPlatform]GrantProvider{
+		structures.UserConnectionPlatformTwitch: provider,
+	})
+	gm.store = store
+
+	return &grantTestEnv{gm, store, provider}
+}
+
+// addUser adds a user with a Twitch connection whose grant expires in the duration
+func (env *grantTestEnv) addUser(connectionID string, expiresIn time.Duration) primitive.ObjectID {
+	id := primitive.NewObjectID()
+	env.store.users[id] = structures.UserConnectionList{{
+		ID:       connectionID,
+		Platform: structures.UserConnectionPlatformTwitch,
+		Grant: &structures.UserConnectionGrant{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			Scope:        []string{"user:read:email"},
+			ExpiresAt:    time.Now().Add(expiresIn),
+		},
+	}}
+	return id
+}
+
+func TestGrantRefreshWindow(t *testing.T) {
+	env := newGrantTestEnv()
+	ctx := context.Background()
+
+	inside := env.addUser("inside", GRANT_REFRESH_WINDOW/2)
+	outside := env.addUser("outside", GRANT_REFRESH_WINDOW*2)
+
+	g, err := env.gm.Refresh(ctx, outside, structures.UserConnectionPlatformTwitch, "outside", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.provider.Calls() != 0 || g.AccessToken != "access" {
+		t.Errorf("a grant outside the window was refreshed (calls = %d)", env.provider.Calls())
+	}
+
+	g, err = env.gm.Refresh(ctx, inside, structures.UserConnectionPlatformTwitch, "inside", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.provider.Calls() != 1 || g.AccessToken == "access" {
+		t.Errorf("a grant inside the window was not refreshed (calls = %d)", env.provider.Calls())
+	}
+
+	stored := env.store.grant(inside, "inside")
+	if stored.AccessToken != g.AccessToken || !stored.ExpiresAt.After(time.Now().Add(GRANT_REFRESH_WINDOW)) {
+		t.Errorf("the refreshed grant was not persisted: %+v", stored)
+	}
+	if len(stored.Scope) == 0 {
+		t.Error("the scope of the previous grant was not kept")
+	}
+
+	// Forcing refreshes regardless of the window
+	if _, err = env.gm.Refresh(ctx, outside, structures.UserConnectionPlatformTwitch, "outside", true); err != nil {
+		t.Fatal(err)
+	}
+	if env.provider.Calls() != 2 {
+		t.Errorf("a forced refresh did not call the provider (calls = %d)", env.provider.Calls())
+	}
+}
+
+func TestGrantRefreshExpiring(t *testing.T) {
+	env := newGrantTestEnv()
+
+	inside := env.addUser("inside", GRANT_REFRESH_WINDOW/2)
+	env.addUser("outside", GRANT_REFRESH_WINDOW*2)
+	expired := env.addUser("expired", -time.Hour)
+
+	count, err := env.gm.RefreshExpiring(context.Background(), GrantRefreshOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || env.provider.Calls() != 2 {
+		t.Errorf("count = %d, calls = %d; want 2 refreshes", count, env.provider.Calls())
+	}
+
+	for _, id := range []primitive.ObjectID{inside, expired} {
+		for _, c := range env.store.users[id] {
+			if c.Grant.AccessToken == "access" {
+				t.Errorf("grant of connection %s was not refreshed", c.ID)
+			}
+		}
+	}
+}
+
+func TestGrantRevoked(t *testing.T) {
+	env := newGrantTestEnv()
+	ctx := context.Background()
+	env.provider.Err = fmt.Errorf("invalid refresh token: %w", ErrGrantRevoked)
+
+	id := env.addUser("conn", time.Minute)
+	if _, err := env.gm.Refresh(ctx, id, structures.UserConnectionPlatformTwitch, "conn", false); err == nil {
+		t.Fatal("a failed refresh returned no error")
+	}
+
+	stored := env.store.grant(id, "conn")
+	if !stored.Revoked || stored.RefreshFailedAt.IsZero() || stored.RefreshError == "" {
+		t.Errorf("the connection was not marked as failed: %+v", stored)
+	}
+
+	// A revoked grant is not sent to the provider again
+	env.provider.Err = nil
+	if _, err := env.gm.Refresh(ctx, id, structures.UserConnectionPlatformTwitch, "conn", true); err == nil {
+		t.Error("a revoked grant was refreshed")
+	}
+	if env.provider.Calls() != 1 {
+		t.Errorf("calls = %d; want 1", env.provider.Calls())
+	}
+	if count, _ := env.gm.RefreshExpiring(ctx, GrantRefreshOptions{}); count != 0 {
+		t.Errorf("RefreshExpiring refreshed %d revoked grants", count)
+	}
+}
+
+func TestGrantRefreshBackoff(t *testing.T) {
+	env := newGrantTestEnv()
+	ctx := context.Background()
+	env.provider.Err = fmt.Errorf("platform unavailable")
+
+	id := env.addUser("conn", time.Minute)
+	if count, _ := env.gm.RefreshExpiring(ctx, GrantRefreshOptions{}); count != 0 {
+		t.Fatalf("count = %d; want the refresh to fail", count)
+	}
+
+	stored := env.store.grant(id, "conn")
+	if stored.Revoked || stored.RefreshFailedAt.IsZero() {
+		t.Fatalf("a transient failure was not recorded as such: %+v", stored)
+	}
+
+	// Within the backoff, the grant is skipped
+	env.provider.Err = nil
+	if count, _ := env.gm.RefreshExpiring(ctx, GrantRefreshOptions{}); count != 0 || env.provider.Calls() != 1 {
+		t.Errorf("count = %d, calls = %d; want the grant skipped during the backoff", count, env.provider.Calls())
+	}
+
+	// Once the backoff passed, the grant is retried and the failure cleared
+	stored.RefreshFailedAt = time.Now().Add(-GRANT_REFRESH_BACKOFF - time.Second)
+	env.store.users[id][0].Grant = &stored
+
+	if count, _ := env.gm.RefreshExpiring(ctx, GrantRefreshOptions{}); count != 1 || env.provider.Calls() != 2 {
+		t.Errorf("count = %d, calls = %d; want the grant retried after the backoff", count, env.provider.Calls())
+	}
+	if stored = env.store.grant(id, "conn"); !stored.RefreshFailedAt.IsZero() || stored.RefreshError != "" {
+		t.Errorf("the failure was not cleared: %+v", stored)
+	}
+}
+
+func TestGrantConcurrentRefresh(t *testing.T) {
+	env := newGrantTestEnv()
+	env.provider.Delay = time.Millisecond * 20
+
+	id := env.addUser("conn", time.Minute)
+
+	const n = 10
+	tokens := make([]string, n)
+	errs := make([]error, n)
+
+	wg := sync.WaitGroup{}
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			g, err := env.gm.Refresh(context.Background(), id, structures.UserConnectionPlatformTwitch, "conn", false)
+			if err == nil {
+				tokens[i] = string(g.AccessToken)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	if env.provider.Calls() != 1 {
+		t.Errorf("calls = %d; want concurrent refreshes to share one provider call", env.provider.Calls())
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Errorf("refresh %d failed: %v", i, errs[i])
+		} else if tokens[i] != tokens[0] {
+			t.Errorf("refresh %d returned %q; want %q", i, tokens[i], tokens[0])
+		}
+	}
+	if len(env.gm.locks) != 0 {
+		t.Errorf("%d refresh locks were not released", len(env.gm.locks))
+	}
+}
@@ -0,0 +1,424 @@
+package mutations
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/events"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// LinkUserConnection: link a third-party connection to a user
+//
+// A connection may only be linked to one user at a time
+func (m *Mutate) LinkUserConnection(ctx context.Context, ub *structures.UserBuilder, opt LinkUserConnectionOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkConnectionPermission(opt.Actor, &ub.User); err != nil {
+		return err
+	}
+
+	conn := opt.Connection
+	if conn.ID == "" {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a connection ID")
+	}
+	platform, ok := structures.GetConnectionPlatform(conn.Platform)
+	if !ok {
+		return errors.ErrValidationRejected().SetDetail("Unknown connection platform '%s'", conn.Platform)
+	}
+	if err := platform.Validate(conn.Data); err != nil {
+		return err
+	}
+	if conn.LinkedAt.IsZero() {
+		conn.LinkedAt = time.Now()
+	}
+
+	// Check that the connection isn't linked elsewhere
+	if err := m.checkConnectionConflict(ctx, conn.Platform, conn.ID); err != nil {
+		return err
+	}
+
+	// Only push the connection if it is still unlinked, in case it was linked concurrently
+	res, err := m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, bson.M{
+		"_id":         ub.User.ID,
+		"connections": bson.M{"$not": connectionElemMatch(conn.Platform, conn.ID)},
+	}, bson.M{
+		"$push": bson.M{"connections": conn},
+	})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.MatchedCount == 0 {
+		return errors.ErrConnectionAlreadyLinked().SetFields(errors.Fields{
+			"PLATFORM":      conn.Platform,
+			"CONNECTION_ID": conn.ID,
+		})
+	}
+
+	ub.User.Connections = append(ub.User.Connections, conn)
+
+	m.logUserConnection(ctx, structures.AuditLogKindAddUserConnection, opt.Actor, ub.User.ID, opt.Reason,
+		(&structures.AuditLogChange{
+			Key: "connections",
+		}).WriteArrayAdded(connectionSummary(conn)),
+	)
+	m.publishUserConnection(ctx, events.EventTypeAddUserConnection, ub.User.ID, nil, &conn)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+type LinkUserConnectionOptions struct {
+	Actor      *structures.User
+	Connection structures.UserConnection[bson.Raw]
+	Reason     string
+}
+
+// UnlinkUserConnection: remove a third-party connection from a user
+//
+// Users cannot unlink their last connection, as they would no longer be able to sign in
+func (m *Mutate) UnlinkUserConnection(ctx context.Context, ub *structures.UserBuilder, opt UnlinkUserConnectionOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkConnectionPermission(opt.Actor, &ub.User); err != nil {
+		return err
+	}
+
+	conn, ind := findUserConnection(ub.User.Connections, opt.Platform, opt.ConnectionID)
+	if ind == -1 {
+		return errors.ErrUnknownUserConnection()
+	}
+	if len(ub.User.Connections) == 1 && opt.Actor != nil && !opt.Actor.HasPermission(structures.RolePermissionManageUsers) {
+		return errors.ErrDontBeSilly().SetDetail("Cannot unlink the last connection of a user")
+	}
+
+	res, err := m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, bson.M{
+		"_id": ub.User.ID,
+	}, bson.M{
+		"$pull": bson.M{"connections": bson.M{"id": conn.ID, "platform": conn.Platform}},
+	})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if res.ModifiedCount == 0 {
+		return errors.ErrUnknownUserConnection()
+	}
+
+	ub.User.Connections = append(ub.User.Connections[:ind:ind], ub.User.Connections[ind+1:]...)
+
+	m.logUserConnection(ctx, structures.AuditLogKindRemoveUserConnection, opt.Actor, ub.User.ID, opt.Reason,
+		(&structures.AuditLogChange{
+			Key: "connections",
+		}).WriteArrayRemoved(connectionSummary(conn)),
+	)
+	m.publishUserConnection(ctx, events.EventTypeDeleteUserConnection, ub.User.ID, &conn, nil)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+type UnlinkUserConnectionOptions struct {
+	Actor        *structures.User
+	Platform     structures.UserConnectionPlatform
+	ConnectionID string
+	Reason       string
+}
+
+// TransferUserConnection: move a third-party connection from one user to another
+//
+// This requires the permission to manage users
+func (m *Mutate) TransferUserConnection(ctx context.Context, from *structures.UserBuilder, to *structures.UserBuilder, opt TransferUserConnectionOptions) error {
+	if from == nil || to == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if from.IsTainted() || to.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if opt.Actor != nil && !opt.Actor.HasPermission(structures.RolePermissionManageUsers) {
+		return errors.ErrInsufficientPrivilege().SetFields(errors.Fields{
+			"MISSING_PERMISSION": "MANAGE_USERS",
+		})
+	}
+	if from.User.ID == to.User.ID {
+		return errors.ErrDontBeSilly().SetDetail("Cannot transfer a connection to the same user")
+	}
+
+	conn, ind := findUserConnection(from.User.Connections, opt.Platform, opt.ConnectionID)
+	if ind == -1 {
+		return errors.ErrUnknownUserConnection()
+	}
+	if _, i := findUserConnection(to.User.Connections, conn.Platform, conn.ID); i != -1 {
+		return errors.ErrConnectionAlreadyLinked().SetDetail("The target user already has this connection")
+	}
+
+	// The active emote set belongs to the previous owner
+	conn.EmoteSetID = structures.ObjectID{}
+
+	// Move the connection in a transaction, so that it is never lost or linked to both users
+	sess, err := m.mongo.RawClient().StartSession()
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	defer sess.EndSession(ctx)
+
+	if _, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// Remove from the previous owner
+		res, err := m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(sc, bson.M{
+			"_id": from.User.ID,
+		}, bson.M{
+			"$pull": bson.M{"connections": bson.M{"id": conn.ID, "platform": conn.Platform}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if res.ModifiedCount == 0 {
+			return nil, errors.ErrUnknownUserConnection()
+		}
+
+		// Add to the new owner, unless they linked the connection in the meantime
+		res, err = m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(sc, bson.M{
+			"_id":         to.User.ID,
+			"connections": bson.M{"$not": connectionElemMatch(conn.Platform, conn.ID)},
+		}, bson.M{
+			"$push": bson.M{"connections": conn},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, errors.ErrConnectionAlreadyLinked().SetDetail("The target user already has this connection")
+		}
+
+		return nil, nil
+	}); err != nil {
+		if _, ok := err.(errors.APIError); ok {
+			return err
+		}
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	old := from.User.Connections[ind]
+	from.User.Connections = append(from.User.Connections[:ind:ind], from.User.Connections[ind+1:]...)
+	to.User.Connections = append(to.User.Connections, conn)
+
+	m.logUserConnection(ctx, structures.AuditLogKindTransferUserConnection, opt.Actor, from.User.ID, opt.Reason,
+		(&structures.AuditLogChange{
+			Format: structures.AuditLogChangeFormatSingleValue,
+			Key:    "user_id",
+		}).WriteSingleValues(from.User.ID, to.User.ID),
+		(&structures.AuditLogChange{
+			Key: "connections",
+		}).WriteArrayRemoved(connectionSummary(conn)),
+	)
+	m.publishUserConnection(ctx, events.EventTypeDeleteUserConnection, from.User.ID, &old, nil)
+	m.publishUserConnection(ctx, events.EventTypeAddUserConnection, to.User.ID, nil, &conn)
+
+	from.MarkAsTainted()
+	to.MarkAsTainted()
+	return nil
+}
+
+type TransferUserConnectionOptions struct {
+	Actor        *structures.User
+	Platform     structures.UserConnectionPlatform
+	ConnectionID string
+	Reason       string
+}
+
+// RefreshTwitchConnection: replace the data of a Twitch connection with up-to-date data from Twitch
+func (m *Mutate) RefreshTwitchConnection(ctx context.Context, ub *structures.UserBuilder, opt RefreshTwitchConnectionOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if err := checkConnectionPermission(opt.Actor, &ub.User); err != nil {
+		return err
+	}
+	if opt.Data.ID != opt.ConnectionID {
+		return errors.ErrValidationRejected().SetDetail("Connection data does not belong to this connection")
+	}
+
+	old, ind := findUserConnection(ub.User.Connections, structures.UserConnectionPlatformTwitch, opt.ConnectionID)
+	if ind == -1 {
+		return errors.ErrUnknownUserConnection()
+	}
+
+	cb := ub.GetConnection(structures.UserConnectionPlatformTwitch, opt.ConnectionID)
+	raw, err := bson.Marshal(opt.Data)
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	cb.SetData(raw)
+	cb.Update.Set("connections.$.data", raw)
+
+	user := structures.User{}
+	if err = m.mongo.Collection(mongo.CollectionNameUsers).FindOneAndUpdate(ctx, bson.M{
+		"_id":         ub.User.ID,
+		"connections": connectionElemMatch(structures.UserConnectionPlatformTwitch, opt.ConnectionID),
+	}, cb.Update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrUnknownUserConnection()
+		}
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	ub.User.Connections = user.Connections
+	conn, _ := findUserConnection(ub.User.Connections, structures.UserConnectionPlatformTwitch, opt.ConnectionID)
+
+	m.logUserConnection(ctx, structures.AuditLogKindUpdateUserConnection, opt.Actor, ub.User.ID, "",
+		(&structures.AuditLogChange{
+			Key: "connections",
+		}).WriteArrayUpdated(structures.AuditLogChangeSingleValue{
+			Old:      connectionSummary(old),
+			New:      connectionSummary(conn),
+			Position: int32(ind),
+		}),
+	)
+	m.publishUserConnection(ctx, events.EventTypeUpdateUserConnection, ub.User.ID, &old, &conn)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+type RefreshTwitchConnectionOptions struct {
+	Actor        *structures.User
+	ConnectionID string
+	Data         structures.UserConnectionDataTwitch
+}
+
+// checkConnectionPermission checks that the actor may manage the connections of the victim
+func checkConnectionPermission(actor *structures.User, victim *structures.User) error {
+	if actor == nil || actor.ID == victim.ID || actor.HasPermission(structures.RolePermissionManageUsers) {
+		return nil
+	}
+
+	return errors.ErrInsufficientPrivilege().SetDetail("You cannot manage the connections of this user")
+}
+
+// checkConnectionConflict returns an error if the connection is linked to any user
+func (m *Mutate) checkConnectionConflict(ctx context.Context, platform structures.UserConnectionPlatform, id string) error {
+	owner := structures.User{}
+	err := m.mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{
+		"connections": connectionElemMatch(platform, id),
+	}, options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&owner)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return errors.ErrConnectionAlreadyLinked().SetFields(errors.Fields{
+		"PLATFORM":      platform,
+		"CONNECTION_ID": id,
+		"USER_ID":       owner.ID.Hex(),
+	})
+}
+
+// logUserConnection writes an audit log entry for a change to a user's connections
+func (m *Mutate) logUserConnection(
+	ctx context.Context,
+	kind structures.AuditLogKind,
+	actor *structures.User,
+	userID structures.ObjectID,
+	reason string,
+	changes ...*structures.AuditLogChange,
+) {
+	alb := structures.NewAuditLogBuilder(structures.AuditLog{Reason: reason}).
+		SetKind(kind).
+		SetActor(actorIDOf(actor)).
+		SetTargetKind(structures.ObjectKindUser).
+		SetTargetID(userID).
+		AddChanges(changes...)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, alb.AuditLog); err != nil {
+		zap.S().Errorw("mongo, failed to write audit log entry for user connection",
+			"error", err,
+			"user_id", userID.Hex(),
+		)
+	}
+}
+
+// publishUserConnection dispatches a change to a user's connections
+func (m *Mutate) publishUserConnection(
+	ctx context.Context,
+	t events.EventType,
+	userID structures.ObjectID,
+	old, new *structures.UserConnection[bson.Raw],
+) {
+	cm := events.ChangeMap{
+		ID:   userID,
+		Kind: structures.ObjectKindUser,
+	}
+	field := events.ChangeField{Key: "connections"}
+	if old != nil {
+		field.OldValue = old
+	}
+	if new != nil {
+		field.NewValue = new
+	}
+
+	switch {
+	case old == nil:
+		cm.Added = []events.ChangeField{field}
+	case new == nil:
+		cm.Removed = []events.ChangeField{field}
+	default:
+		cm.Updated = []events.ChangeField{field}
+	}
+
+	msg := events.NewMessage(events.OpcodeDispatch, events.DispatchPayload{
+		Type: t,
+		Body: cm,
+	})
+	if err := events.Publish(ctx, msg, m.redis); err != nil {
+		zap.S().Errorw("failed to publish user connection event",
+			"error", err,
+			"type", t,
+			"user_id", userID.Hex(),
+		)
+	}
+}
+
+func findUserConnection(
+	list structures.UserConnectionList,
+	platform structures.UserConnectionPlatform,
+	id string,
+) (structures.UserConnection[bson.Raw], int) {
+	for i, c := range list {
+		if c.Platform == platform && c.ID == id {
+			return c, i
+		}
+	}
+
+	return structures.UserConnection[bson.Raw]{}, -1
+}
+
+func connectionElemMatch(platform structures.UserConnectionPlatform, id string) bson.M {
+	return bson.M{"$elemMatch": bson.M{"id": id, "platform": platform}}
+}
+
+// connectionSummary identifies a connection in audit logs, leaving out its grant and any private data
+func connectionSummary(c structures.UserConnection[bson.Raw]) bson.M {
+	summary := bson.M{
+		"id":       c.ID,
+		"platform": c.Platform,
+	}
+	if v, ok := c.Data.Lookup("login").StringValueOK(); ok {
+		summary["login"] = v
+	}
+	if v, ok := c.Data.Lookup("display_name").StringValueOK(); ok {
+		summary["display_name"] = v
+	}
+
+	return summary
+}
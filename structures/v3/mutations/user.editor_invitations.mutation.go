@@ -0,0 +1,368 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// The default duration after which a pending editor invitation expires
+const USER_EDITOR_INVITATION_EXPIRY = time.Hour * 24 * 7
+
+// InviteUserEditor: invite a user to become an editor of the target user
+//
+// The invitee has no permissions until they accept the invitation with AcceptUserEditorInvitation
+func (m *Mutate) InviteUserEditor(ctx context.Context, ub *structures.UserBuilder, opt UserEditorInvitationOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if opt.Editor == nil || opt.Editor.ID.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify an editor")
+	}
+
+	actor := opt.Actor
+	target := &ub.User
+	editor := opt.Editor
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+	if !canManageUserEditors(actor, target) {
+		return errors.ErrInsufficientPrivilege().SetDetail("You don't have permission to manage this user's editors")
+	}
+	if editor.ID == target.ID {
+		return errors.ErrDontBeSilly().SetDetail("Users cannot be their own editor")
+	}
+
+	if err := checkEditorGrant(actor, target, opt.Permissions, opt.Connections, opt.EmoteSets); err != nil {
+		return err
+	}
+	if err := m.checkEditorScope(ctx, target, opt.Connections, opt.EmoteSets); err != nil {
+		return err
+	}
+
+	if ed, ok, _ := target.GetEditor(editor.ID); ok && !ed.Pending {
+		return errors.ErrInvalidRequest().SetDetail("Target user is already an editor")
+	}
+
+	// Verify that the invitee exists
+	if err := m.mongo.Collection(mongo.CollectionNameUsers).FindOne(ctx, bson.M{"_id": editor.ID}).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrUnknownUser()
+		}
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	expiry := utils.Ternary(opt.Expiry > 0, opt.Expiry, USER_EDITOR_INVITATION_EXPIRY)
+	ub.InviteEditor(editor.ID, actor.ID, opt.Permissions, opt.Visible, time.Now().Add(expiry))
+	ub.SetEditorScope(editor.ID, opt.Connections, opt.EmoteSets)
+
+	// The filter ensures the editor was not accepted in the meantime
+	if err := m.writeUserEditors(ctx, ub, bson.M{
+		"_id": target.ID,
+		"editors": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"id":      editor.ID,
+			"pending": bson.M{"$ne": true},
+		}}},
+	}); err != nil {
+		return err
+	}
+
+	invitation, _, _ := target.GetEditor(editor.ID)
+	m.logUserEditor(ctx, structures.AuditLogKindInviteUserEditor, actor.ID, target.ID, nil, &invitation)
+	m.notifyUserEditorInvitation(ctx, actor, target, invitation, "request", editor.ID)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+// AcceptUserEditorInvitation: the actor accepts a pending invitation and becomes an editor of the target user
+func (m *Mutate) AcceptUserEditorInvitation(ctx context.Context, ub *structures.UserBuilder, opt UserEditorInvitationOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	target := &ub.User
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	invitation, ok, ind := target.GetEditor(actor.ID)
+	if !ok || !invitation.Pending {
+		return errors.ErrInvalidRequest().SetDetail("There is no pending editor invitation for you from this user")
+	}
+	if invitation.IsExpired() {
+		return errors.ErrInvalidRequest().SetDetail("This editor invitation has expired")
+	}
+
+	ub.AcceptEditor(actor.ID)
+
+	// The filter ensures the invitation was not cancelled or renewed in the meantime
+	if err := m.writeUserEditors(ctx, ub, bson.M{
+		"_id":                                  target.ID,
+		fmt.Sprintf("editors.%d.id", ind):      actor.ID,
+		fmt.Sprintf("editors.%d.pending", ind): true,
+	}); err != nil {
+		return err
+	}
+
+	accepted, _, _ := target.GetEditor(actor.ID)
+	m.logUserEditor(ctx, structures.AuditLogKindAddUserEditor, actor.ID, target.ID, &invitation, &accepted)
+	m.notifyUserEditorInvitation(ctx, actor, target, invitation, "accept", invitation.InvitedBy, target.ID)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+// DeclineUserEditorInvitation: the actor declines a pending invitation to become an editor of the target user
+func (m *Mutate) DeclineUserEditorInvitation(ctx context.Context, ub *structures.UserBuilder, opt UserEditorInvitationOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+
+	actor := opt.Actor
+	target := &ub.User
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	invitation, ok, _ := target.GetEditor(actor.ID)
+	if !ok || !invitation.Pending {
+		return errors.ErrInvalidRequest().SetDetail("There is no pending editor invitation for you from this user")
+	}
+
+	ub.RemoveEditor(actor.ID)
+	if err := m.writeUserEditors(ctx, ub, bson.M{"_id": target.ID}); err != nil {
+		return err
+	}
+
+	m.logUserEditor(ctx, structures.AuditLogKindRemoveEditorInvitation, actor.ID, target.ID, &invitation, nil)
+	m.notifyUserEditorInvitation(ctx, actor, target, invitation, "decline", invitation.InvitedBy, target.ID)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+// CancelUserEditorInvitation: withdraw a pending invitation before the invitee has accepted it
+func (m *Mutate) CancelUserEditorInvitation(ctx context.Context, ub *structures.UserBuilder, opt UserEditorInvitationOptions) error {
+	if ub == nil {
+		return errors.ErrInternalIncompleteMutation()
+	} else if ub.IsTainted() {
+		return errors.ErrMutateTaintedObject()
+	}
+	if opt.Editor == nil || opt.Editor.ID.IsZero() {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify an editor")
+	}
+
+	actor := opt.Actor
+	target := &ub.User
+	if actor == nil {
+		return errors.ErrUnauthorized()
+	}
+
+	invitation, ok, _ := target.GetEditor(opt.Editor.ID)
+	if !ok || !invitation.Pending {
+		return errors.ErrInvalidRequest().SetDetail("There is no pending editor invitation for this user")
+	}
+	// The inviter may always cancel their own invitation
+	if invitation.InvitedBy != actor.ID && !canManageUserEditors(actor, target) {
+		return errors.ErrInsufficientPrivilege().SetDetail("You are not permitted to cancel this editor invitation")
+	}
+
+	ub.RemoveEditor(opt.Editor.ID)
+	if err := m.writeUserEditors(ctx, ub, bson.M{"_id": target.ID}); err != nil {
+		return err
+	}
+
+	m.logUserEditor(ctx, structures.AuditLogKindRemoveEditorInvitation, actor.ID, target.ID, &invitation, nil)
+	m.notifyUserEditorInvitation(ctx, actor, target, invitation, "cancel", opt.Editor.ID)
+
+	ub.MarkAsTainted()
+	return nil
+}
+
+// ExpireUserEditorInvitations: remove pending editor invitations which can no longer be accepted
+//
+// Returns the amount of invitations removed
+func (m *Mutate) ExpireUserEditorInvitations(ctx context.Context) (int, error) {
+	now := time.Now()
+	expired := bson.M{"pending": true, "expire_at": bson.M{"$lte": now}}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameUsers).Find(ctx, bson.M{
+		"editors": bson.M{"$elemMatch": expired},
+	}, options.Find().SetProjection(bson.M{"editors": 1}))
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	defer cur.Close(ctx)
+
+	count := 0
+	for cur.Next(ctx) {
+		user := structures.User{}
+		if err = cur.Decode(&user); err != nil {
+			return count, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		if _, err = m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+			"$pull": bson.M{"editors": expired},
+		}); err != nil {
+			return count, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		for _, ed := range user.Editors {
+			if !ed.Pending || ed.ExpireAt.IsZero() || ed.ExpireAt.After(now) {
+				continue
+			}
+
+			ed := ed
+			m.logUserEditor(ctx, structures.AuditLogKindRemoveEditorInvitation, primitive.NilObjectID, user.ID, &ed, nil)
+			count++
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return count, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return count, nil
+}
+
+type UserEditorInvitationOptions struct {
+	Actor *structures.User
+	// The user who is invited to be an editor
+	Editor *structures.User
+	// The permissions the editor will have once they accept
+	Permissions structures.UserEditorPermission
+	// Whether or not the editor will be visible on the user's profile page
+	Visible bool
+	// The connections the editor's permissions will be limited to
+	Connections []string
+	// The emote sets the editor's permissions will be limited to
+	EmoteSets []primitive.ObjectID
+	// How long the invitation stays valid for. Defaults to USER_EDITOR_INVITATION_EXPIRY
+	Expiry time.Duration
+}
+
+// canManageUserEditors returns whether the actor is the target user,
+// an editor of the target user with the "manage editors" permission, or privileged
+func canManageUserEditors(actor *structures.User, target *structures.User) bool {
+	if actor.ID == target.ID || actor.HasPermission(structures.RolePermissionManageUsers) {
+		return true
+	}
+
+	ed, ok, _ := target.GetEditor(actor.ID)
+	return ok && ed.HasPermission(structures.UserEditorPermissionManageEditors)
+}
+
+func (m *Mutate) writeUserEditors(ctx context.Context, ub *structures.UserBuilder, filter bson.M) error {
+	if err := m.mongo.Collection(mongo.CollectionNameUsers).FindOneAndUpdate(
+		ctx,
+		filter,
+		ub.Update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&ub.User); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.ErrUnknownUser().SetDetail("The user's editors changed in the meantime")
+		}
+		zap.S().Errorw("mongo, couldn't update user editors",
+			"error", err,
+			"user_id", ub.User.ID.Hex(),
+		)
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	return nil
+}
+
+// logUserEditor writes an audit log entry for a change to a user's editors
+//
+// The old value is nil when an editor is added, and the new value is nil when an editor is removed
+func (m *Mutate) logUserEditor(
+	ctx context.Context,
+	kind structures.AuditLogKind,
+	actorID primitive.ObjectID,
+	targetID primitive.ObjectID,
+	old, new *structures.UserEditor,
+) {
+	c := structures.AuditLogChange{
+		Key:    "editors",
+		Format: structures.AuditLogChangeFormatArrayChange,
+	}
+	switch {
+	case old == nil:
+		c.WriteArrayAdded(*new)
+	case new == nil:
+		c.WriteArrayRemoved(*old)
+	default:
+		c.WriteArrayUpdated(structures.AuditLogChangeSingleValue{
+			New: *new,
+			Old: *old,
+		})
+	}
+
+	log := structures.NewAuditLogBuilder(structures.AuditLog{}).
+		SetKind(kind).
+		SetActor(actorID).
+		SetTargetKind(structures.ObjectKindUser).
+		SetTargetID(targetID).
+		AddChanges(&c)
+	if _, err := m.mongo.Collection(mongo.CollectionNameAuditLogs).InsertOne(ctx, log.AuditLog); err != nil {
+		zap.S().Errorw("mongo, failed to write audit log entry for user editor",
+			"error", err,
+			"user_id", targetID.Hex(),
+		)
+	}
+}
+
+// notifyUserEditorInvitation sends an inbox message about an editor invitation to the recipients
+func (m *Mutate) notifyUserEditorInvitation(
+	ctx context.Context,
+	actor *structures.User,
+	target *structures.User,
+	invitation structures.UserEditor,
+	action string,
+	recipients ...primitive.ObjectID,
+) {
+	mb := structures.NewMessageBuilder(structures.Message[structures.MessageDataInbox]{}).
+		SetKind(structures.MessageKindInbox).
+		SetAuthorID(actor.ID).
+		SetTimestamp(time.Now()).
+		SetData(structures.MessageDataInbox{
+			Subject: "inbox.generic.editor_invitation." + action + ".subject",
+			Content: "inbox.generic.editor_invitation." + action + ".content",
+			Locale:  true,
+			Placeholders: map[string]string{
+				"USER_DISPLAY_NAME":  utils.Ternary(target.DisplayName != "", target.DisplayName, target.Username),
+				"USER_ID":            target.ID.Hex(),
+				"ACTOR_DISPLAY_NAME": utils.Ternary(actor.DisplayName != "", actor.DisplayName, actor.Username),
+				"EDITOR_PERMISSIONS": strconv.Itoa(int(invitation.Permissions)),
+				"EXPIRE_AT":          invitation.ExpireAt.Format(time.RFC822),
+			},
+		})
+	if err := m.SendInboxMessage(ctx, mb, SendInboxMessageOptions{
+		Actor:                actor,
+		Recipients:           recipients,
+		ConsiderBlockedUsers: true,
+	}); err != nil {
+		zap.S().Errorw("failed to send inbox message about editor invitation",
+			"error", err,
+			"action", action,
+			"actor_id", actor.ID.Hex(),
+			"user_id", target.ID.Hex(),
+		)
+	}
+}
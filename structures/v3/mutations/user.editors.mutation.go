@@ -6,7 +6,9 @@ import (
 	"github.com/seventv/common/errors"
 	"github.com/seventv/common/mongo"
 	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (m *Mutate) ModifyUserEditors(ctx context.Context, ub *structures.UserBuilder, opt UserEditorsOptions) error {
@@ -40,14 +42,50 @@ func (m *Mutate) ModifyUserEditors(ctx context.Context, ub *structures.UserBuild
 		}
 	}
 
+	old, exists, _ := target.GetEditor(editor.ID)
+	logKind := structures.AuditLogKindAddUserEditor
+
 	switch opt.Action {
 	// add editor
 	case structures.ListItemActionAdd:
+		// Unless privileged, editors are invited and must accept before being added
+		if !actor.HasPermission(structures.RolePermissionManageUsers) {
+			return m.InviteUserEditor(ctx, ub, UserEditorInvitationOptions{
+				Actor:       actor,
+				Editor:      editor,
+				Permissions: opt.EditorPermissions,
+				Visible:     opt.EditorVisible,
+				Connections: opt.EditorConnections,
+				EmoteSets:   opt.EditorEmoteSets,
+			})
+		}
+		if exists {
+			return errors.ErrInvalidRequest().SetDetail("Target user is already an editor")
+		}
+		if err := m.checkEditorScope(ctx, &target, opt.EditorConnections, opt.EditorEmoteSets); err != nil {
+			return err
+		}
 		ub.AddEditor(editor.ID, opt.EditorPermissions, opt.EditorVisible)
+		ub.SetEditorScope(editor.ID, opt.EditorConnections, opt.EditorEmoteSets)
 	case structures.ListItemActionUpdate:
+		if !exists {
+			return errors.ErrUnknownUser().SetDetail("Target user is not an editor")
+		}
+		if err := checkEditorGrant(actor, &target, opt.EditorPermissions, opt.EditorConnections, opt.EditorEmoteSets); err != nil {
+			return err
+		}
+		if err := m.checkEditorScope(ctx, &target, opt.EditorConnections, opt.EditorEmoteSets); err != nil {
+			return err
+		}
 		ub.UpdateEditor(editor.ID, opt.EditorPermissions, opt.EditorVisible)
+		ub.SetEditorScope(editor.ID, opt.EditorConnections, opt.EditorEmoteSets)
+		logKind = structures.AuditLogKindEditUser
 	case structures.ListItemActionRemove:
+		if !exists {
+			return errors.ErrUnknownUser().SetDetail("Target user is not an editor")
+		}
 		ub.RemoveEditor(editor.ID)
+		logKind = structures.AuditLogKindRemoveUserEditor
 	}
 
 	// Write mutation
@@ -57,6 +95,17 @@ func (m *Mutate) ModifyUserEditors(ctx context.Context, ub *structures.UserBuild
 		return errors.ErrInternalServerError().SetDetail(err.Error())
 	}
 
+	switch opt.Action {
+	case structures.ListItemActionAdd:
+		added, _, _ := ub.User.GetEditor(editor.ID)
+		m.logUserEditor(ctx, logKind, actor.ID, target.ID, nil, &added)
+	case structures.ListItemActionUpdate:
+		updated, _, _ := ub.User.GetEditor(editor.ID)
+		m.logUserEditor(ctx, logKind, actor.ID, target.ID, &old, &updated)
+	case structures.ListItemActionRemove:
+		m.logUserEditor(ctx, logKind, actor.ID, target.ID, &old, nil)
+	}
+
 	ub.MarkAsTainted()
 	return nil
 }
@@ -66,5 +115,92 @@ type UserEditorsOptions struct {
 	Editor            *structures.User
 	EditorPermissions structures.UserEditorPermission
 	EditorVisible     bool
-	Action            structures.ListItemAction
+	// The connections the editor's permissions are limited to. Updating an editor replaces their scope
+	EditorConnections []string
+	// The emote sets the editor's permissions are limited to
+	EditorEmoteSets []primitive.ObjectID
+	Action          structures.ListItemAction
+}
+
+// checkEditorGrant: editors who manage the user's editors may not grant permissions or a scope beyond their own
+func checkEditorGrant(
+	actor *structures.User,
+	target *structures.User,
+	permissions structures.UserEditorPermission,
+	connections []string,
+	emoteSets []primitive.ObjectID,
+) error {
+	if actor.ID == target.ID || actor.HasPermission(structures.RolePermissionManageUsers) {
+		return nil
+	}
+
+	ed, _, _ := target.GetEditor(actor.ID)
+	if missing := permissions &^ ed.Permissions; missing != 0 {
+		return errors.ErrInsufficientPrivilege().
+			SetDetail("You cannot grant editor permissions you don't have").
+			SetFields(errors.Fields{"MISSING_EDITOR_PERMISSIONS": int32(missing)})
+	}
+	if !ed.IsScoped() {
+		return nil
+	}
+
+	if len(connections) == 0 && len(emoteSets) == 0 {
+		return errors.ErrInsufficientPrivilege().SetDetail("You cannot grant editor permissions beyond your own scope")
+	}
+	for _, id := range connections {
+		if !ed.HasConnectionPermission(structures.UserEditorPermissionManageEditors, id) {
+			return errors.ErrInsufficientPrivilege().
+				SetDetail("You cannot grant editor permissions beyond your own scope").
+				SetFields(errors.Fields{"CONNECTION_ID": id})
+		}
+	}
+	for _, id := range emoteSets {
+		if !ed.HasEmoteSetPermission(structures.UserEditorPermissionManageEditors, id, target.Connections) {
+			return errors.ErrInsufficientPrivilege().
+				SetDetail("You cannot grant editor permissions beyond your own scope").
+				SetFields(errors.Fields{"EMOTE_SET_ID": id.Hex()})
+		}
+	}
+
+	return nil
+}
+
+// checkEditorScope: the connections and emote sets an editor is scoped to must belong to the user
+func (m *Mutate) checkEditorScope(ctx context.Context, target *structures.User, connections []string, emoteSets []primitive.ObjectID) error {
+	for _, id := range connections {
+		found := false
+		for _, conn := range target.Connections {
+			if conn.ID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.ErrUnknownUserConnection().SetFields(errors.Fields{"CONNECTION_ID": id})
+		}
+	}
+
+	if len(emoteSets) == 0 {
+		return nil
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, id := range emoteSets {
+		if !utils.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	count, err := m.mongo.Collection(mongo.CollectionNameEmoteSets).CountDocuments(ctx, bson.M{
+		"_id":      bson.M{"$in": ids},
+		"owner_id": target.ID,
+	})
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if count != int64(len(ids)) {
+		return errors.ErrUnknownEmoteSet().SetDetail("The editor's emote sets must be owned by the user")
+	}
+
+	return nil
 }
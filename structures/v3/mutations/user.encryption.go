@@ -0,0 +1,98 @@
+package mutations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// ReencryptUsers: rewrite the encrypted fields of users which are stored as plaintext,
+// or were encrypted with a master key other than the active one
+//
+// This includes the emails of Twitch connections.
+// The mongo instance must be set up with a keyring whose active key is the one specified.
+// Returns the amount of users rewritten
+func (m *Mutate) ReencryptUsers(ctx context.Context, opt ReencryptUsersOptions) (int, error) {
+	if opt.KeyID == "" {
+		return 0, errors.ErrMissingRequiredField().SetDetail("Did not specify the active key ID")
+	}
+
+	outdated := func(field string) bson.A {
+		return bson.A{
+			bson.M{field: bson.M{"$type": "string", "$ne": ""}},
+			bson.M{field + ".kid": bson.M{"$exists": true, "$ne": opt.KeyID}},
+		}
+	}
+
+	or := outdated("email")
+	for _, f := range []string{"grant.access_token", "grant.refresh_token", "data.email"} {
+		for _, cond := range outdated(f) {
+			or = append(or, bson.M{"connections": bson.M{"$elemMatch": cond}})
+		}
+	}
+
+	cur, err := m.mongo.Collection(mongo.CollectionNameUsers).Find(ctx, bson.M{"$or": or})
+	if err != nil {
+		return 0, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	defer cur.Close(ctx)
+
+	count := 0
+	for cur.Next(ctx) {
+		user := structures.User{}
+		if err = cur.Decode(&user); err != nil {
+			zap.S().Errorw("failed to decrypt user during re-encryption",
+				"error", err,
+				"user_id", cur.Current.Lookup("_id").ObjectID().Hex(),
+			)
+			continue
+		}
+
+		// Writing the decrypted values back encrypts them with the active key
+		filter := bson.M{"_id": user.ID}
+		set := bson.M{"email": user.Email}
+		for i, conn := range user.Connections {
+			// Guard against the connections having changed in the meantime
+			filter[fmt.Sprintf("connections.%d.id", i)] = conn.ID
+
+			if conn.Grant != nil {
+				set[fmt.Sprintf("connections.%d.grant", i)] = conn.Grant
+			}
+
+			// The data is kept raw when decoding the user, so it must be converted to be encrypted again
+			if conn.Platform == structures.UserConnectionPlatformTwitch {
+				if c, err := structures.ConvertUserConnection[structures.UserConnectionDataTwitch](conn); err == nil {
+					set[fmt.Sprintf("connections.%d.data", i)] = c.ToRaw().Data
+				}
+			}
+		}
+
+		res, err := m.mongo.Collection(mongo.CollectionNameUsers).UpdateOne(ctx, filter, bson.M{"$set": set})
+		if err != nil {
+			return count, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		if res.MatchedCount == 0 {
+			zap.S().Warnw("user changed during re-encryption, skipping",
+				"user_id", user.ID.Hex(),
+			)
+			continue
+		}
+
+		count++
+	}
+	if err = cur.Err(); err != nil {
+		return count, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return count, nil
+}
+
+type ReencryptUsersOptions struct {
+	// The ID of the active master key
+	KeyID string
+}
@@ -19,17 +19,20 @@ func (m *Mutate) SetRole(ctx context.Context, ub *structures.UserBuilder, opt Se
 	}
 
 	// Check for actor's permission to do this
-	actor := opt.Actor
-	if actor != nil {
-		if !actor.HasPermission(structures.RolePermissionManageRoles) {
-			return structures.ErrInsufficientPrivilege
-		}
-		if len(actor.Roles) == 0 {
-			return structures.ErrInsufficientPrivilege
-		}
-		highestRole := actor.Roles[0]
-		if opt.Role.Position >= highestRole.Position {
-			return structures.ErrInsufficientPrivilege
+	if opt.Role == nil {
+		return errors.ErrMissingRequiredField().SetDetail("Did not specify a role")
+	}
+
+	auth, err := authorizeRoles(opt.Actor)
+	if err != nil {
+		return err
+	}
+	if err = auth.CanManage(*opt.Role); err != nil {
+		return err
+	}
+	if opt.Action == structures.ListItemActionAdd {
+		if err = auth.CanGrant(opt.Role.Allowed); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,213 @@
+package structures
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/seventv/common/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ConnectionPlatform describes a platform users may link connections from
+type ConnectionPlatform struct {
+	Platform UserConnectionPlatform
+	// Human-readable name of the platform
+	Name string
+
+	dataType    reflect.Type
+	validate    func(bson.Raw) error
+	displayName func(bson.Raw) string
+	profileURL  func(bson.Raw) string
+}
+
+// ConnectionPlatformDefinition defines the behavior of a platform for its connection data type
+type ConnectionPlatformDefinition[D UserConnectionData] struct {
+	// Human-readable name of the platform
+	Name string
+	// Validate checks the connection data
+	Validate func(D) error
+	// DisplayName returns the name of the account on the platform
+	DisplayName func(D) string
+	// ProfileURL returns the link to the account on the platform
+	ProfileURL func(D) string
+}
+
+var connectionPlatforms = map[UserConnectionPlatform]*ConnectionPlatform{}
+
+// RegisterConnectionPlatform adds a platform to the registry, along with its connection data type
+func RegisterConnectionPlatform[D UserConnectionData](p UserConnectionPlatform, def ConnectionPlatformDefinition[D]) *ConnectionPlatform {
+	decode := func(raw bson.Raw) (D, error) {
+		var d D
+		err := bson.Unmarshal(raw, &d)
+		return d, err
+	}
+
+	cp := &ConnectionPlatform{
+		Platform: p,
+		Name:     def.Name,
+		dataType: reflect.TypeOf((*D)(nil)).Elem(),
+		validate: func(raw bson.Raw) error {
+			d, err := decode(raw)
+			if err != nil {
+				return errors.ErrValidationRejected().SetDetail("Malformed %s connection data: %s", def.Name, err.Error())
+			}
+			if def.Validate == nil {
+				return nil
+			}
+			return def.Validate(d)
+		},
+		displayName: func(raw bson.Raw) string {
+			d, err := decode(raw)
+			if err != nil || def.DisplayName == nil {
+				return ""
+			}
+			return def.DisplayName(d)
+		},
+		profileURL: func(raw bson.Raw) string {
+			d, err := decode(raw)
+			if err != nil || def.ProfileURL == nil {
+				return ""
+			}
+			return def.ProfileURL(d)
+		},
+	}
+
+	connectionPlatforms[p] = cp
+	return cp
+}
+
+// GetConnectionPlatform returns a registered platform
+func GetConnectionPlatform(p UserConnectionPlatform) (*ConnectionPlatform, bool) {
+	cp, ok := connectionPlatforms[p]
+	return cp, ok
+}
+
+// ConnectionPlatforms returns all registered platforms, sorted by their identifier
+func ConnectionPlatforms() []UserConnectionPlatform {
+	result := make([]UserConnectionPlatform, 0, len(connectionPlatforms))
+	for p := range connectionPlatforms {
+		result = append(result, p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
+
+// connectionPlatformOf returns the platform whose connection data is of the type D
+func connectionPlatformOf[D UserConnectionData]() (UserConnectionPlatform, bool) {
+	t := reflect.TypeOf((*D)(nil)).Elem()
+	for _, p := range ConnectionPlatforms() {
+		if connectionPlatforms[p].dataType == t {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// Validate checks the data of a connection to the platform
+func (cp *ConnectionPlatform) Validate(data bson.Raw) error {
+	return cp.validate(data)
+}
+
+// DisplayName returns the name of the account a connection links to
+func (cp *ConnectionPlatform) DisplayName(data bson.Raw) string {
+	return cp.displayName(data)
+}
+
+// ProfileURL returns the link to the account a connection links to
+func (cp *ConnectionPlatform) ProfileURL(data bson.Raw) string {
+	return cp.profileURL(data)
+}
+
+// ByPlatform returns the first connection to the platform of the data type D
+func ByPlatform[D UserConnectionData](ucl UserConnectionList) (UserConnection[D], int, error) {
+	p, ok := connectionPlatformOf[D]()
+	if !ok {
+		return UserConnection[D]{}, -1, fmt.Errorf("no platform is registered for %T", *new(D))
+	}
+
+	for idx, v := range ucl {
+		if v.Platform == p {
+			conn, err := ConvertUserConnection[D](v)
+			return conn, idx, err
+		}
+	}
+
+	return UserConnection[D]{}, -1, fmt.Errorf("could not find any %s connections", connectionPlatforms[p].Name)
+}
+
+var (
+	ConnectionPlatformTwitch = RegisterConnectionPlatform(UserConnectionPlatformTwitch, ConnectionPlatformDefinition[UserConnectionDataTwitch]{
+		Name: "Twitch",
+		Validate: func(d UserConnectionDataTwitch) error {
+			if d.ID == "" || d.Login == "" {
+				return errors.ErrValidationRejected().SetDetail("Twitch connection must have an ID and login")
+			}
+			return nil
+		},
+		DisplayName: func(d UserConnectionDataTwitch) string {
+			return d.DisplayName
+		},
+		ProfileURL: func(d UserConnectionDataTwitch) string {
+			return "https://twitch.tv/" + d.Login
+		},
+	})
+
+	ConnectionPlatformYouTube = RegisterConnectionPlatform(UserConnectionPlatformYouTube, ConnectionPlatformDefinition[UserConnectionDataYoutube]{
+		Name: "YouTube",
+		Validate: func(d UserConnectionDataYoutube) error {
+			if d.ID == "" {
+				return errors.ErrValidationRejected().SetDetail("YouTube connection must have a channel ID")
+			}
+			return nil
+		},
+		DisplayName: func(d UserConnectionDataYoutube) string {
+			return d.Title
+		},
+		ProfileURL: func(d UserConnectionDataYoutube) string {
+			return "https://www.youtube.com/channel/" + d.ID
+		},
+	})
+
+	ConnectionPlatformKick = RegisterConnectionPlatform(UserConnectionPlatformKick, ConnectionPlatformDefinition[UserConnectionDataKick]{
+		Name: "Kick",
+		Validate: func(d UserConnectionDataKick) error {
+			if d.ID == "" || d.Username == "" {
+				return errors.ErrValidationRejected().SetDetail("Kick connection must have an ID and username")
+			}
+			return nil
+		},
+		DisplayName: func(d UserConnectionDataKick) string {
+			if d.DisplayName != "" {
+				return d.DisplayName
+			}
+			return d.Username
+		},
+		ProfileURL: func(d UserConnectionDataKick) string {
+			return "https://kick.com/" + d.Username
+		},
+	})
+
+	ConnectionPlatformDiscord = RegisterConnectionPlatform(UserConnectionPlatformDiscord, ConnectionPlatformDefinition[UserConnectionDataDiscord]{
+		Name: "Discord",
+		Validate: func(d UserConnectionDataDiscord) error {
+			if d.ID == "" || d.Username == "" {
+				return errors.ErrValidationRejected().SetDetail("Discord connection must have an ID and username")
+			}
+			return nil
+		},
+		DisplayName: func(d UserConnectionDataDiscord) string {
+			if d.GlobalName != "" {
+				return d.GlobalName
+			}
+			return d.Username
+		},
+		ProfileURL: func(d UserConnectionDataDiscord) string {
+			return "https://discord.com/users/" + d.ID
+		},
+	})
+)
@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/seventv/common/errors"
 	"github.com/seventv/common/mongo"
 	"github.com/seventv/common/structures/v3"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func (q *Query) Bans(ctx context.Context, opt BanQueryOptions) (*BanQueryResult, error) {
@@ -33,7 +35,7 @@ func (q *Query) Bans(ctx context.Context, opt BanQueryOptions) (*BanQueryResult,
 		hs = hex.EncodeToString(h.Sum(nil))
 	}
 	k := q.key(fmt.Sprintf("bans:%s", hs))
-	filter["expire_at"] = bson.M{"$gt": time.Now()}
+	filter = bson.M{"$and": bson.A{filter, structures.ActiveBanFilter(time.Now())}}
 
 	r := &BanQueryResult{
 		All:           []structures.Ban{},
@@ -133,3 +135,55 @@ func (bm BanMap) KeySlice() []primitive.ObjectID {
 	}
 	return v
 }
+
+// UserBanHistory: list all bans ever issued against a user, newest first
+//
+// Expired and revoked bans are included. The actors are resolved
+func (q *Query) UserBanHistory(ctx context.Context, userID primitive.ObjectID) ([]structures.Ban, error) {
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameBans).Find(ctx, bson.M{
+		"victim_id": userID,
+	}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	bans := []structures.Ban{}
+	if err = cur.All(ctx, &bans); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(bans) == 0 {
+		return bans, nil
+	}
+
+	// Resolve actors
+	actorIDs := []primitive.ObjectID{}
+	for _, b := range bans {
+		if !b.ActorID.IsZero() {
+			actorIDs = append(actorIDs, b.ActorID)
+		}
+	}
+	if len(actorIDs) == 0 {
+		return Enforce(be, bans), nil
+	}
+
+	users, err := q.Users(ctx, bson.M{"_id": bson.M{"$in": actorIDs}}).Items()
+	if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+		return nil, err
+	}
+	userMap := make(map[primitive.ObjectID]structures.User, len(users))
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+	for i, b := range bans {
+		if u, ok := userMap[b.ActorID]; ok {
+			bans[i].Actor = &u
+		}
+	}
+
+	return Enforce(be, bans), nil
+}
@@ -0,0 +1,203 @@
+package query
+
+import (
+	"context"
+
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BanEnforcer applies the effects of the bans currently in effect to query results
+//
+// Queries should use it rather than reading the ban maps themselves, so that the effects are applied consistently
+type BanEnforcer struct {
+	bans     *BanQueryResult
+	byVictim map[primitive.ObjectID][]structures.Ban
+}
+
+// BanEnforcer returns an enforcer for the bans currently in effect
+func (q *Query) BanEnforcer(ctx context.Context) (*BanEnforcer, error) {
+	bans, err := q.Bans(ctx, BanQueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	byVictim := make(map[primitive.ObjectID][]structures.Ban)
+	for _, b := range bans.All {
+		byVictim[b.VictimID] = append(byVictim[b.VictimID], b)
+	}
+
+	return &BanEnforcer{
+		bans:     bans,
+		byVictim: byVictim,
+	}, nil
+}
+
+// Bans returns the bans currently in effect
+func (be *BanEnforcer) Bans() *BanQueryResult {
+	return be.bans
+}
+
+// IsMemoryHoled returns whether or not the user is hidden from results
+func (be *BanEnforcer) IsMemoryHoled(userID primitive.ObjectID) bool {
+	_, ok := be.bans.MemoryHole[userID]
+	return ok
+}
+
+// OwnsNothing returns whether or not the user's objects are hidden from results
+func (be *BanEnforcer) OwnsNothing(userID primitive.ObjectID) bool {
+	_, ok := be.bans.NoOwnership[userID]
+	return ok
+}
+
+// NoOwnershipCondition returns a condition on an owner ID field, omitting users banned with the no ownership effect
+func (be *BanEnforcer) NoOwnershipCondition() bson.M {
+	return bson.M{"$not": bson.M{"$in": be.bans.NoOwnership.KeySlice()}}
+}
+
+// MemoryHoleCondition returns a condition on a user ID field, omitting users in the memory hole
+func (be *BanEnforcer) MemoryHoleCondition() bson.M {
+	return bson.M{"$not": bson.M{"$in": be.bans.MemoryHole.KeySlice()}}
+}
+
+// EditorsStage returns a pipeline stage removing memory holed editors from user documents
+func (be *BanEnforcer) EditorsStage() bson.D {
+	return bson.D{{
+		Key: "$set",
+		Value: bson.M{
+			"editors": bson.M{"$filter": bson.M{
+				"input": "$editors",
+				"as":    "e",
+				"cond":  bson.M{"$not": bson.M{"$in": bson.A{"$$e.id", be.bans.MemoryHole.KeySlice()}}},
+			}},
+		},
+	}}
+}
+
+// Emote applies the effects to an emote, and returns false if the emote must be omitted
+//
+// The owner of an emote is removed if they are in the memory hole
+func (be *BanEnforcer) Emote(e *structures.Emote) bool {
+	if be.OwnsNothing(e.OwnerID) {
+		return false
+	}
+	if be.IsMemoryHoled(e.OwnerID) {
+		e.OwnerID = primitive.NilObjectID
+		e.Owner = nil
+	}
+	return true
+}
+
+// User applies the effects to a user
+//
+// The user's active bans are attached, so that their permissions are revoked if banned with the no permissions effect
+func (be *BanEnforcer) User(u *structures.User) {
+	u.Bans = be.byVictim[u.ID]
+
+	if len(u.Editors) > 0 {
+		editors := make([]structures.UserEditor, 0, len(u.Editors))
+		for _, ed := range u.Editors {
+			if !be.IsMemoryHoled(ed.ID) {
+				editors = append(editors, ed)
+			}
+		}
+		u.Editors = editors
+	}
+}
+
+// Message applies the effects to a message
+//
+// The author of a message is removed if they are in the memory hole
+func (be *BanEnforcer) Message(msg *structures.Message[bson.Raw]) {
+	if be.IsMemoryHoled(msg.AuthorID) {
+		msg.AuthorID = primitive.NilObjectID
+		msg.Author = nil
+	}
+}
+
+// EmoteSet applies the effects to an emote set
+//
+// Emotes whose owner is banned with the no ownership effect are unbound from the set
+func (be *BanEnforcer) EmoteSet(s *structures.EmoteSet) {
+	if s.Owner != nil {
+		be.User(s.Owner)
+	}
+
+	for i, ae := range s.Emotes {
+		if ae.Emote != nil && !be.Emote(ae.Emote) {
+			s.Emotes[i].Emote = nil
+		}
+	}
+}
+
+// Report applies the effects to a report, and returns false if the report must be omitted
+//
+// Reports created by users in the memory hole are omitted
+func (be *BanEnforcer) Report(r *structures.Report) bool {
+	if be.IsMemoryHoled(r.ReporterID) {
+		return false
+	}
+
+	if r.Reporter != nil {
+		be.User(r.Reporter)
+	}
+	if r.Target != nil {
+		be.User(r.Target)
+	}
+	if r.TargetEmote != nil && !be.Emote(r.TargetEmote) {
+		r.TargetEmote = nil
+	}
+	for i := range r.Assignees {
+		be.User(&r.Assignees[i])
+	}
+	return true
+}
+
+// Ban applies the effects to a ban
+//
+// The actor of a ban is removed if they are in the memory hole
+func (be *BanEnforcer) Ban(b *structures.Ban) {
+	if be.IsMemoryHoled(b.ActorID) {
+		b.ActorID = primitive.NilObjectID
+		b.Actor = nil
+	}
+}
+
+// Enforce applies the effects to a list of query results, omitting the items which must be hidden
+//
+// The items are filtered in place
+func Enforce[T any](be *BanEnforcer, items []T) []T {
+	if be == nil {
+		return items
+	}
+
+	result := items[:0]
+	for i := range items {
+		if be.apply(&items[i]) {
+			result = append(result, items[i])
+		}
+	}
+	return result
+}
+
+// apply applies the effects to a single item, and returns false if the item must be omitted
+func (be *BanEnforcer) apply(v any) bool {
+	switch x := v.(type) {
+	case *structures.User:
+		be.User(x)
+	case *structures.Emote:
+		return be.Emote(x)
+	case *structures.EmoteSet:
+		be.EmoteSet(x)
+	case *structures.Message[bson.Raw]:
+		be.Message(x)
+	case *structures.Report:
+		return be.Report(x)
+	case *structures.Ban:
+		be.Ban(x)
+	case *structures.UserEditor:
+		return !be.IsMemoryHoled(x.ID)
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package query
 
 import (
 	"context"
+	"time"
 
 	"github.com/seventv/common/structures/v3"
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,14 +24,24 @@ func (qb *QueryBinder) MapUsers(users []structures.User, roleEnts ...structures.
 		m[v.ID] = v
 	}
 
-	m2 := make(map[primitive.ObjectID][]primitive.ObjectID)
+	m2 := make(map[primitive.ObjectID][]structures.Entitlement[structures.EntitlementDataRole])
 	for _, ent := range roleEnts {
 		ent, err := structures.ConvertEntitlement[structures.EntitlementDataRole](ent)
 		if err != nil {
 			return nil, err
 		}
 
-		m2[ent.UserID] = append(m2[ent.UserID], ent.Data.ObjectReference)
+		m2[ent.UserID] = append(m2[ent.UserID], ent)
+	}
+
+	// Apply ban effects
+	be, err := qb.q.BanEnforcer(qb.ctx)
+	if err != nil {
+		return nil, err
+	}
+	for key, u := range m {
+		be.User(&u)
+		m[key] = u
 	}
 
 	roles, _ := qb.q.Roles(qb.ctx, bson.M{})
@@ -43,17 +54,15 @@ func (qb *QueryBinder) MapUsers(users []structures.User, roleEnts ...structures.
 			}
 			roleMap[r.ID] = r
 		}
+
+		now := time.Now()
 		for key, u := range m {
-			roleIDs := make([]primitive.ObjectID, len(m2[u.ID])+len(u.RoleIDs)+1)
-			if defaultRole.ID.IsZero() {
-				roleIDs[0] = structures.NilRole.ID
-			} else {
-				roleIDs[0] = defaultRole.ID
-			}
+			base := make([]primitive.ObjectID, len(u.RoleIDs)+1)
+			base[0] = defaultRole.ID
+			copy(base[1:], u.RoleIDs)
 
-			roleIDs[0] = defaultRole.ID
-			copy(roleIDs[1:], u.RoleIDs)
-			copy(roleIDs[len(u.RoleIDs)+1:], m2[u.ID])
+			// Add the roles granted by entitlements whose conditions are met
+			roleIDs := structures.ResolveEntitledRoles(base, m2[u.ID], now)
 
 			u.Roles = make([]structures.Role, len(roleIDs)) // allocate space on the user's roles slice
 			for i, roleID := range roleIDs {
@@ -0,0 +1,237 @@
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const COSMETICS_EXPORT_CACHE_TTL = time.Minute * 5
+
+// Cosmetics: list badges and paints, with the users entitled to them
+//
+// Only entitlements currently in effect count towards a cosmetic's users
+func (q *Query) Cosmetics(ctx context.Context, opt CosmeticsQueryOptions) ([]structures.Cosmetic[bson.Raw], error) {
+	filter := bson.M{}
+	if len(opt.Kinds) > 0 {
+		filter["kind"] = bson.M{"$in": opt.Kinds}
+	}
+	if len(opt.IDs) > 0 {
+		filter["_id"] = bson.M{"$in": opt.IDs}
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameCosmetics).Find(ctx, filter, options.Find().SetSort(bson.D{
+		{Key: "priority", Value: -1},
+		{Key: "name", Value: 1},
+	}))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	result := []structures.Cosmetic[bson.Raw]{}
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(result))
+	for i, c := range result {
+		ids[i] = c.ID
+	}
+
+	holders, err := q.cosmeticHolders(ctx, ids, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve users
+	userMap := map[primitive.ObjectID]structures.User{}
+	if opt.ResolveUsers {
+		userIDs := []primitive.ObjectID{}
+		for _, l := range holders {
+			userIDs = append(userIDs, l...)
+		}
+		if len(userIDs) > 0 {
+			users, err := q.Users(ctx, bson.M{"_id": bson.M{"$in": userIDs}}).Items()
+			if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+				return nil, err
+			}
+			for _, u := range users {
+				userMap[u.ID] = u
+			}
+		}
+	}
+
+	for i, c := range result {
+		c.UserIDs = holders[c.ID]
+		if c.UserIDs == nil {
+			c.UserIDs = []primitive.ObjectID{}
+		}
+		if opt.ResolveUsers {
+			c.Users = make([]structures.User, 0, len(c.UserIDs))
+			for _, id := range c.UserIDs {
+				if u, ok := userMap[id]; ok {
+					c.Users = append(c.Users, u)
+				}
+			}
+		}
+		result[i] = c
+	}
+
+	return result, nil
+}
+
+type CosmeticsQueryOptions struct {
+	// Only list cosmetics of these kinds
+	Kinds []structures.CosmeticKind
+	// Only list the cosmetics with these IDs
+	IDs []primitive.ObjectID
+	// Whether to resolve the user objects of the cosmetics' users
+	ResolveUsers bool
+}
+
+// CosmeticsExport: list all badges and paints, with the users who have them selected
+//
+// This is intended for clients which cache cosmetics in bulk, and is itself cached for a few minutes
+func (q *Query) CosmeticsExport(ctx context.Context) (*CosmeticsExport, error) {
+	result := &CosmeticsExport{}
+	k := q.key("cosmetics:export")
+	if q.getFromMemCache(ctx, k, result) {
+		return result, nil
+	}
+
+	cosmetics, err := q.Cosmetics(ctx, CosmeticsQueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(cosmetics))
+	for i, c := range cosmetics {
+		ids[i] = c.ID
+	}
+
+	holders, err := q.cosmeticHolders(ctx, ids, true)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Badges = []structures.Cosmetic[structures.CosmeticDataBadge]{}
+	result.Paints = []structures.Cosmetic[structures.CosmeticDataPaint]{}
+	for _, c := range cosmetics {
+		c.UserIDs = holders[c.ID]
+		if c.UserIDs == nil {
+			c.UserIDs = []primitive.ObjectID{}
+		}
+
+		switch c.Kind {
+		case structures.CosmeticKindBadge:
+			badge, err := structures.ConvertCosmetic[structures.CosmeticDataBadge](c)
+			if err != nil {
+				continue
+			}
+			badge.Data.ID = badge.ID
+			result.Badges = append(result.Badges, badge)
+		case structures.CosmeticKindNametagPaint:
+			paint, err := structures.ConvertCosmetic[structures.CosmeticDataPaint](c)
+			if err != nil {
+				continue
+			}
+			paint.Data.ID = paint.ID
+			result.Paints = append(result.Paints, paint)
+		}
+	}
+	result.GeneratedAt = time.Now()
+
+	if err = q.setInMemCache(ctx, k, result, COSMETICS_EXPORT_CACHE_TTL); err != nil {
+		zap.S().Errorw("failed to cache cosmetics export",
+			"error", err,
+			"key", k,
+		)
+	}
+
+	return result, nil
+}
+
+type CosmeticsExport struct {
+	Badges      []structures.Cosmetic[structures.CosmeticDataBadge] `json:"badges"`
+	Paints      []structures.Cosmetic[structures.CosmeticDataPaint] `json:"paints"`
+	GeneratedAt time.Time                                           `json:"generated_at"`
+}
+
+// cosmeticHolders returns the IDs of users with an entitlement in effect to each of the cosmetics
+//
+// If selectedOnly is true, only users who have the cosmetic selected are returned
+func (q *Query) cosmeticHolders(ctx context.Context, ids []primitive.ObjectID, selectedOnly bool) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+	filter := bson.M{
+		"kind":     bson.M{"$in": bson.A{structures.EntitlementKindBadge, structures.EntitlementKindPaint}},
+		"data.ref": bson.M{"$in": ids},
+		"disabled": bson.M{"$ne": true},
+	}
+	if selectedOnly {
+		filter["data.selected"] = true
+	}
+
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, filter)
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	ents := []structures.Entitlement[structures.EntitlementDataBaseSelectable]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	now := time.Now()
+
+	// Role prerequisites require the roles of the users they apply to
+	conditional := []primitive.ObjectID{}
+	for _, ent := range ents {
+		if len(ent.Condition.AnyRoles) > 0 || len(ent.Condition.AllRoles) > 0 {
+			conditional = append(conditional, ent.UserID)
+		}
+	}
+	userRoles := map[primitive.ObjectID][]primitive.ObjectID{}
+	if len(conditional) > 0 {
+		users, err := q.Users(ctx, bson.M{"_id": bson.M{"$in": conditional}}).Items()
+		if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+			return nil, err
+		}
+		for _, u := range users {
+			for _, r := range u.Roles {
+				userRoles[u.ID] = append(userRoles[u.ID], r.ID)
+			}
+		}
+	}
+
+	result := map[primitive.ObjectID][]primitive.ObjectID{}
+	seen := map[[2]primitive.ObjectID]bool{}
+	for _, ent := range ents {
+		// Users in the memory hole are hidden from the cosmetic's users
+		if be.IsMemoryHoled(ent.UserID) || !ent.IsEligible(now, userRoles[ent.UserID]) {
+			continue
+		}
+
+		key := [2]primitive.ObjectID{ent.Data.ObjectReference, ent.UserID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		result[ent.Data.ObjectReference] = append(result[ent.Data.ObjectReference], ent.UserID)
+	}
+
+	return result, nil
+}
@@ -49,18 +49,14 @@ func (q *Query) EmoteChannels(ctx context.Context, emoteID primitive.ObjectID, p
 		}
 	}
 
-	bans, err := q.Bans(ctx, BanQueryOptions{
-		Filter: bson.M{"effects": bson.M{"$bitsAllSet": structures.BanEffectMemoryHole}},
-	})
+	be, err := q.BanEnforcer(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Fetch users with this set active
 	match := bson.M{
-		"_id": bson.M{"$not": bson.M{ // Filter out users banned with memory hole effect
-			"$in": bans.MemoryHole.KeySlice(),
-		}},
+		"_id": be.MemoryHoleCondition(), // Filter out users banned with memory hole effect
 		"connections.emote_set_id": bson.M{
 			"$in": setIDs,
 		},
@@ -0,0 +1,169 @@
+package query
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const EMOTE_FLAG_QUEUE_LIMIT = 100
+
+// EmoteFlagSuggestionQueue: list the pending content flag suggestions, grouped by emote
+//
+// Groups are ordered by the amount of users who suggested flags for the emote,
+// and then by the age of the oldest suggestion
+func (q *Query) EmoteFlagSuggestionQueue(ctx context.Context, opt EmoteFlagQueueOptions) ([]EmoteFlagSuggestionGroup, error) {
+	actor := opt.Actor
+	if actor == nil || !actor.HasPermission(structures.RolePermissionEditAnyEmote) {
+		return nil, errors.ErrInsufficientPrivilege()
+	}
+
+	limit := opt.Limit
+	if limit > EMOTE_FLAG_QUEUE_LIMIT || limit < 1 {
+		limit = EMOTE_FLAG_QUEUE_LIMIT
+	}
+	page := opt.Page
+	if page < 1 {
+		page = 1
+	}
+
+	// Find the unread flag suggestions
+	cur, err := q.mongo.Collection(mongo.CollectionNameMessagesRead).Aggregate(ctx, mongo.Pipeline{
+		{{
+			Key: "$match",
+			Value: bson.M{
+				"kind": structures.MessageKindModRequest,
+				"read": bson.M{"$ne": true},
+			},
+		}},
+		{{
+			Key: "$lookup",
+			Value: mongo.Lookup{
+				From:         mongo.CollectionNameMessages,
+				LocalField:   "message_id",
+				ForeignField: "_id",
+				As:           "message",
+			},
+		}},
+		{{Key: "$unwind", Value: "$message"}},
+		{{
+			Key: "$match",
+			Value: bson.M{
+				"message.data.target_kind": structures.ObjectKindEmote,
+				"message.data.flags":       bson.M{"$bitsAnySet": structures.EmoteFlagsContent},
+			},
+		}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$message"}}},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	messages := []structures.Message[structures.MessageDataModRequest]{}
+	if err = cur.All(ctx, &messages); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	// Group the suggestions by emote, counting each user's vote once per flag
+	groups := map[primitive.ObjectID]*EmoteFlagSuggestionGroup{}
+	voters := map[primitive.ObjectID]map[primitive.ObjectID]structures.EmoteFlag{}
+	for _, msg := range messages {
+		id := msg.Data.TargetID
+		g, ok := groups[id]
+		if !ok {
+			g = &EmoteFlagSuggestionGroup{
+				EmoteID:          id,
+				Votes:            map[structures.EmoteFlag]int{},
+				FirstSuggestedAt: msg.CreatedAt,
+			}
+			groups[id] = g
+			voters[id] = map[primitive.ObjectID]structures.EmoteFlag{}
+		}
+
+		g.MessageIDs = append(g.MessageIDs, msg.ID)
+		if msg.CreatedAt.Before(g.FirstSuggestedAt) {
+			g.FirstSuggestedAt = msg.CreatedAt
+		}
+
+		voted := voters[id][msg.AuthorID]
+		for _, f := range msg.Data.Flags.ContentFlags() {
+			if voted&f == 0 {
+				g.Votes[f]++
+			}
+		}
+		voters[id][msg.AuthorID] = voted | msg.Data.Flags
+	}
+
+	result := make([]EmoteFlagSuggestionGroup, 0, len(groups))
+	for id, g := range groups {
+		g.Voters = len(voters[id])
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Voters != result[j].Voters {
+			return result[i].Voters > result[j].Voters
+		}
+		return result[i].FirstSuggestedAt.Before(result[j].FirstSuggestedAt)
+	})
+
+	// Paginate
+	start := (page - 1) * limit
+	if start >= len(result) {
+		return []EmoteFlagSuggestionGroup{}, nil
+	}
+	end := start + limit
+	if end > len(result) {
+		end = len(result)
+	}
+	result = result[start:end]
+
+	// Fetch the emotes
+	emoteIDs := make([]primitive.ObjectID, len(result))
+	for i, g := range result {
+		emoteIDs[i] = g.EmoteID
+	}
+	emotes, err := q.Emotes(ctx, bson.M{"versions.id": bson.M{"$in": emoteIDs}}).Items()
+	if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+		return nil, err
+	}
+
+	emoteMap := map[primitive.ObjectID]structures.Emote{}
+	for _, e := range emotes {
+		for _, ver := range e.Versions {
+			emoteMap[ver.ID] = e
+		}
+	}
+	for i, g := range result {
+		if e, ok := emoteMap[g.EmoteID]; ok {
+			result[i].Emote = &e
+		}
+	}
+
+	return result, nil
+}
+
+type EmoteFlagQueueOptions struct {
+	Actor *structures.User
+	Page  int
+	Limit int
+}
+
+type EmoteFlagSuggestionGroup struct {
+	// The ID of the emote version the flags were suggested for
+	EmoteID primitive.ObjectID `json:"emote_id"`
+	// The amount of users who suggested each flag
+	Votes map[structures.EmoteFlag]int `json:"votes"`
+	// The amount of distinct users who suggested flags
+	Voters int `json:"voters"`
+	// The IDs of the suggestion messages
+	MessageIDs []primitive.ObjectID `json:"message_ids"`
+	// The time at which the oldest pending suggestion was made
+	FirstSuggestedAt time.Time `json:"first_suggested_at"`
+
+	Emote *structures.Emote `json:"emote"`
+}
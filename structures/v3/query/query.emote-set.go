@@ -12,8 +12,12 @@ import (
 )
 
 func (q *Query) EmoteSets(ctx context.Context, filter bson.M) *QueryResult[structures.EmoteSet] {
-	qr := &QueryResult[structures.EmoteSet]{}
+	qr := newQueryResult[structures.EmoteSet](ctx, q)
 	items := []structures.EmoteSet{}
+	if qr.err != nil {
+		return qr
+	}
+
 	cur, err := q.mongo.Collection(mongo.CollectionNameEmoteSets).Aggregate(ctx, mongo.Pipeline{
 		{{Key: "$match", Value: filter}},
 		{{
@@ -214,9 +218,7 @@ func (q *Query) UserEmoteSets(ctx context.Context, filter bson.M) (map[primitive
 	}
 
 	// Iterate over cursor
-	bans, err := q.Bans(ctx, BanQueryOptions{ // remove emotes made by usersa who own nothing and are happy
-		Filter: bson.M{"effects": bson.M{"$bitsAnySet": structures.BanEffectNoOwnership | structures.BanEffectMemoryHole}},
-	})
+	be, err := q.BanEnforcer(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -236,12 +238,9 @@ func (q *Query) UserEmoteSets(ctx context.Context, filter bson.M) (map[primitive
 
 		emoteMap := make(map[primitive.ObjectID]structures.Emote)
 		for _, emote := range v.Emotes {
-			if _, ok := bans.NoOwnership[emote.OwnerID]; ok {
+			if !be.Emote(&emote) {
 				continue
 			}
-			if _, ok := bans.MemoryHole[emote.OwnerID]; ok {
-				emote.OwnerID = primitive.NilObjectID
-			}
 			for _, ver := range emote.Versions {
 				emote.ID = ver.ID
 
@@ -0,0 +1,102 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const EMOTE_TAGS_QUERY_LIMIT = 50
+
+// SuggestEmoteTags: autocomplete tags by prefix, ordered by usage count
+//
+// Tags are matched by their name or one of their synonyms. Blocked tags are never suggested
+func (q *Query) SuggestEmoteTags(ctx context.Context, prefix string, limit int) ([]structures.EmoteTag, error) {
+	if limit > EMOTE_TAGS_QUERY_LIMIT || limit < 1 {
+		limit = EMOTE_TAGS_QUERY_LIMIT
+	}
+
+	prefix = structures.NormalizeEmoteTag(prefix)
+	if prefix == "" {
+		return []structures.EmoteTag{}, nil
+	}
+
+	result := []structures.EmoteTag{}
+	k := q.key(fmt.Sprintf("emote-tags:suggest:%s:%d", prefix, limit))
+	if q.getFromMemCache(ctx, k, &result) {
+		return result, nil
+	}
+
+	pattern := "^" + regexp.QuoteMeta(prefix)
+	cur, err := q.mongo.Collection(mongo.CollectionNameEmoteTags).Find(ctx, bson.M{
+		"blocked": bson.M{"$ne": true},
+		"$or": bson.A{
+			bson.M{"name": bson.M{"$regex": pattern}},
+			bson.M{"synonyms": bson.M{"$regex": pattern}},
+		},
+	}, options.Find().SetSort(bson.D{{Key: "usage_count", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	if err = q.setInMemCache(ctx, k, result, time.Minute*5); err != nil {
+		zap.S().Errorw("failed to cache emote tag suggestions",
+			"error", err,
+			"key", k,
+		)
+	}
+
+	return result, nil
+}
+
+// EmoteTags: list tags in the catalog, ordered by usage count
+func (q *Query) EmoteTags(ctx context.Context, opt EmoteTagsQueryOptions) ([]structures.EmoteTag, error) {
+	limit := opt.Limit
+	if limit > EMOTE_TAGS_QUERY_LIMIT || limit < 1 {
+		limit = EMOTE_TAGS_QUERY_LIMIT
+	}
+
+	page := opt.Page
+	if page < 1 {
+		page = 1
+	}
+
+	filter := bson.M{}
+	if opt.Blocked != nil {
+		filter["blocked"] = *opt.Blocked
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameEmoteTags).Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "usage_count", Value: -1}, {Key: "name", Value: 1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	result := []structures.EmoteTag{}
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return result, nil
+}
+
+type EmoteTagsQueryOptions struct {
+	// If set, only return tags which are (or aren't) blocked
+	Blocked *bool
+	Page    int
+	Limit   int
+}
@@ -9,24 +9,20 @@ import (
 	"github.com/seventv/common/mongo"
 	"github.com/seventv/common/structures/v3"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (q *Query) Emotes(ctx context.Context, filter bson.M) *QueryResult[structures.Emote] {
-	qr := QueryResult[structures.Emote]{}
+	qr := newQueryResult[structures.Emote](ctx, q)
 	items := []structures.Emote{}
-
-	bans, err := q.Bans(ctx, BanQueryOptions{
-		Filter: bson.M{"effects": bson.M{"$bitsAnySet": structures.BanEffectNoOwnership | structures.BanEffectMemoryHole}},
-	})
-	if err != nil {
-		return qr.setError(err)
+	if qr.err != nil {
+		return qr
 	}
+	be := qr.bans
 
 	cur, err := q.mongo.Collection(mongo.CollectionNameEmotes).Aggregate(ctx, mongo.Pipeline{
 		{{
 			Key:   "$match",
-			Value: bson.M{"owner_id": bson.M{"$not": bson.M{"$in": bans.NoOwnership.KeySlice()}}},
+			Value: bson.M{"owner_id": be.NoOwnershipCondition()},
 		}},
 		{{
 			Key:   "$match",
@@ -95,10 +91,12 @@ func (q *Query) Emotes(ctx context.Context, filter bson.M) *QueryResult[structur
 	}
 
 	for _, e := range v.Emotes { // iterate over emotes
+		if !be.Emote(&e) {
+			continue
+		}
+
 		// add owner
-		if _, banned := bans.MemoryHole[e.OwnerID]; banned {
-			e.OwnerID = primitive.NilObjectID
-		} else {
+		if !e.OwnerID.IsZero() {
 			owner := ownerMap[e.OwnerID]
 			e.Owner = &owner
 		}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UserEntitlements: list the items granted to a user, with the referenced objects resolved
+//
+// Unless specified, only entitlements currently in effect for the user are returned
+func (q *Query) UserEntitlements(ctx context.Context, userID primitive.ObjectID, opt UserEntitlementsQueryOptions) (*UserEntitlements, error) {
+	cur, err := q.mongo.Collection(mongo.CollectionNameEntitlements).Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	ents := []structures.Entitlement[bson.Raw]{}
+	if err = cur.All(ctx, &ents); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	result := &UserEntitlements{
+		Entitlements: []structures.Entitlement[bson.Raw]{},
+		Roles:        []structures.Role{},
+		Badges:       []structures.Cosmetic[structures.CosmeticDataBadge]{},
+		Paints:       []structures.Cosmetic[structures.CosmeticDataPaint]{},
+		EmoteSets:    []structures.EmoteSet{},
+	}
+	if len(ents) == 0 {
+		return result, nil
+	}
+
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cosmetics of users in the memory hole are not in effect
+	hidden := !opt.IncludeInactive && be.IsMemoryHoled(userID)
+
+	// Get the user's roles to evaluate role prerequisites
+	roleIDs := []primitive.ObjectID{}
+	if !opt.IncludeInactive {
+		user, err := q.Users(ctx, bson.M{"_id": userID}).First()
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range user.Roles {
+			roleIDs = append(roleIDs, r.ID)
+		}
+	}
+
+	now := time.Now()
+	refs := map[structures.EntitlementKind][]primitive.ObjectID{}
+	for _, ent := range ents {
+		if !opt.IncludeInactive && !ent.IsEligible(now, roleIDs) {
+			continue
+		}
+		if hidden && (ent.Kind == structures.EntitlementKindBadge || ent.Kind == structures.EntitlementKindPaint) {
+			continue
+		}
+
+		data, err := structures.ConvertEntitlement[structures.EntitlementDataBaseSelectable](ent)
+		if err != nil {
+			continue
+		}
+		if data.Data.Selected {
+			switch ent.Kind {
+			case structures.EntitlementKindBadge:
+				result.SelectedBadgeID = data.Data.ObjectReference
+			case structures.EntitlementKindPaint:
+				result.SelectedPaintID = data.Data.ObjectReference
+			}
+		}
+
+		refs[ent.Kind] = append(refs[ent.Kind], data.Data.ObjectReference)
+		result.Entitlements = append(result.Entitlements, ent)
+	}
+
+	// Resolve the referenced objects
+	if ids := refs[structures.EntitlementKindRole]; len(ids) > 0 {
+		if result.Roles, err = q.Roles(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return nil, err
+		}
+	}
+
+	cosmeticIDs := make([]primitive.ObjectID, 0, len(refs[structures.EntitlementKindBadge])+len(refs[structures.EntitlementKindPaint]))
+	cosmeticIDs = append(cosmeticIDs, refs[structures.EntitlementKindBadge]...)
+	cosmeticIDs = append(cosmeticIDs, refs[structures.EntitlementKindPaint]...)
+	if len(cosmeticIDs) > 0 {
+		cur, err = q.mongo.Collection(mongo.CollectionNameCosmetics).Find(ctx, bson.M{"_id": bson.M{"$in": cosmeticIDs}})
+		if err != nil {
+			return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+		cosmetics := []structures.Cosmetic[bson.Raw]{}
+		if err = cur.All(ctx, &cosmetics); err != nil {
+			return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+		}
+
+		for _, c := range cosmetics {
+			switch c.Kind {
+			case structures.CosmeticKindBadge:
+				badge, err := structures.ConvertCosmetic[structures.CosmeticDataBadge](c)
+				if err != nil {
+					continue
+				}
+				badge.Data.ID = badge.ID
+				badge.Selected = badge.ID == result.SelectedBadgeID
+				result.Badges = append(result.Badges, badge)
+			case structures.CosmeticKindNametagPaint:
+				paint, err := structures.ConvertCosmetic[structures.CosmeticDataPaint](c)
+				if err != nil {
+					continue
+				}
+				paint.Data.ID = paint.ID
+				paint.Selected = paint.ID == result.SelectedPaintID
+				result.Paints = append(result.Paints, paint)
+			}
+		}
+	}
+
+	if ids := refs[structures.EntitlementKindEmoteSet]; len(ids) > 0 {
+		sets, err := q.EmoteSets(ctx, bson.M{"_id": bson.M{"$in": ids}}).Items()
+		if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+			return nil, err
+		}
+		result.EmoteSets = append(result.EmoteSets, sets...)
+	}
+
+	return result, nil
+}
+
+type UserEntitlementsQueryOptions struct {
+	// Whether to include disabled entitlements and those whose conditions are not met
+	IncludeInactive bool
+}
+
+type UserEntitlements struct {
+	Entitlements []structures.Entitlement[bson.Raw]                  `json:"entitlements"`
+	Roles        []structures.Role                                   `json:"roles"`
+	Badges       []structures.Cosmetic[structures.CosmeticDataBadge] `json:"badges"`
+	Paints       []structures.Cosmetic[structures.CosmeticDataPaint] `json:"paints"`
+	EmoteSets    []structures.EmoteSet                               `json:"emote_sets"`
+	// The ID of the badge selected by the user
+	SelectedBadgeID primitive.ObjectID `json:"selected_badge_id,omitempty"`
+	// The ID of the paint selected by the user
+	SelectedPaintID primitive.ObjectID `json:"selected_paint_id,omitempty"`
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/patrickmn/go-cache"
+	"github.com/seventv/common/datastructures/radix"
 	"github.com/seventv/common/errors"
 	"github.com/seventv/common/mongo"
 	"github.com/seventv/common/redis"
@@ -24,6 +25,8 @@ type Query struct {
 	redis redis.Instance
 	c     *cache.Cache
 	mx    *sync_map.Map[string, *sync.Mutex]
+
+	ipBans *ipBanMatcher
 }
 
 func New(mongoInst mongo.Instance, redisInst redis.Instance) *Query {
@@ -32,6 +35,8 @@ func New(mongoInst mongo.Instance, redisInst redis.Instance) *Query {
 		redis: redisInst,
 		c:     cache.New(time.Minute*1, time.Minute*5),
 		mx:    &sync_map.Map[string, *sync.Mutex]{},
+
+		ipBans: &ipBanMatcher{tree: &radix.Tree[[]structures.Ban]{}},
 	}
 }
 
@@ -89,17 +94,47 @@ func (q *Query) setInMemCache(ctx context.Context, key redis.Key, i interface{},
 	return nil
 }
 
+// redactEmoteSet removes the email addresses of the users in an emote set, so that it can be cached
+func redactEmoteSet(set *structures.EmoteSet) {
+	redactUser(set.Owner)
+	for _, ae := range set.Emotes {
+		if ae.Emote != nil {
+			redactUser(ae.Emote.Owner)
+		}
+	}
+}
+
+func redactUser(u *structures.User) {
+	if u != nil {
+		u.Email = ""
+	}
+}
+
 type QueryResult[T QueriableType] struct {
 	items []T
 	err   error
+	bans  *BanEnforcer
+}
+
+// newQueryResult returns an empty result which applies the effects of the bans currently in effect to its items
+func newQueryResult[T QueriableType](ctx context.Context, q *Query) *QueryResult[T] {
+	qr := &QueryResult[T]{}
+
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return qr.setError(err)
+	}
+
+	qr.bans = be
+	return qr
 }
 
 type QueriableType interface {
-	structures.User | structures.Emote | structures.EmoteSet | structures.Message[bson.Raw] | structures.Role
+	structures.User | structures.Emote | structures.EmoteSet | structures.Message[bson.Raw] | structures.Role | structures.Report
 }
 
 func (qr *QueryResult[T]) setItems(items []T) *QueryResult[T] {
-	qr.items = items
+	qr.items = Enforce(qr.bans, items)
 	return qr
 }
 
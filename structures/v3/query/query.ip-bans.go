@@ -0,0 +1,175 @@
+package query
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/seventv/common/datastructures/radix"
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	IP_BANS_REFRESH_INTERVAL = time.Minute * 5
+	// How long to wait before loading the blocked ranges again after a failure
+	IP_BANS_RETRY_INTERVAL = time.Second * 10
+)
+
+// ipBanMatcher holds the IP ranges blocked by active bans in a radix tree
+type ipBanMatcher struct {
+	mx     sync.RWMutex
+	tree   *radix.Tree[[]structures.Ban]
+	loaded bool
+
+	// Held while loading the ranges on first use, so that concurrent lookups wait for a single load
+	loadMx  sync.Mutex
+	retryAt time.Time
+}
+
+// IsIPBlocked returns the ban blocking the IP address, if any
+//
+// The blocked ranges are kept in memory and loaded on first use.
+// Use WatchIPBans to keep them up to date
+func (q *Query) IsIPBlocked(ctx context.Context, ip string) (structures.Ban, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return structures.Ban{}, false
+	}
+
+	q.ipBans.mx.RLock()
+	loaded := q.ipBans.loaded
+	q.ipBans.mx.RUnlock()
+
+	if !loaded {
+		if err = q.loadIPBans(ctx); err != nil {
+			zap.S().Errorw("failed to load ip bans",
+				"error", err,
+			)
+			return structures.Ban{}, false
+		}
+	}
+
+	q.ipBans.mx.RLock()
+	defer q.ipBans.mx.RUnlock()
+
+	if q.ipBans.tree == nil { // still failing to load
+		return structures.Ban{}, false
+	}
+
+	matches := q.ipBans.tree.Matches(addr)
+	for i := len(matches) - 1; i >= 0; i-- { // most specific range first
+		for _, ban := range matches[i] {
+			if ban.IsActive() {
+				return ban, true
+			}
+		}
+	}
+	return structures.Ban{}, false
+}
+
+// loadIPBans loads the blocked ranges unless they were already loaded
+//
+// After a failure, the ranges are not loaded again until IP_BANS_RETRY_INTERVAL has passed
+func (q *Query) loadIPBans(ctx context.Context) error {
+	q.ipBans.loadMx.Lock()
+	defer q.ipBans.loadMx.Unlock()
+
+	q.ipBans.mx.RLock()
+	loaded := q.ipBans.loaded
+	q.ipBans.mx.RUnlock()
+
+	if loaded || time.Now().Before(q.ipBans.retryAt) {
+		return nil
+	}
+
+	if err := q.RefreshIPBans(ctx); err != nil {
+		q.ipBans.retryAt = time.Now().Add(IP_BANS_RETRY_INTERVAL)
+		return err
+	}
+	return nil
+}
+
+// RefreshIPBans reloads the IP ranges blocked by active bans
+func (q *Query) RefreshIPBans(ctx context.Context) error {
+	filter := structures.ActiveBanFilter(time.Now())
+	filter["effects"] = bson.M{"$bitsAllSet": structures.BanEffectBlockedIP}
+	filter["ips.0"] = bson.M{"$exists": true}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameBans).Find(ctx, filter)
+	if err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	bans := []structures.Ban{}
+	if err = cur.All(ctx, &bans); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	prefixes := map[netip.Prefix][]structures.Ban{}
+	for _, ban := range bans {
+		for _, s := range ban.IPs {
+			p, err := structures.ParseBanIP(s)
+			if err != nil {
+				zap.S().Warnw("ban has an invalid ip",
+					"error", err,
+					"ban_id", ban.ID.Hex(),
+					"ip", s,
+				)
+				continue
+			}
+
+			prefixes[p] = append(prefixes[p], ban)
+		}
+	}
+
+	tree := &radix.Tree[[]structures.Ban]{}
+	for p, v := range prefixes {
+		tree.Insert(p, v)
+	}
+
+	q.ipBans.mx.Lock()
+	q.ipBans.tree = tree
+	q.ipBans.loaded = true
+	q.ipBans.mx.Unlock()
+
+	return nil
+}
+
+// WatchIPBans keeps the blocked IP ranges up to date until the context is canceled
+//
+// The ranges are reloaded periodically, and whenever a mutation publishes to the IP ban channel
+func (q *Query) WatchIPBans(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = IP_BANS_REFRESH_INTERVAL
+	}
+
+	ch := make(chan string, 10)
+	go q.redis.Subscribe(ctx, ch, q.redis.ComposeKey("common", structures.IPBanUpdateChannel))
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	refresh := func() {
+		if err := q.RefreshIPBans(ctx); err != nil {
+			zap.S().Errorw("failed to refresh ip bans",
+				"error", err,
+			)
+		}
+	}
+
+	refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			refresh()
+		case <-tick.C:
+			refresh()
+		}
+	}
+}
@@ -14,7 +14,10 @@ import (
 )
 
 func (q *Query) InboxMessages(ctx context.Context, opt InboxMessagesQueryOptions) *QueryResult[structures.Message[bson.Raw]] {
-	qr := &QueryResult[structures.Message[bson.Raw]]{}
+	qr := newQueryResult[structures.Message[bson.Raw]](ctx, q)
+	if qr.err != nil {
+		return qr
+	}
 	actor := opt.Actor
 	user := opt.User
 	if user == nil {
@@ -71,7 +74,10 @@ func (q *Query) InboxMessages(ctx context.Context, opt InboxMessagesQueryOptions
 }
 
 func (q *Query) ModRequestMessages(ctx context.Context, opt ModRequestMessagesQueryOptions) *QueryResult[structures.Message[bson.Raw]] {
-	qr := &QueryResult[structures.Message[bson.Raw]]{}
+	qr := newQueryResult[structures.Message[bson.Raw]](ctx, q)
+	if qr.err != nil {
+		return qr
+	}
 	actor := opt.Actor
 	targets := opt.Targets
 
@@ -115,7 +121,10 @@ func (q *Query) ModRequestMessages(ctx context.Context, opt ModRequestMessagesQu
 }
 
 func (q *Query) Messages(ctx context.Context, filter bson.M, opt MessageQueryOptions) *QueryResult[structures.Message[bson.Raw]] {
-	qr := &QueryResult[structures.Message[bson.Raw]]{}
+	qr := newQueryResult[structures.Message[bson.Raw]](ctx, q)
+	if qr.err != nil {
+		return qr
+	}
 	items := []structures.Message[bson.Raw]{}
 
 	// Set limit?
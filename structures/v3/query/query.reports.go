@@ -0,0 +1,345 @@
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const REPORTS_QUERY_LIMIT = 100
+
+// Reports: list reports, ordered by priority and then by age (oldest first)
+//
+// The reporter, assignees and target are resolved
+func (q *Query) Reports(ctx context.Context, opt ReportsQueryOptions) *QueryResult[structures.Report] {
+	qr := newQueryResult[structures.Report](ctx, q)
+	if qr.err != nil {
+		return qr
+	}
+
+	if !opt.SkipPermissionCheck {
+		if opt.Actor == nil || !opt.Actor.HasPermission(structures.RolePermissionManageReports) {
+			return qr.setError(errors.ErrInsufficientPrivilege())
+		}
+	}
+
+	limit := opt.Limit
+	if limit > REPORTS_QUERY_LIMIT || limit < 1 {
+		limit = REPORTS_QUERY_LIMIT
+	}
+	page := opt.Page
+	if page < 1 {
+		page = 1
+	}
+
+	// Define the filter
+	filter := bson.M{}
+	if len(opt.Status) > 0 {
+		filter["status"] = bson.M{"$in": opt.Status}
+	}
+	if len(opt.TargetKinds) > 0 {
+		filter["target_kind"] = bson.M{"$in": opt.TargetKinds}
+	}
+	if len(opt.TargetIDs) > 0 {
+		filter["target_id"] = bson.M{"$in": opt.TargetIDs}
+	}
+	if opt.AssigneeID != nil {
+		if opt.AssigneeID.IsZero() { // unassigned reports
+			filter["assignee_ids"] = bson.M{"$size": 0}
+		} else {
+			filter["assignee_ids"] = *opt.AssigneeID
+		}
+	}
+
+	priority := bson.M{}
+	if opt.MinPriority != nil {
+		priority["$gte"] = *opt.MinPriority
+	}
+	if opt.MaxPriority != nil {
+		priority["$lte"] = *opt.MaxPriority
+	}
+	if len(priority) > 0 {
+		filter["priority"] = priority
+	}
+
+	age := bson.M{}
+	if opt.MinAge > 0 {
+		age["$lte"] = time.Now().Add(-opt.MinAge)
+	}
+	if opt.MaxAge > 0 {
+		age["$gte"] = time.Now().Add(-opt.MaxAge)
+	}
+	if len(age) > 0 {
+		filter["created_at"] = age
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameReports).Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "created_at", Value: 1}}).
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return qr.setError(errors.ErrInternalServerError().SetDetail(err.Error()))
+	}
+
+	items := []structures.Report{}
+	if err = cur.All(ctx, &items); err != nil {
+		return qr.setError(errors.ErrInternalServerError().SetDetail(err.Error()))
+	}
+	if len(items) == 0 {
+		return qr.setItems(items)
+	}
+
+	// Resolve relations
+	userIDs := []primitive.ObjectID{}
+	emoteIDs := []primitive.ObjectID{}
+	for _, r := range items {
+		userIDs = append(userIDs, r.ReporterID)
+		userIDs = append(userIDs, r.AssigneeIDs...)
+
+		switch r.TargetKind {
+		case structures.ObjectKindUser:
+			userIDs = append(userIDs, r.TargetID)
+		case structures.ObjectKindEmote:
+			emoteIDs = append(emoteIDs, r.TargetID)
+		}
+	}
+
+	userMap := map[primitive.ObjectID]structures.User{}
+	users, err := q.Users(ctx, bson.M{"_id": bson.M{"$in": userIDs}}).Items()
+	if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+		return qr.setError(err)
+	}
+	for _, u := range users {
+		userMap[u.ID] = u
+	}
+
+	emoteMap := map[primitive.ObjectID]structures.Emote{}
+	if len(emoteIDs) > 0 {
+		emotes, err := q.Emotes(ctx, bson.M{"versions.id": bson.M{"$in": emoteIDs}}).Items()
+		if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+			return qr.setError(err)
+		}
+		for _, e := range emotes {
+			for _, ver := range e.Versions {
+				emoteMap[ver.ID] = e
+			}
+		}
+	}
+
+	for i, r := range items {
+		if u, ok := userMap[r.ReporterID]; ok {
+			items[i].Reporter = &u
+		}
+
+		items[i].Assignees = make([]structures.User, 0, len(r.AssigneeIDs))
+		for _, id := range r.AssigneeIDs {
+			if u, ok := userMap[id]; ok {
+				items[i].Assignees = append(items[i].Assignees, u)
+			}
+		}
+
+		switch r.TargetKind {
+		case structures.ObjectKindUser:
+			if u, ok := userMap[r.TargetID]; ok {
+				items[i].Target = &u
+			}
+		case structures.ObjectKindEmote:
+			if e, ok := emoteMap[r.TargetID]; ok {
+				items[i].TargetEmote = &e
+			}
+		}
+	}
+
+	return qr.setItems(items)
+}
+
+type ReportsQueryOptions struct {
+	Actor       *structures.User
+	Status      []structures.ReportStatus
+	TargetKinds []structures.ObjectKind
+	TargetIDs   []primitive.ObjectID
+	// If set to a zero ID, only unassigned reports are returned
+	AssigneeID  *primitive.ObjectID
+	MinPriority *int32
+	MaxPriority *int32
+	// Only return reports older than this
+	MinAge time.Duration
+	// Only return reports younger than this
+	MaxAge              time.Duration
+	Page                int
+	Limit               int
+	SkipPermissionCheck bool
+}
+
+// ReportMetrics: compute the workload of moderators and the time it takes to respond to reports
+//
+// A report counts as responded to once a moderator added a public note, or once it was closed
+func (q *Query) ReportMetrics(ctx context.Context, opt ReportMetricsOptions) (*ReportMetrics, error) {
+	if opt.Actor == nil || !opt.Actor.HasPermission(structures.RolePermissionManageReports) {
+		return nil, errors.ErrInsufficientPrivilege()
+	}
+
+	since := opt.Since
+	if since.IsZero() {
+		since = time.Now().Add(-time.Hour * 24 * 30)
+	}
+
+	result := &ReportMetrics{
+		Since:    since,
+		Workload: []ReportModeratorWorkload{},
+	}
+
+	// Count the reports assigned to each moderator
+	cur, err := q.mongo.Collection(mongo.CollectionNameReports).Aggregate(ctx, mongo.Pipeline{
+		{{
+			Key: "$match",
+			Value: bson.M{"$or": bson.A{
+				bson.M{"status": structures.ReportStatusAssigned},
+				bson.M{"status": structures.ReportStatusClosed, "closed_at": bson.M{"$gte": since}},
+			}},
+		}},
+		{{Key: "$unwind", Value: "$assignee_ids"}},
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id": "$assignee_ids",
+				"assigned": bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$status", structures.ReportStatusAssigned}}, 1, 0},
+				}},
+				"closed": bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$status", structures.ReportStatusClosed}}, 1, 0},
+				}},
+				"oldest_assigned_at": bson.M{"$min": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$status", structures.ReportStatusAssigned}}, "$created_at", nil},
+				}},
+			},
+		}},
+		{{Key: "$sort", Value: bson.D{{Key: "assigned", Value: -1}, {Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if err = cur.All(ctx, &result.Workload); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	if len(result.Workload) > 0 {
+		userIDs := make([]primitive.ObjectID, len(result.Workload))
+		for i, w := range result.Workload {
+			userIDs[i] = w.UserID
+		}
+
+		users, err := q.Users(ctx, bson.M{"_id": bson.M{"$in": userIDs}}).Items()
+		if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+			return nil, err
+		}
+		userMap := make(map[primitive.ObjectID]structures.User, len(users))
+		for _, u := range users {
+			userMap[u.ID] = u
+		}
+		for i, w := range result.Workload {
+			if u, ok := userMap[w.UserID]; ok {
+				result.Workload[i].User = &u
+			}
+		}
+	}
+
+	// Compute the time to first response
+	cur, err = q.mongo.Collection(mongo.CollectionNameReports).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": since}}}},
+		{{
+			Key: "$set",
+			Value: bson.M{"first_response_at": bson.M{"$min": bson.A{
+				"$closed_at",
+				bson.M{"$min": bson.M{"$map": bson.M{
+					"input": bson.M{"$filter": bson.M{
+						"input": bson.M{"$ifNull": bson.A{"$notes", bson.A{}}},
+						"as":    "n",
+						"cond": bson.M{"$and": bson.A{
+							bson.M{"$ne": bson.A{"$$n.author_id", "$reporter_id"}},
+							bson.M{"$ne": bson.A{"$$n.internal", true}},
+						}},
+					}},
+					"as": "n",
+					"in": "$$n.timestamp",
+				}}},
+			}}},
+		}},
+		{{
+			Key: "$set",
+			Value: bson.M{"response_time": bson.M{
+				"$subtract": bson.A{"$first_response_at", "$created_at"},
+			}},
+		}},
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id":     nil,
+				"reports": bson.M{"$sum": 1},
+				"responded": bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$gt": bson.A{"$first_response_at", nil}}, 1, 0},
+				}},
+				"avg": bson.M{"$avg": "$response_time"},
+				"max": bson.M{"$max": "$response_time"},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	ttfr := []struct {
+		Reports   int     `bson:"reports"`
+		Responded int     `bson:"responded"`
+		Avg       float64 `bson:"avg"`
+		Max       int64   `bson:"max"`
+	}{}
+	if err = cur.All(ctx, &ttfr); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+	if len(ttfr) > 0 {
+		result.Reports = ttfr[0].Reports
+		result.Responded = ttfr[0].Responded
+		result.AverageTimeToFirstResponse = time.Duration(ttfr[0].Avg) * time.Millisecond
+		result.LongestTimeToFirstResponse = time.Duration(ttfr[0].Max) * time.Millisecond
+	}
+
+	return result, nil
+}
+
+type ReportMetricsOptions struct {
+	Actor *structures.User
+	// The start of the period to compute metrics for. Defaults to 30 days ago
+	Since time.Time
+}
+
+type ReportMetrics struct {
+	Since time.Time `json:"since"`
+	// The amount of reports assigned to and closed by each moderator
+	Workload []ReportModeratorWorkload `json:"workload"`
+	// The amount of reports created in the period
+	Reports int `json:"reports"`
+	// The amount of reports created in the period which were responded to
+	Responded                  int           `json:"responded"`
+	AverageTimeToFirstResponse time.Duration `json:"average_time_to_first_response"`
+	LongestTimeToFirstResponse time.Duration `json:"longest_time_to_first_response"`
+}
+
+type ReportModeratorWorkload struct {
+	UserID primitive.ObjectID `json:"user_id" bson:"_id"`
+	// The amount of reports currently assigned to the moderator
+	Assigned int `json:"assigned" bson:"assigned"`
+	// The amount of reports closed in the period which the moderator was assigned to
+	Closed int `json:"closed" bson:"closed"`
+	// The creation date of the oldest report currently assigned to the moderator
+	OldestAssignedAt time.Time `json:"oldest_assigned_at,omitempty" bson:"oldest_assigned_at,omitempty"`
+
+	User *structures.User `json:"user" bson:"-"`
+}
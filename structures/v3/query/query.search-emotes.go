@@ -19,7 +19,6 @@ import (
 	"github.com/seventv/common/structures/v3/aggregations"
 	"github.com/seventv/common/utils"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.uber.org/zap"
 )
 
@@ -57,18 +56,14 @@ func (q *Query) SearchEmotes(ctx context.Context, opt SearchEmotesOptions) ([]st
 	query := strings.Trim(opt.Query, " ")
 
 	// Set up db query
-	bans, err := q.Bans(ctx, BanQueryOptions{ // remove emotes made by usersa who own nothing and are happy
-		Filter: bson.M{"effects": bson.M{"$bitsAnySet": structures.BanEffectNoOwnership | structures.BanEffectMemoryHole}},
-	})
+	be, err := q.BanEnforcer(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	match := bson.D{
 		{Key: "versions.state.lifecycle", Value: structures.EmoteLifecycleLive},
-		{Key: "owner_id", Value: bson.M{"$not": bson.M{
-			"$in": bans.NoOwnership.KeySlice(),
-		}}},
+		{Key: "owner_id", Value: be.NoOwnershipCondition()},
 	}
 	if len(filter.Document) > 0 {
 		for k, v := range filter.Document {
@@ -263,9 +258,10 @@ func (q *Query) SearchEmotes(ctx context.Context, opt SearchEmotesOptions) ([]st
 		if e.ID.IsZero() {
 			continue
 		}
-		if _, banned := bans.MemoryHole[e.OwnerID]; banned {
-			e.OwnerID = primitive.NilObjectID
-		} else {
+		if !be.Emote(&e) {
+			continue
+		}
+		if !e.OwnerID.IsZero() {
 			owner := ownerMap[e.OwnerID]
 			e.Owner = &owner
 		}
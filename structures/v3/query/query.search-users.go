@@ -56,9 +56,7 @@ func (q *Query) SearchUsers(ctx context.Context, filter bson.M, opts ...UserSear
 	h.Write(b)
 	queryKey := q.redis.ComposeKey("common", fmt.Sprintf("user-search:%s", hex.EncodeToString(h.Sum(nil))))
 
-	bans, err := q.Bans(ctx, BanQueryOptions{ // remove emotes made by usersa who own nothing and are happy
-		Filter: bson.M{"effects": bson.M{"$bitsAnySet": structures.BanEffectMemoryHole}},
-	})
+	be, err := q.BanEnforcer(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -69,16 +67,7 @@ func (q *Query) SearchUsers(ctx context.Context, filter bson.M, opts ...UserSear
 				Key:   "$match",
 				Value: filter,
 			}},
-			{{
-				Key: "$set",
-				Value: bson.M{ // Remove memory holed editors
-					"editors": bson.M{"$filter": bson.M{
-						"input": "$editors",
-						"as":    "e",
-						"cond":  bson.M{"$not": bson.M{"$in": bson.A{"$$e.id", bans.MemoryHole.KeySlice()}}},
-					}},
-				},
-			}},
+			be.EditorsStage(), // Remove memory holed editors
 		},
 		paginate,
 		mongo.Pipeline{
@@ -194,12 +183,34 @@ type aggregatedUsersResult struct {
 	TotalCount       int                                `bson:"total_count"`
 }
 
+// UserEditorOf: list the users the specified user is an editor of, excluding pending invitations
 func (q *Query) UserEditorOf(ctx context.Context, id primitive.ObjectID) ([]structures.UserEditor, error) {
+	return q.userEditorOf(ctx, id, bson.M{"id": id, "pending": bson.M{"$ne": true}})
+}
+
+// UserEditorInvitations: list the users who invited the specified user to be their editor, excluding expired invitations
+func (q *Query) UserEditorInvitations(ctx context.Context, id primitive.ObjectID) ([]structures.UserEditor, error) {
+	return q.userEditorOf(ctx, id, bson.M{
+		"id":      id,
+		"pending": true,
+		"$or": bson.A{
+			bson.M{"expire_at": bson.M{"$exists": false}},
+			bson.M{"expire_at": bson.M{"$gt": time.Now()}},
+		},
+	})
+}
+
+func (q *Query) userEditorOf(ctx context.Context, id primitive.ObjectID, match bson.M) ([]structures.UserEditor, error) {
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	cur, err := q.mongo.Collection(mongo.CollectionNameUsers).Aggregate(ctx, mongo.Pipeline{
 		{{
 			Key: "$match",
 			Value: bson.M{
-				"editors.id": id,
+				"editors": bson.M{"$elemMatch": match},
 			},
 		}},
 		{{
@@ -230,5 +241,5 @@ func (q *Query) UserEditorOf(ctx context.Context, id primitive.ObjectID) ([]stru
 		return nil, err
 	}
 
-	return v, nil
+	return Enforce(be, v), nil
 }
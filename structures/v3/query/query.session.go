@@ -0,0 +1,45 @@
+package query
+
+import (
+	"context"
+
+	"github.com/seventv/common/auth"
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionUser: resolve the user authenticated by the claim of a verified token
+//
+// This fails if the token was revoked, or if the user is banned from authenticating
+func (q *Query) SessionUser(ctx context.Context, claim auth.JWTClaimUser) (structures.User, error) {
+	userID, err := primitive.ObjectIDFromHex(claim.UserID)
+	if err != nil {
+		return structures.User{}, errors.ErrUnauthorized().SetDetail("Bad Token")
+	}
+
+	user, err := q.Users(ctx, bson.M{"_id": userID}).First()
+	if err != nil {
+		if errors.Compare(err, errors.ErrNoItems()) {
+			return structures.User{}, errors.ErrUnauthorized().SetDetail("Unknown User")
+		}
+		return structures.User{}, err
+	}
+
+	if err = checkSession(claim, &user); err != nil {
+		return structures.User{}, err
+	}
+	return user, nil
+}
+
+// checkSession returns an error if the claim may no longer authenticate the user
+//
+// The user's bans must be attached
+func checkSession(claim auth.JWTClaimUser, user *structures.User) error {
+	if claim.TokenVersion != user.TokenVersion {
+		return errors.ErrUnauthorized().SetDetail("Token Version Mismatch")
+	}
+
+	return user.CheckAuth()
+}
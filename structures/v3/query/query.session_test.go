@@ -0,0 +1,55 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seventv/common/auth"
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/structures/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckSession(t *testing.T) {
+	id := primitive.NewObjectID()
+	claim := auth.JWTClaimUser{UserID: id.Hex(), TokenVersion: 2}
+
+	ban := func(effects structures.BanEffect, expireAt time.Time) structures.Ban {
+		return structures.Ban{ID: primitive.NewObjectID(), VictimID: id, Effects: effects, ExpireAt: expireAt}
+	}
+	revoked := ban(structures.BanEffectNoAuth, time.Time{})
+	revoked.RevokedAt = time.Now()
+
+	cases := []struct {
+		name string
+		user structures.User
+		want errors.APIError
+	}{
+		{"valid", structures.User{ID: id, TokenVersion: 2}, nil},
+		{"revoked token", structures.User{ID: id, TokenVersion: 3}, errors.ErrUnauthorized()},
+		{"no auth ban", structures.User{ID: id, TokenVersion: 2, Bans: []structures.Ban{
+			ban(structures.BanEffectNoAuth, time.Now().Add(time.Hour)),
+		}}, errors.ErrBanned()},
+		{"permanent no auth ban", structures.User{ID: id, TokenVersion: 2, Bans: []structures.Ban{
+			ban(structures.BanEffectNoAuth|structures.BanEffectMemoryHole, time.Time{}),
+		}}, errors.ErrBanned()},
+		{"expired no auth ban", structures.User{ID: id, TokenVersion: 2, Bans: []structures.Ban{
+			ban(structures.BanEffectNoAuth, time.Now().Add(-time.Hour)),
+		}}, nil},
+		{"revoked no auth ban", structures.User{ID: id, TokenVersion: 2, Bans: []structures.Ban{revoked}}, nil},
+		{"other ban", structures.User{ID: id, TokenVersion: 2, Bans: []structures.Ban{
+			ban(structures.BanEffectNoPermissions, time.Time{}),
+		}}, nil},
+	}
+
+	for _, c := range cases {
+		err := checkSession(claim, &c.user)
+		if c.want == nil {
+			if err != nil {
+				t.Errorf("%s: checkSession() = %v; want no error", c.name, err)
+			}
+		} else if !errors.Compare(err, c.want) {
+			t.Errorf("%s: checkSession() = %v; want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -32,7 +32,8 @@ func (q *Query) GlobalEmoteSet(ctx context.Context) (structures.EmoteSet, error)
 		return set, err
 	}
 
-	// Set cache
+	// Set cache, without the emails of the owners
+	redactEmoteSet(&set)
 	if err := q.setInMemCache(ctx, k, set, time.Second*30); err != nil {
 		return set, err
 	}
@@ -0,0 +1,241 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo"
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	TRENDING_EMOTES_DEFAULT_LIMIT  = 100
+	TRENDING_EMOTES_DEFAULT_WINDOW = time.Hour * 24 * 7
+	TRENDING_EMOTES_CACHE_DURATION = time.Minute * 5
+)
+
+// TrendingEmotes: rank emotes by how many emote sets added them within a time window
+//
+// Additions are read from the timestamps of active emotes as well as emote set audit logs,
+// so emotes which were added and later removed again still count. Each addition is weighted
+// with an exponential decay, so that recent additions rank higher than older ones
+func (q *Query) TrendingEmotes(ctx context.Context, opt TrendingEmotesOptions) ([]structures.Emote, error) {
+	window := utils.Ternary(opt.Window > 0, opt.Window, TRENDING_EMOTES_DEFAULT_WINDOW)
+	halfLife := utils.Ternary(opt.HalfLife > 0, opt.HalfLife, window/4)
+
+	limit := opt.Limit
+	if limit > EMOTES_QUERY_LIMIT {
+		limit = EMOTES_QUERY_LIMIT
+	} else if limit < 1 {
+		limit = TRENDING_EMOTES_DEFAULT_LIMIT
+	}
+
+	privileged := opt.Actor != nil && opt.Actor.HasPermission(structures.RolePermissionEditAnyEmote)
+
+	be, err := q.BanEnforcer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the ranking, either from cache or by computing it
+	k := q.key(fmt.Sprintf("trending-emotes:%d:%d:%d:%t", window, halfLife, limit, privileged))
+	ranking := []trendingEmoteScore{}
+	if !q.getFromMemCache(ctx, k, &ranking) {
+		mtx := q.mtx("trending-emotes")
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		// The ranking may have been computed while waiting for the lock
+		if !q.getFromMemCache(ctx, k, &ranking) {
+			if ranking, err = q.rankTrendingEmotes(ctx, window, halfLife, limit, privileged, be.Bans().NoOwnership.KeySlice()); err != nil {
+				return nil, err
+			}
+
+			if err = q.setInMemCache(ctx, k, ranking, TRENDING_EMOTES_CACHE_DURATION); err != nil {
+				zap.S().Errorw("failed to cache trending emotes",
+					"error", err,
+					"key", k,
+				)
+			}
+		}
+	}
+	if len(ranking) == 0 {
+		return []structures.Emote{}, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(ranking))
+	for i, r := range ranking {
+		ids[i] = r.ID
+	}
+
+	emotes, err := q.Emotes(ctx, bson.M{"_id": bson.M{"$in": ids}}).Items()
+	if err != nil && !errors.Compare(err, errors.ErrNoItems()) {
+		return nil, err
+	}
+
+	emoteMap := make(map[primitive.ObjectID]structures.Emote, len(emotes))
+	for _, e := range emotes {
+		emoteMap[e.ID] = e
+	}
+
+	// Return the emotes in the order of their ranking
+	result := make([]structures.Emote, 0, len(ranking))
+	for _, r := range ranking {
+		e, ok := emoteMap[r.ID]
+		if !ok {
+			continue
+		}
+		if !be.Emote(&e) {
+			continue
+		}
+
+		result = append(result, e)
+	}
+
+	return result, nil
+}
+
+type TrendingEmotesOptions struct {
+	// The time window in which additions are counted
+	Window time.Duration
+	// The age at which an addition is worth half as much as a new one.
+	// Defaults to a quarter of the window
+	HalfLife time.Duration
+	Limit    int
+	Actor    *structures.User
+}
+
+type trendingEmoteScore struct {
+	ID    primitive.ObjectID `json:"id" bson:"_id"`
+	Score float64            `json:"score" bson:"score"`
+}
+
+func (q *Query) rankTrendingEmotes(
+	ctx context.Context,
+	window, halfLife time.Duration,
+	limit int,
+	privileged bool,
+	bannedOwners []primitive.ObjectID,
+) ([]trendingEmoteScore, error) {
+	now := time.Now()
+	since := now.Add(-window)
+
+	// The emote must be live and its owner must not be banned
+	emoteMatch := bson.M{
+		"emote.versions.state.lifecycle": structures.EmoteLifecycleLive,
+		"emote.owner_id":                 bson.M{"$not": bson.M{"$in": bannedOwners}},
+	}
+	// Omit unlisted emotes for unprivileged actors
+	if !privileged {
+		emoteMatch["emote.versions.state.listed"] = true
+	}
+
+	cur, err := q.mongo.Collection(mongo.CollectionNameEmoteSets).Aggregate(ctx, mongo.Pipeline{
+		// Emotes currently active in a set, added within the window
+		{{Key: "$match", Value: bson.M{"emotes.timestamp": bson.M{"$gte": since}}}},
+		{{Key: "$unwind", Value: "$emotes"}},
+		{{Key: "$match", Value: bson.M{"emotes.timestamp": bson.M{"$gte": since}}}},
+		{{
+			Key: "$project",
+			Value: bson.M{
+				"_id":       0,
+				"set_id":    "$_id",
+				"emote_id":  "$emotes.id",
+				"timestamp": "$emotes.timestamp",
+			},
+		}},
+		// Emotes added within the window, according to the audit logs
+		{{
+			Key: "$unionWith",
+			Value: bson.M{
+				"coll": mongo.CollectionNameAuditLogs,
+				"pipeline": mongo.Pipeline{
+					{{
+						Key: "$match",
+						Value: bson.M{
+							"_id":           bson.M{"$gte": primitive.NewObjectIDFromTimestamp(since)},
+							"kind":          structures.AuditLogKindUpdateEmoteSet,
+							"target_kind":   structures.ObjectKindEmoteSet,
+							"changes.key":   "emotes",
+							"changes.value": bson.M{"$exists": true},
+						},
+					}},
+					{{Key: "$unwind", Value: "$changes"}},
+					{{Key: "$match", Value: bson.M{"changes.key": "emotes"}}},
+					{{Key: "$unwind", Value: "$changes.value.added"}},
+					{{
+						Key: "$project",
+						Value: bson.M{
+							"_id":      0,
+							"set_id":   "$target_id",
+							"emote_id": "$changes.value.added.id",
+							"timestamp": bson.M{"$ifNull": bson.A{
+								"$changes.value.added.timestamp",
+								bson.M{"$toDate": "$_id"},
+							}},
+						},
+					}},
+				},
+			},
+		}},
+		// Count each set only once per emote
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id":       bson.M{"set": "$set_id", "emote": "$emote_id"},
+				"timestamp": bson.M{"$max": "$timestamp"},
+			},
+		}},
+		{{Key: "$match", Value: bson.M{"timestamp": bson.M{"$gte": since}}}},
+		// Weigh the addition by its age: 2^(-age/halfLife)
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id": "$_id.emote",
+				"score": bson.M{"$sum": bson.M{"$exp": bson.M{"$multiply": bson.A{
+					-math.Ln2 / float64(halfLife.Milliseconds()),
+					bson.M{"$subtract": bson.A{now, "$timestamp"}},
+				}}}},
+			},
+		}},
+		// Resolve the emote, as the active emote refers to a version
+		{{
+			Key: "$lookup",
+			Value: mongo.Lookup{
+				From:         mongo.CollectionNameEmotes,
+				LocalField:   "_id",
+				ForeignField: "versions.id",
+				As:           "emote",
+			},
+		}},
+		{{Key: "$unwind", Value: "$emote"}},
+		{{Key: "$match", Value: emoteMatch}},
+		{{
+			Key: "$group",
+			Value: bson.M{
+				"_id":   "$emote._id",
+				"score": bson.M{"$sum": "$score"},
+			},
+		}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$limit", Value: limit}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	result := []trendingEmoteScore{}
+	if err = cur.All(ctx, &result); err != nil {
+		return nil, errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return result, nil
+}
@@ -13,30 +13,18 @@ import (
 
 func (q *Query) Users(ctx context.Context, filter bson.M) *QueryResult[structures.User] {
 	items := []structures.User{}
-	r := &QueryResult[structures.User]{}
-
-	bans, err := q.Bans(ctx, BanQueryOptions{ // remove emotes made by usersa who own nothing and are happy
-		Filter: bson.M{"effects": bson.M{"$bitsAnySet": structures.BanEffectMemoryHole}},
-	})
-	if err != nil {
-		return r.setError(err)
+	r := newQueryResult[structures.User](ctx, q)
+	if r.err != nil {
+		return r
 	}
+	be := r.bans
 
 	cur, err := q.mongo.Collection(mongo.CollectionNameUsers).Aggregate(ctx, mongo.Pipeline{
 		{{
 			Key:   "$match",
 			Value: filter,
 		}},
-		{{
-			Key: "$set",
-			Value: bson.M{ // Remove memory holed editors
-				"editors": bson.M{"$filter": bson.M{
-					"input": "$editors",
-					"as":    "e",
-					"cond":  bson.M{"$not": bson.M{"$in": bson.A{"$$e.id", bans.MemoryHole.KeySlice()}}},
-				}},
-			},
-		}},
+		be.EditorsStage(), // Remove memory holed editors
 		{{
 			Key: "$group",
 			Value: bson.M{
@@ -0,0 +1,131 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/seventv/common/errors"
+)
+
+const (
+	BADGE_DEFAULT_SIZE = 72
+	BADGE_MAX_SIZE     = 512
+)
+
+// Badge draws a badge's image centered onto a square canvas, scaled to fit
+//
+// The image is sampled bilinearly, so that small badges remain smooth when enlarged
+func Badge(img image.Image, opt BadgeOptions) (*image.NRGBA, error) {
+	if img == nil {
+		return nil, errors.ErrMissingRequiredField().SetDetail("Did not specify a badge image")
+	}
+	if opt.Size == 0 {
+		opt.Size = BADGE_DEFAULT_SIZE
+	}
+	if opt.Size < 1 || opt.Size > BADGE_MAX_SIZE {
+		return nil, errors.ErrValidationRejected().SetDetail("Size must be between 1 and %d", BADGE_MAX_SIZE)
+	}
+	if opt.Padding < 0 || opt.Padding*2 >= opt.Size {
+		return nil, errors.ErrValidationRejected().SetDetail("Padding must be positive and smaller than half the size")
+	}
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, opt.Size, opt.Size))
+	if opt.Background != nil {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(opt.Background), image.Point{}, draw.Src)
+	}
+
+	sb := img.Bounds()
+	if sb.Empty() {
+		return canvas, nil
+	}
+
+	// Fit the image within the padded area, keeping its aspect ratio
+	area := float64(opt.Size - opt.Padding*2)
+	s := math.Min(area/float64(sb.Dx()), area/float64(sb.Dy()))
+	dw, dh := int(math.Round(float64(sb.Dx())*s)), int(math.Round(float64(sb.Dy())*s))
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			scaled.SetNRGBA(x, y, sampleBilinear(img, (float64(x)+0.5)/s-0.5, (float64(y)+0.5)/s-0.5))
+		}
+	}
+
+	at := image.Pt((opt.Size-dw)/2, (opt.Size-dh)/2)
+	draw.Draw(canvas, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Over)
+
+	return canvas, nil
+}
+
+type BadgeOptions struct {
+	// The width and height of the canvas
+	Size int
+	// Space between the badge and the edges of the canvas
+	Padding int
+	// The color behind the badge. Transparent if nil
+	Background color.Color
+}
+
+// EncodePNG writes a rendered image as PNG
+func EncodePNG(w io.Writer, img image.Image) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(w, img); err != nil {
+		return errors.ErrInternalServerError().SetDetail(err.Error())
+	}
+
+	return nil
+}
+
+// sampleBilinear samples an image at a fractional position relative to its bounds, with premultiplied alpha
+func sampleBilinear(img image.Image, fx, fy float64) color.NRGBA {
+	b := img.Bounds()
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v >= max {
+			return max - 1
+		}
+		return v
+	}
+
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+
+	var r, g, bl, a float64
+	for _, p := range [4]struct {
+		x, y int
+		w    float64
+	}{
+		{x0, y0, (1 - tx) * (1 - ty)},
+		{x0 + 1, y0, tx * (1 - ty)},
+		{x0, y0 + 1, (1 - tx) * ty},
+		{x0 + 1, y0 + 1, tx * ty},
+	} {
+		cr, cg, cb, ca := img.At(b.Min.X+clamp(p.x, b.Dx()), b.Min.Y+clamp(p.y, b.Dy())).RGBA()
+		r += float64(cr) * p.w
+		g += float64(cg) * p.w
+		bl += float64(cb) * p.w
+		a += float64(ca) * p.w
+	}
+	if a <= 0 {
+		return color.NRGBA{}
+	}
+
+	return color.NRGBA{
+		R: uint8(math.Round(r / a * 0xff)),
+		G: uint8(math.Round(g / a * 0xff)),
+		B: uint8(math.Round(bl / a * 0xff)),
+		A: uint8(math.Round(a / 0xffff * 0xff)),
+	}
+}
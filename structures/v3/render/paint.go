@@ -0,0 +1,269 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"unicode/utf8"
+
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/structures/v3"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	PAINT_DEFAULT_TEXT    = "7TV"
+	PAINT_MAX_TEXT_LENGTH = 32
+	PAINT_DEFAULT_SCALE   = 4
+	PAINT_MAX_SCALE       = 8
+	PAINT_DEFAULT_PADDING = 4
+)
+
+// Paint rasterizes a paint onto a text sample
+//
+// Paints of the URL function are filled with the image specified in the options,
+// or their base color if there is none. Animated paints are rendered at their first keyframe
+func Paint(p structures.CosmeticDataPaint, opt PaintOptions) (*image.NRGBA, error) {
+	if opt.Text == "" {
+		opt.Text = PAINT_DEFAULT_TEXT
+	}
+	if opt.Scale == 0 {
+		opt.Scale = PAINT_DEFAULT_SCALE
+	}
+	if opt.Padding == 0 {
+		opt.Padding = PAINT_DEFAULT_PADDING
+	}
+
+	if utf8.RuneCountInString(opt.Text) > PAINT_MAX_TEXT_LENGTH {
+		return nil, errors.ErrValidationRejected().SetDetail("Text sample cannot be longer than %d characters", PAINT_MAX_TEXT_LENGTH)
+	}
+	if opt.Scale < 1 || opt.Scale > PAINT_MAX_SCALE {
+		return nil, errors.ErrValidationRejected().SetDetail("Scale must be between 1 and %d", PAINT_MAX_SCALE)
+	}
+	if opt.Padding < 0 {
+		return nil, errors.ErrValidationRejected().SetDetail("Padding cannot be negative")
+	}
+
+	mask := textMask(opt.Text, opt.Scale)
+	tb := mask.Bounds()
+	pad := opt.Padding * opt.Scale
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, tb.Dx()+pad*2, tb.Dy()+pad*2))
+	if opt.Background != nil {
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(opt.Background), image.Point{}, draw.Src)
+	}
+
+	// Fill the text with the paint
+	layer := image.NewNRGBA(canvas.Bounds())
+	fill := newPaintFill(p, tb.Size(), opt)
+	for y := 0; y < tb.Dy(); y++ {
+		for x := 0; x < tb.Dx(); x++ {
+			a := mask.AlphaAt(x, y).A
+			if a == 0 {
+				continue
+			}
+
+			c := fill.At(x, y)
+			c.A = uint8(uint16(c.A) * uint16(a) / 0xff)
+			layer.SetNRGBA(x+pad, y+pad, c)
+		}
+	}
+
+	// Each drop shadow is cast by the result of the previous one
+	for _, ds := range p.DropShadows {
+		layer = dropShadow(layer, ds, opt.Scale)
+	}
+
+	draw.Draw(canvas, canvas.Bounds(), layer, image.Point{}, draw.Over)
+
+	return canvas, nil
+}
+
+type PaintOptions struct {
+	// The text the paint is applied to
+	Text string
+	// The factor the text is scaled up by
+	Scale int
+	// Space around the text, in unscaled pixels
+	Padding int
+	// The color behind the text. Transparent if nil
+	Background color.Color
+	// The image used by paints of the URL function
+	Image image.Image
+}
+
+// textMask draws the text with a bitmap font, scaled up by the factor
+func textMask(text string, scale int) *image.Alpha {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Metrics().Height.Ceil()
+
+	src := image.NewAlpha(image.Rect(0, 0, width, height))
+	d := font.Drawer{
+		Dst:  src,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(0, face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+
+	if scale == 1 {
+		return src
+	}
+
+	dst := image.NewAlpha(image.Rect(0, 0, width*scale, height*scale))
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			dst.SetAlpha(x, y, src.AlphaAt(x/scale, y/scale))
+		}
+	}
+	return dst
+}
+
+// paintFill computes the color of a paint at each point of an area
+type paintFill struct {
+	paint  structures.CosmeticDataPaint
+	size   image.Point
+	offset image.Point
+	base   color.NRGBA
+	img    image.Image
+}
+
+func newPaintFill(p structures.CosmeticDataPaint, size image.Point, opt PaintOptions) *paintFill {
+	f := &paintFill{
+		paint: p,
+		size:  size,
+		base:  color.NRGBA{0xff, 0xff, 0xff, 0xff},
+	}
+	if p.Color != nil {
+		f.base = structures.CosmeticColor(*p.Color)
+	}
+	if p.Function == structures.CosmeticPaintFunctionImageURL {
+		f.img = opt.Image
+	}
+	if p.Animation != nil && len(p.Animation.Keyframes) > 0 {
+		kf := p.Animation.Keyframes[0]
+		f.offset = image.Pt(int(math.Round(kf.X))*opt.Scale, int(math.Round(kf.Y))*opt.Scale)
+	}
+
+	return f
+}
+
+func (f *paintFill) At(x, y int) color.NRGBA {
+	x -= f.offset.X
+	y -= f.offset.Y
+
+	switch f.paint.Function {
+	case structures.CosmeticPaintFunctionLinearGradient, structures.CosmeticPaintFunctionRadialGradient:
+		if len(f.paint.Stops) == 0 {
+			return f.base
+		}
+		return f.gradientAt(x, y)
+	case structures.CosmeticPaintFunctionImageURL:
+		if f.img == nil {
+			return f.base
+		}
+		return f.imageAt(x, y)
+	}
+
+	return f.base
+}
+
+// gradientAt computes the gradient's color at a point, following the geometry of CSS gradients
+func (f *paintFill) gradientAt(x, y int) color.NRGBA {
+	w, h := float64(f.size.X), float64(f.size.Y)
+	dx, dy := float64(x)+0.5-w/2, float64(y)+0.5-h/2
+
+	var t float64
+	if f.paint.Function == structures.CosmeticPaintFunctionRadialGradient {
+		// Radial gradients extend to the farthest corner
+		if f.paint.Shape == "circle" {
+			t = math.Hypot(dx, dy) / math.Hypot(w/2, h/2)
+		} else {
+			rx, ry := w/2*math.Sqrt2, h/2*math.Sqrt2
+			t = math.Hypot(dx/rx, dy/ry)
+		}
+	} else {
+		// 0 degrees points upwards, and the angle increases clockwise
+		a := float64(f.paint.Angle) * math.Pi / 180
+		sin, cos := math.Sin(a), math.Cos(a)
+		length := math.Abs(w*sin) + math.Abs(h*cos)
+		t = (dx*sin-dy*cos)/length + 0.5
+	}
+
+	return gradientColor(f.paint.Stops, f.paint.Repeat, t)
+}
+
+func (f *paintFill) imageAt(x, y int) color.NRGBA {
+	// The image covers the area
+	b := f.img.Bounds()
+	s := math.Max(float64(f.size.X)/float64(b.Dx()), float64(f.size.Y)/float64(b.Dy()))
+	ox := (float64(b.Dx())*s - float64(f.size.X)) / 2
+	oy := (float64(b.Dy())*s - float64(f.size.Y)) / 2
+
+	sx := b.Min.X + mod(int((float64(x)+ox)/s), b.Dx())
+	sy := b.Min.Y + mod(int((float64(y)+oy)/s), b.Dy())
+
+	return color.NRGBAModel.Convert(f.img.At(sx, sy)).(color.NRGBA)
+}
+
+// gradientColor interpolates the color of gradient stops at a position
+func gradientColor(stops []structures.CosmeticPaintGradientStop, repeat bool, t float64) color.NRGBA {
+	first, last := stops[0], stops[len(stops)-1]
+	if repeat && last.At > first.At {
+		period := last.At - first.At
+		t = first.At + math.Mod(t-first.At, period)
+		if t < first.At {
+			t += period
+		}
+	}
+
+	if t <= first.At {
+		return structures.CosmeticColor(first.Color)
+	}
+	for i := 1; i < len(stops); i++ {
+		if t > stops[i].At {
+			continue
+		}
+
+		a, b := stops[i-1], stops[i]
+		if b.At <= a.At {
+			return structures.CosmeticColor(b.Color)
+		}
+		return mixColors(structures.CosmeticColor(a.Color), structures.CosmeticColor(b.Color), (t-a.At)/(b.At-a.At))
+	}
+
+	return structures.CosmeticColor(last.Color)
+}
+
+// mixColors interpolates two colors with premultiplied alpha, as browsers do
+func mixColors(a, b color.NRGBA, t float64) color.NRGBA {
+	aa, ba := float64(a.A)/0xff, float64(b.A)/0xff
+	alpha := aa + (ba-aa)*t
+	if alpha <= 0 {
+		return color.NRGBA{}
+	}
+
+	channel := func(ca, cb uint8) uint8 {
+		v := (float64(ca)*aa + (float64(cb)*ba-float64(ca)*aa)*t) / alpha
+		return uint8(math.Round(math.Min(math.Max(v, 0), 0xff)))
+	}
+
+	return color.NRGBA{
+		R: channel(a.R, b.R),
+		G: channel(a.G, b.G),
+		B: channel(a.B, b.B),
+		A: uint8(math.Round(alpha * 0xff)),
+	}
+}
+
+func mod(a, b int) int {
+	a %= b
+	if a < 0 {
+		a += b
+	}
+	return a
+}
@@ -0,0 +1,168 @@
+package render
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seventv/common/structures/v3"
+	"github.com/seventv/common/utils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// rgba packs a color the way paints store it
+func rgba(r, g, b, a uint8) int32 {
+	return int32(uint32(r)<<24 | uint32(g)<<16 | uint32(b)<<8 | uint32(a))
+}
+
+var testStops = []structures.CosmeticPaintGradientStop{
+	{At: 0, Color: rgba(255, 0, 0, 255)},
+	{At: 0.5, Color: rgba(0, 255, 0, 255)},
+	{At: 1, Color: rgba(0, 0, 255, 255)},
+}
+
+func TestPaintGolden(t *testing.T) {
+	cases := map[string]structures.CosmeticDataPaint{
+		"paint_linear": {
+			Function: structures.CosmeticPaintFunctionLinearGradient,
+			Stops:    testStops,
+			Angle:    90,
+		},
+		"paint_linear_angle": {
+			Function: structures.CosmeticPaintFunctionLinearGradient,
+			Stops:    testStops,
+			Angle:    45,
+		},
+		"paint_linear_repeat": {
+			Function: structures.CosmeticPaintFunctionLinearGradient,
+			Stops: []structures.CosmeticPaintGradientStop{
+				{At: 0, Color: rgba(255, 255, 0, 255)},
+				{At: 0.2, Color: rgba(255, 0, 255, 255)},
+			},
+			Repeat: true,
+			Angle:  90,
+		},
+		"paint_radial": {
+			Function: structures.CosmeticPaintFunctionRadialGradient,
+			Stops:    testStops,
+			Shape:    "circle",
+		},
+		"paint_drop_shadow": {
+			Function: structures.CosmeticPaintFunctionLinearGradient,
+			Stops:    testStops,
+			Angle:    90,
+			DropShadows: []structures.CosmeticPaintDropShadow{
+				{OffsetX: 1, OffsetY: 1, Radius: 2, Color: rgba(0, 0, 0, 200)},
+			},
+		},
+		"paint_color": {
+			Function: structures.CosmeticPaintFunctionImageURL,
+			Color:    utils.PointerOf(rgba(120, 60, 200, 255)),
+		},
+	}
+
+	for name, p := range cases {
+		p := p
+		t.Run(name, func(t *testing.T) {
+			img, err := Paint(p, PaintOptions{Scale: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, name, img)
+		})
+	}
+}
+
+func TestBadgeGolden(t *testing.T) {
+	// A small checkered image with a diagonal, so that scaling and centering are visible
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 8; x++ {
+			c := color.NRGBA{255, 255, 255, 255}
+			if (x+y)%2 == 0 {
+				c = color.NRGBA{30, 144, 255, 255}
+			}
+			if x == y {
+				c = color.NRGBA{255, 0, 0, 128}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+
+	img, err := Badge(src, BadgeOptions{Size: 36, Padding: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "badge", img)
+}
+
+func TestOptionsValidation(t *testing.T) {
+	p := structures.CosmeticDataPaint{Function: structures.CosmeticPaintFunctionLinearGradient, Stops: testStops}
+
+	if _, err := Paint(p, PaintOptions{Scale: PAINT_MAX_SCALE + 1}); err == nil {
+		t.Error("Paint accepted a scale above the maximum")
+	}
+	if _, err := Paint(p, PaintOptions{Text: string(make([]byte, PAINT_MAX_TEXT_LENGTH+1))}); err == nil {
+		t.Error("Paint accepted a text sample above the maximum length")
+	}
+	if _, err := Badge(nil, BadgeOptions{}); err == nil {
+		t.Error("Badge accepted a nil image")
+	}
+	if _, err := Badge(image.NewNRGBA(image.Rect(0, 0, 1, 1)), BadgeOptions{Size: 10, Padding: 5}); err == nil {
+		t.Error("Badge accepted padding filling the whole canvas")
+	}
+}
+
+// checkGolden compares the image to testdata/<name>.png, or rewrites it when run with -update
+//
+// Channels may differ by one, as floating point results vary slightly between architectures
+func checkGolden(t *testing.T, name string, img *image.NRGBA) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		buf := bytes.Buffer{}
+		if err := EncodePNG(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("missing golden image, run the tests with -update: %v", err)
+	}
+	defer f.Close()
+
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.NewNRGBA(decoded.Bounds())
+	for y := decoded.Bounds().Min.Y; y < decoded.Bounds().Max.Y; y++ {
+		for x := decoded.Bounds().Min.X; x < decoded.Bounds().Max.X; x++ {
+			want.Set(x, y, decoded.At(x, y))
+		}
+	}
+
+	if want.Bounds() != img.Bounds() {
+		t.Fatalf("size = %v; want %v", img.Bounds(), want.Bounds())
+	}
+	for i := range img.Pix {
+		d := int(img.Pix[i]) - int(want.Pix[i])
+		if d < -1 || d > 1 {
+			px := i / 4
+			w := img.Bounds().Dx()
+			t.Fatalf("pixel (%d, %d) = %v; want %v", px%w, px/w, img.Pix[px*4:px*4+4], want.Pix[px*4:px*4+4])
+		}
+	}
+}
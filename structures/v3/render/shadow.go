@@ -0,0 +1,96 @@
+package render
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/seventv/common/structures/v3"
+)
+
+// dropShadow casts a drop shadow from the layer's alpha, and returns the layer drawn over its shadow
+func dropShadow(layer *image.NRGBA, ds structures.CosmeticPaintDropShadow, scale int) *image.NRGBA {
+	b := layer.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	alpha := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			alpha[y*w+x] = float64(layer.NRGBAAt(b.Min.X+x, b.Min.Y+y).A) / 0xff
+		}
+	}
+
+	// The radius is the standard deviation of the blur
+	if sigma := ds.Radius * float64(scale); sigma > 0 {
+		alpha = gaussianBlur(alpha, w, h, sigma)
+	}
+
+	c := structures.CosmeticColor(ds.Color)
+	ox := int(math.Round(ds.OffsetX * float64(scale)))
+	oy := int(math.Round(ds.OffsetY * float64(scale)))
+
+	result := image.NewNRGBA(b)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := x-ox, y-oy
+			if sx < 0 || sy < 0 || sx >= w || sy >= h {
+				continue
+			}
+
+			a := alpha[sy*w+sx] * float64(c.A)
+			if a <= 0 {
+				continue
+			}
+			sc := c
+			sc.A = uint8(math.Round(math.Min(a, 0xff)))
+			result.SetNRGBA(b.Min.X+x, b.Min.Y+y, sc)
+		}
+	}
+
+	draw.Draw(result, b, layer, b.Min, draw.Over)
+	return result
+}
+
+// gaussianBlur approximates a gaussian blur with three successive box blurs
+func gaussianBlur(values []float64, w, h int, sigma float64) []float64 {
+	r := int(math.Round((math.Sqrt(4*sigma*sigma+1) - 1) / 2))
+	if r < 1 {
+		return values
+	}
+
+	tmp := make([]float64, len(values))
+	for i := 0; i < 3; i++ {
+		boxBlur(values, tmp, w, h, r, 1, w) // horizontal
+		boxBlur(tmp, values, h, w, r, w, 1) // vertical
+	}
+	return values
+}
+
+// boxBlur averages each value with its neighbours within the radius along one axis
+//
+// n is the length of a line, with step the distance between its values,
+// and stride the distance between lines
+func boxBlur(src, dst []float64, n, lines, r, step, stride int) {
+	size := float64(r*2 + 1)
+	for l := 0; l < lines; l++ {
+		base := l * stride
+
+		sum := 0.0
+		for i := -r; i <= r; i++ {
+			if i >= 0 && i < n {
+				sum += src[base+i*step]
+			}
+		}
+
+		for i := 0; i < n; i++ {
+			dst[base+i*step] = sum / size
+
+			if out := i - r; out >= 0 {
+				sum -= src[base+out*step]
+			}
+			if in := i + r + 1; in < n {
+				sum += src[base+in*step]
+			}
+		}
+	}
+}
@@ -104,10 +104,12 @@ const (
 	ObjectKindBan         ObjectKind = 6
 	ObjectKindMessage     ObjectKind = 7
 	ObjectKindReport      ObjectKind = 8
+	ObjectKindEmoteTag    ObjectKind = 9
+	ObjectKindCosmetic    ObjectKind = 10
 )
 
 type Object interface {
-	AuditLog | Ban | Cosmetic[bson.Raw] | Emote | EmoteSet | Entitlement[bson.Raw] | Message[bson.Raw] | Report | Role | User
+	AuditLog | Ban | Cosmetic[bson.Raw] | Emote | EmoteSet | EmoteTag | Entitlement[bson.Raw] | Message[bson.Raw] | Report | Role | User
 }
 
 func (k ObjectKind) CollectionName() string {
@@ -126,6 +128,12 @@ func (k ObjectKind) CollectionName() string {
 		return "bans"
 	case ObjectKindMessage:
 		return "messages"
+	case ObjectKindReport:
+		return "reports"
+	case ObjectKindEmoteTag:
+		return "emote_tags"
+	case ObjectKindCosmetic:
+		return "cosmetics"
 	default:
 		return ""
 	}
@@ -31,6 +31,15 @@ const (
 	AuditLogKindUndoDeleteEmote AuditLogKind = 6 // deleted emote was restored
 	AuditLogKindEnableEmote     AuditLogKind = 7 // emote was enabled
 
+	AuditLogKindRequestEmoteOwnershipTransfer AuditLogKind = 8  // emote ownership transfer was requested
+	AuditLogKindAcceptEmoteOwnershipTransfer  AuditLogKind = 9  // emote ownership transfer was accepted
+	AuditLogKindDeclineEmoteOwnershipTransfer AuditLogKind = 10 // emote ownership transfer was declined
+	AuditLogKindCancelEmoteOwnershipTransfer  AuditLogKind = 11 // emote ownership transfer was cancelled
+
+	AuditLogKindMergeEmoteTags  AuditLogKind = 12 // emote tags were merged into another tag
+	AuditLogKindBlockEmoteTag   AuditLogKind = 13 // emote tag was blocked
+	AuditLogKindUnblockEmoteTag AuditLogKind = 14 // emote tag was unblocked
+
 	// Range: 20-29 (Access)
 
 	AuditLogKindSignUserToken  AuditLogKind = 20 // a user token was signed
@@ -39,19 +48,45 @@ const (
 
 	// Range: 30-69 (User)
 
-	AuditLogKindCreateUser       AuditLogKind = 30 // user was created
-	AuditLogKindDeleteUser       AuditLogKind = 31 // user was deleted
-	AuditLogKindBanUser          AuditLogKind = 32 // user was banned
-	AuditLogKindEditUser         AuditLogKind = 33 // user was edited
-	AuditLogKindUnban            AuditLogKind = 36 // user was unbanned
-	AuditLogKindAddUserEditor    AuditLogKind = 37 // editor added to user
-	AuditLogKindRemoveUserEditor AuditLogKind = 38 // editor removed from user
+	AuditLogKindCreateUser             AuditLogKind = 30 // user was created
+	AuditLogKindDeleteUser             AuditLogKind = 31 // user was deleted
+	AuditLogKindBanUser                AuditLogKind = 32 // user was banned
+	AuditLogKindEditUser               AuditLogKind = 33 // user was edited
+	AuditLogKindUnban                  AuditLogKind = 36 // user was unbanned
+	AuditLogKindAddUserEditor          AuditLogKind = 37 // editor added to user
+	AuditLogKindRemoveUserEditor       AuditLogKind = 38 // editor removed from user
+	AuditLogKindAddUserConnection      AuditLogKind = 39 // connection linked to user
+	AuditLogKindRemoveUserConnection   AuditLogKind = 40 // connection unlinked from user
+	AuditLogKindTransferUserConnection AuditLogKind = 41 // connection transferred to another user
+	AuditLogKindUpdateUserConnection   AuditLogKind = 42 // connection data was refreshed
+	AuditLogKindInviteUserEditor       AuditLogKind = 43 // user was invited to become an editor
+	AuditLogKindRemoveEditorInvitation AuditLogKind = 44 // pending editor invitation was declined, cancelled or expired
 
 	// Range: 70-79 (Emote Set)
 
 	AuditLogKindCreateEmoteSet AuditLogKind = 70 // emote set was created
 	AuditLogKindUpdateEmoteSet AuditLogKind = 71 // emote set was updated
 	AuditLogKindDeleteEmoteSet AuditLogKind = 72 // emote set was deleted
+
+	// Range: 80-89 (Report)
+
+	AuditLogKindCreateReport AuditLogKind = 80 // report was created
+	AuditLogKindUpdateReport AuditLogKind = 81 // report was updated
+	AuditLogKindCloseReport  AuditLogKind = 82 // report was closed
+
+	// Range: 90-99 (Entitlement)
+
+	AuditLogKindCreateEntitlement  AuditLogKind = 90 // entitlement was granted
+	AuditLogKindDeleteEntitlement  AuditLogKind = 91 // entitlement was revoked
+	AuditLogKindEnableEntitlement  AuditLogKind = 92 // entitlement was enabled
+	AuditLogKindDisableEntitlement AuditLogKind = 93 // entitlement was disabled
+	AuditLogKindSelectEntitlement  AuditLogKind = 94 // entitled item was selected
+
+	// Range: 100-109 (Cosmetic)
+
+	AuditLogKindCreateCosmetic AuditLogKind = 100 // cosmetic was created
+	AuditLogKindUpdateCosmetic AuditLogKind = 101 // cosmetic was updated
+	AuditLogKindDeleteCosmetic AuditLogKind = 102 // cosmetic was deleted
 )
 
 type AuditLogChange struct {
@@ -71,7 +106,7 @@ func (alc *AuditLogChange) WriteSingleValues(old any, new any) *AuditLogChange {
 
 func (alc *AuditLogChange) WriteArrayAdded(values ...any) *AuditLogChange {
 	ac := &AuditLogChangeArrayChange{}
-	alc.Format = AuditLogChangeFormatSingleValue
+	alc.Format = AuditLogChangeFormatArrayChange
 
 	ac.Added = append(ac.Added, values...)
 	alc.Value, _ = bson.Marshal(ac)
@@ -82,7 +117,7 @@ func (alc *AuditLogChange) WriteArrayRemoved(values ...any) *AuditLogChange {
 	ac := &AuditLogChangeArrayChange{}
 	alc.Format = AuditLogChangeFormatArrayChange
 
-	ac.Removed = append(ac.Added, values...)
+	ac.Removed = append(ac.Removed, values...)
 	alc.Value, _ = bson.Marshal(ac)
 	return alc
 }
@@ -1,8 +1,11 @@
 package structures
 
 import (
+	"net/netip"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -19,6 +22,16 @@ type Ban struct {
 	ExpireAt time.Time `json:"expire_at" bson:"expire_at"`
 	// The effects that this ban will have
 	Effects BanEffect `json:"effects" bson:"effects"`
+	// The time at which the ban was revoked
+	RevokedAt time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// The user who revoked the ban
+	RevokedBy primitive.ObjectID `json:"revoked_by,omitempty" bson:"revoked_by,omitempty"`
+	// The reason for revoking the ban
+	RevokeReason string `json:"revoke_reason,omitempty" bson:"revoke_reason,omitempty"`
+	// Whether or not the victim was notified of the ban's expiry
+	ExpiryNotified bool `json:"-" bson:"expiry_notified,omitempty"`
+	// The IP addresses and CIDR ranges blocked by the ban, in effect with BanEffectBlockedIP
+	IPs []string `json:"-" bson:"ips,omitempty"`
 
 	// Relational
 
@@ -26,6 +39,72 @@ type Ban struct {
 	Actor  *User `json:"actor" bson:"actor,skip,omitempty"`
 }
 
+// IsPermanent returns whether or not the ban has no expiry date
+func (b Ban) IsPermanent() bool {
+	return b.ExpireAt.IsZero()
+}
+
+// IsRevoked returns whether or not the ban was lifted before its expiry
+func (b Ban) IsRevoked() bool {
+	return !b.RevokedAt.IsZero()
+}
+
+// IsActive returns whether or not the ban is currently in effect
+func (b Ban) IsActive() bool {
+	if b.IsRevoked() {
+		return false
+	}
+	return b.IsPermanent() || b.ExpireAt.After(time.Now())
+}
+
+// Prefixes parses the IP addresses and CIDR ranges of the ban
+func (b Ban) Prefixes() ([]netip.Prefix, error) {
+	result := make([]netip.Prefix, len(b.IPs))
+	for i, s := range b.IPs {
+		p, err := ParseBanIP(s)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = p
+	}
+	return result, nil
+}
+
+// ParseBanIP parses an IPv4 or IPv6 address or CIDR range
+//
+// A single address is returned as a prefix covering only that address
+func ParseBanIP(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ActiveBanFilter returns a query filter matching the bans in effect at the specified time
+func ActiveBanFilter(t time.Time) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"expire_at": nil},
+			bson.M{"expire_at": time.Time{}},
+			bson.M{"expire_at": bson.M{"$gt": t}},
+		},
+		"revoked_at": bson.M{"$exists": false},
+	}
+}
+
+// IPBanUpdateChannel is the name of the redis channel notified when the IPs blocked by bans change
+const IPBanUpdateChannel = "ip-bans"
+
 type BanEffect uint32
 
 const (
@@ -122,3 +201,19 @@ func (bb *BanBuilder) SetEffects(a BanEffect) *BanBuilder {
 	bb.Update.Set("effects", a)
 	return bb
 }
+
+func (bb *BanBuilder) SetIPs(ips []string) *BanBuilder {
+	bb.Ban.IPs = ips
+	bb.Update.Set("ips", ips)
+	return bb
+}
+
+func (bb *BanBuilder) SetRevoked(t time.Time, by primitive.ObjectID, reason string) *BanBuilder {
+	bb.Ban.RevokedAt = t
+	bb.Ban.RevokedBy = by
+	bb.Ban.RevokeReason = reason
+	bb.Update.Set("revoked_at", t)
+	bb.Update.Set("revoked_by", by)
+	bb.Update.Set("revoke_reason", reason)
+	return bb
+}
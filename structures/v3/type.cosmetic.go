@@ -99,6 +99,8 @@ type CosmeticDataPaint struct {
 	ImageURL string `json:"image_url,omitempty" bson:"image_url,omitempty"`
 	// A list of drop shadows. There may be any amount, which can be stacked onto each other
 	DropShadows []CosmeticPaintDropShadow `json:"drop_shadows,omitempty" bson:"drop_shadows,omitempty"`
+	// An animation moving the paint's background, if the paint is animated
+	Animation *CosmeticPaintAnimation `json:"animation,omitempty" bson:"animation,omitempty"`
 }
 
 type CosmeticPaintFunction string
@@ -122,12 +124,16 @@ type CosmeticPaintDropShadow struct {
 }
 
 type CosmeticPaintAnimation struct {
-	Speed     int32                            `json:"speed" bson:"speed"`
+	// The duration of one animation cycle, in milliseconds
+	Speed int32 `json:"speed" bson:"speed"`
+	// Keyframes of the animation, in ascending order of their position
 	Keyframes []CosmeticPaintAnimationKeyframe `json:"keyframes" bson:"keyframes"`
 }
 
 type CosmeticPaintAnimationKeyframe struct {
+	// The position of the keyframe within the cycle, between 0 and 1
 	At float64 `json:"at" bson:"at"`
-	X  float64 `json:"x" bson:"x"`
-	Y  float64 `json:"y" bson:"y"`
+	// The offset of the background at this keyframe, in pixels
+	X float64 `json:"x" bson:"x"`
+	Y float64 `json:"y" bson:"y"`
 }
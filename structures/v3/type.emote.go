@@ -54,8 +54,26 @@ const (
 	EmoteFlagsContentEpilepsy         EmoteFlag = 1 << 17 // Rapid flashing
 	EmoteFlagsContentEdgy             EmoteFlag = 1 << 18 // Edgy or distasteful, may be offensive to some users
 	EmoteFlagsContentTwitchDisallowed EmoteFlag = 1 << 24 // Not allowed specifically on the Twitch platform
+
+	EmoteFlagsContent = EmoteFlagsContentSexual | EmoteFlagsContentEpilepsy | EmoteFlagsContentEdgy | EmoteFlagsContentTwitchDisallowed
 )
 
+// ContentFlags returns the content flags in this sum as a list
+func (e EmoteFlag) ContentFlags() []EmoteFlag {
+	result := []EmoteFlag{}
+	for _, f := range []EmoteFlag{
+		EmoteFlagsContentSexual,
+		EmoteFlagsContentEpilepsy,
+		EmoteFlagsContentEdgy,
+		EmoteFlagsContentTwitchDisallowed,
+	} {
+		if e&f == f {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
 func (e EmoteFlag) String() string {
 	switch e {
 	case EmoteFlagsPrivate:
@@ -112,6 +130,35 @@ func (ev EmoteVersion) GetFiles(contentType string, omitStatic bool) []EmoteFile
 type EmoteState struct {
 	// IDs of users who are eligible to claim ownership of this emote
 	Claimants []primitive.ObjectID `json:"claimants" bson:"claimants"`
+	// Pending requests to transfer the ownership of this emote
+	Transfers []EmoteOwnershipTransfer `json:"transfers,omitempty" bson:"transfers,omitempty"`
+}
+
+// EmoteOwnershipTransfer is a pending offer for a user to become the owner of an emote
+type EmoteOwnershipTransfer struct {
+	// The user who is offered ownership of the emote
+	RecipientID primitive.ObjectID `json:"recipient_id" bson:"recipient_id"`
+	// The user who requested the transfer
+	RequesterID primitive.ObjectID `json:"requester_id" bson:"requester_id"`
+	// The time at which the transfer was requested
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	// The time after which the transfer can no longer be accepted
+	ExpireAt time.Time `json:"expire_at" bson:"expire_at"`
+}
+
+// IsExpired returns whether or not the transfer can no longer be accepted
+func (t EmoteOwnershipTransfer) IsExpired() bool {
+	return !t.ExpireAt.IsZero() && t.ExpireAt.Before(time.Now())
+}
+
+// GetOwnershipTransfer returns the pending ownership transfer for a recipient, as well as its index
+func (e Emote) GetOwnershipTransfer(recipientID primitive.ObjectID) (EmoteOwnershipTransfer, int) {
+	for i, t := range e.State.Transfers {
+		if t.RecipientID == recipientID {
+			return t, i
+		}
+	}
+	return EmoteOwnershipTransfer{}, -1
 }
 
 type EmoteVersionState struct {
@@ -121,10 +168,10 @@ type EmoteVersionState struct {
 	// Whether or not the emote is listed
 	Listed bool `json:"listed" bson:"listed"`
 	// The ranked position for the amount of channels this emote is added on to.
-	// This value is to be determined with an external cron job
+	// This value is determined by a cron job calling Mutate.UpdateEmoteChannelCounts
 	ChannelCountRank int32 `json:"-" bson:"channel_count_rank"`
 	// The amount of channels this emote is added on to.
-	// This value is to be determined with an external cron job
+	// This value is determined by a cron job calling Mutate.UpdateEmoteChannelCounts
 	ChannelCount int32 `json:"-" bson:"channel_count"`
 	// The time at which the ChannelCount value was last checked
 	ChannelCountCheckAt time.Time `json:"-" bson:"channel_count_check_at"`
@@ -3,6 +3,7 @@ package structures
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -69,3 +70,94 @@ func (es EmoteSet) GetEmote(id primitive.ObjectID) (ActiveEmote, int) {
 	}
 	return ActiveEmote{}, -1
 }
+
+// EmoteSlotSource is where an emote slot limit comes from
+type EmoteSlotSource string
+
+const (
+	EmoteSlotSourceEmoteSet   EmoteSlotSource = "EMOTE_SET"  // the set's own limit
+	EmoteSlotSourceConnection EmoteSlotSource = "CONNECTION" // the limit set on the connection
+	EmoteSlotSourceRole       EmoteSlotSource = "ROLE"       // the default of the user's roles
+)
+
+// EmoteSlotLimit is an effective limit to the amount of emotes in a set
+type EmoteSlotLimit struct {
+	// The maximum amount of emotes. Connections without a limit have zero slots
+	Slots int32 `json:"slots"`
+	// Where the limit comes from
+	Source EmoteSlotSource `json:"source"`
+	// Slots added by entitlements, included in Slots
+	Bonus int32 `json:"bonus,omitempty"`
+	// The connection the limit applies to, if any
+	ConnectionID string `json:"connection_id,omitempty"`
+}
+
+// ResolveConnectionEmoteSlots returns the maximum amount of emotes a connection may have enabled
+//
+// The connection's own limit takes precedence over the highest default of the user's roles.
+// Slots granted by eligible entitlements are added on top. Zero slots means there is no limit
+func ResolveConnectionEmoteSlots(
+	conn UserConnection[bson.Raw],
+	roles []Role,
+	ents []Entitlement[EntitlementDataEmoteSlots],
+	t time.Time,
+) EmoteSlotLimit {
+	limit := EmoteSlotLimit{
+		Slots:        conn.EmoteSlots,
+		Source:       EmoteSlotSourceConnection,
+		ConnectionID: conn.ID,
+	}
+
+	if limit.Slots <= 0 {
+		limit.Slots = 0
+		limit.Source = EmoteSlotSourceRole
+		for _, r := range roles {
+			if r.EmoteSlots > limit.Slots {
+				limit.Slots = r.EmoteSlots
+			}
+		}
+	}
+	if limit.Slots == 0 {
+		return limit
+	}
+
+	limit.Bonus = EmoteSlotBonus(roles, ents, t)
+	limit.Slots += limit.Bonus
+
+	return limit
+}
+
+// EmoteSlotBonus returns the amount of slots granted by the eligible entitlements
+func EmoteSlotBonus(roles []Role, ents []Entitlement[EntitlementDataEmoteSlots], t time.Time) int32 {
+	roleIDs := make([]primitive.ObjectID, len(roles))
+	for i, r := range roles {
+		roleIDs[i] = r.ID
+	}
+
+	bonus := int32(0)
+	for _, ent := range ents {
+		if ent.Data.Slots > 0 && ent.IsEligible(t, roleIDs) {
+			bonus += ent.Data.Slots
+		}
+	}
+	return bonus
+}
+
+// ResolveEmoteSlotLimit returns the strictest of the set's own limit and the limits of the connections it is active on
+//
+// The entitlement bonus of the set's owner is added to the set's own limit, as it is to the limits of the connections,
+// so that the bonus raises the effective limit unless a connection is stricter
+func ResolveEmoteSlotLimit(set EmoteSet, bonus int32, connLimits ...EmoteSlotLimit) EmoteSlotLimit {
+	limit := EmoteSlotLimit{
+		Slots:  set.EmoteSlots + bonus,
+		Source: EmoteSlotSourceEmoteSet,
+		Bonus:  bonus,
+	}
+
+	for _, cl := range connLimits {
+		if cl.Slots > 0 && cl.Slots < limit.Slots {
+			limit = cl
+		}
+	}
+	return limit
+}
@@ -0,0 +1,60 @@
+package structures
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEmoteSlotBonus(t *testing.T) {
+	now := time.Now()
+	ents := []Entitlement[EntitlementDataEmoteSlots]{
+		{Data: EntitlementDataEmoteSlots{Slots: 50}},
+		{Data: EntitlementDataEmoteSlots{Slots: 25}, Disabled: true},
+		{Data: EntitlementDataEmoteSlots{Slots: 25}, Condition: EntitlementCondition{MaxDate: now.Add(-time.Hour)}},
+		{Data: EntitlementDataEmoteSlots{Slots: 25}, Condition: EntitlementCondition{AllRoles: []primitive.ObjectID{primitive.NewObjectID()}}},
+	}
+
+	if bonus := EmoteSlotBonus(nil, ents, now); bonus != 50 {
+		t.Errorf("EmoteSlotBonus() = %d; want only the eligible entitlement counted", bonus)
+	}
+
+	conn := ResolveConnectionEmoteSlots(UserConnection[bson.Raw]{ID: "a", EmoteSlots: 600}, nil, ents, now)
+	if conn.Slots != 650 || conn.Bonus != 50 || conn.Source != EmoteSlotSourceConnection {
+		t.Errorf("ResolveConnectionEmoteSlots() = %+v; want the bonus added to the connection's limit", conn)
+	}
+
+	// Connections without a limit stay unlimited
+	if conn = ResolveConnectionEmoteSlots(UserConnection[bson.Raw]{ID: "b"}, nil, ents, now); conn.Slots != 0 {
+		t.Errorf("ResolveConnectionEmoteSlots() = %+v; want no limit", conn)
+	}
+}
+
+func TestResolveEmoteSlotLimit(t *testing.T) {
+	set := EmoteSet{EmoteSlots: 300}
+	connection := func(slots, bonus int32) EmoteSlotLimit {
+		return EmoteSlotLimit{Slots: slots + bonus, Source: EmoteSlotSourceConnection, Bonus: bonus, ConnectionID: "conn"}
+	}
+
+	cases := []struct {
+		name  string
+		bonus int32
+		conns []EmoteSlotLimit
+		want  EmoteSlotLimit
+	}{
+		{"set only", 0, nil, EmoteSlotLimit{Slots: 300, Source: EmoteSlotSourceEmoteSet}},
+		{"bonus raises the set's limit", 50, nil, EmoteSlotLimit{Slots: 350, Source: EmoteSlotSourceEmoteSet, Bonus: 50}},
+		{"set stricter than the connection", 50, []EmoteSlotLimit{connection(600, 50)}, EmoteSlotLimit{Slots: 350, Source: EmoteSlotSourceEmoteSet, Bonus: 50}},
+		{"connection stricter than the set", 50, []EmoteSlotLimit{connection(200, 50)}, connection(200, 50)},
+		{"strictest connection", 0, []EmoteSlotLimit{connection(250, 0), connection(100, 0)}, connection(100, 0)},
+		{"unlimited connection", 50, []EmoteSlotLimit{{Source: EmoteSlotSourceRole}}, EmoteSlotLimit{Slots: 350, Source: EmoteSlotSourceEmoteSet, Bonus: 50}},
+	}
+
+	for _, c := range cases {
+		if got := ResolveEmoteSlotLimit(set, c.bonus, c.conns...); got != c.want {
+			t.Errorf("%s: ResolveEmoteSlotLimit() = %+v; want %+v", c.name, got, c.want)
+		}
+	}
+}
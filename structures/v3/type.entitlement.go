@@ -9,7 +9,7 @@ import (
 )
 
 type EntitlementData interface {
-	bson.Raw | EntitlementDataBase | EntitlementDataBaseSelectable | EntitlementDataSubscription | EntitlementDataBadge | EntitlementDataPaint | EntitlementDataRole | EntitlementDataEmoteSet
+	bson.Raw | EntitlementDataBase | EntitlementDataBaseSelectable | EntitlementDataSubscription | EntitlementDataBadge | EntitlementDataPaint | EntitlementDataRole | EntitlementDataEmoteSet | EntitlementDataEmoteSlots
 }
 
 // Entitlement is a binding between a resource and a user
@@ -29,28 +29,35 @@ type Entitlement[D EntitlementData] struct {
 	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty"`
 	// Information about the app that created this entitlement
 	App *EntitlementApp `json:"app,omitempty" bson:"app,omitempty"`
+	// Whether the date window was open when last evaluated by the entitlement scheduler
+	LastActive *bool `json:"-" bson:"last_active,omitempty"`
 }
 
 func (e Entitlement[D]) ToRaw() Entitlement[bson.Raw] {
 	switch x := utils.ToAny(e.Data).(type) {
 	case bson.Raw:
 		return Entitlement[bson.Raw]{
-			ID:       e.ID,
-			Kind:     e.Kind,
-			Data:     x,
-			UserID:   e.UserID,
-			Disabled: e.Disabled,
+			ID:         e.ID,
+			Kind:       e.Kind,
+			Data:       x,
+			UserID:     e.UserID,
+			Disabled:   e.Disabled,
+			Condition:  e.Condition,
+			App:        e.App,
+			LastActive: e.LastActive,
 		}
 	}
 
 	raw, _ := bson.Marshal(e.Data)
 	return Entitlement[bson.Raw]{
-		ID:        e.ID,
-		Kind:      e.Kind,
-		Data:      raw,
-		UserID:    e.UserID,
-		Disabled:  e.Disabled,
-		Condition: e.Condition,
+		ID:         e.ID,
+		Kind:       e.Kind,
+		Data:       raw,
+		UserID:     e.UserID,
+		Disabled:   e.Disabled,
+		Condition:  e.Condition,
+		App:        e.App,
+		LastActive: e.LastActive,
 	}
 }
 
@@ -58,12 +65,14 @@ func ConvertEntitlement[D EntitlementData](c Entitlement[bson.Raw]) (Entitlement
 	var d D
 	err := bson.Unmarshal(c.Data, &d)
 	c2 := Entitlement[D]{
-		ID:        c.ID,
-		Kind:      c.Kind,
-		Data:      d,
-		UserID:    c.UserID,
-		Disabled:  c.Disabled,
-		Condition: c.Condition,
+		ID:         c.ID,
+		Kind:       c.Kind,
+		Data:       d,
+		UserID:     c.UserID,
+		Disabled:   c.Disabled,
+		Condition:  c.Condition,
+		App:        c.App,
+		LastActive: c.LastActive,
 	}
 
 	return c2, err
@@ -78,6 +87,7 @@ const (
 	EntitlementKindPaint        = EntitlementKind("PAINT")        // Badge Entitlement
 	EntitlementKindRole         = EntitlementKind("ROLE")         // Role Entitlement
 	EntitlementKindEmoteSet     = EntitlementKind("EMOTE_SET")    // Emote Set Entitlement
+	EntitlementKindEmoteSlots   = EntitlementKind("EMOTE_SLOTS")  // Emote Slots Entitlement
 )
 
 type EntitlementDataBase struct {
@@ -121,6 +131,11 @@ type EntitlementDataEmoteSet struct {
 	ObjectReference primitive.ObjectID `json:"-" bson:"ref"`
 }
 
+// EntitledEmoteSlots Additional emote slots for the user's connections, granted by an Entitlement
+type EntitlementDataEmoteSlots struct {
+	Slots int32 `json:"slots" bson:"slots"`
+}
+
 type EntitlementCondition struct {
 	AnyRoles []primitive.ObjectID `json:"any_roles,omitempty" bson:"any_roles,omitempty"`
 	AllRoles []primitive.ObjectID `json:"all_roles,omitempty" bson:"all_roles,omitempty"`
@@ -128,6 +143,67 @@ type EntitlementCondition struct {
 	MaxDate  time.Time            `json:"max_date,omitempty" bson:"max_date,omitempty"`
 }
 
+// IsEligible returns whether or not the entitlement is in effect at the specified time,
+// for a user with the specified roles
+func (e Entitlement[D]) IsEligible(t time.Time, roleIDs []primitive.ObjectID) bool {
+	return !e.Disabled && e.Condition.InWindow(t) && e.Condition.HasRoles(roleIDs)
+}
+
+// InWindow returns whether or not the time is within the condition's date window
+func (c EntitlementCondition) InWindow(t time.Time) bool {
+	if !c.MinDate.IsZero() && t.Before(c.MinDate) {
+		return false
+	}
+	if !c.MaxDate.IsZero() && !t.Before(c.MaxDate) {
+		return false
+	}
+	return true
+}
+
+// HasRoles returns whether or not the role prerequisites of the condition are met
+func (c EntitlementCondition) HasRoles(roleIDs []primitive.ObjectID) bool {
+	for _, id := range c.AllRoles {
+		if !utils.Contains(roleIDs, id) {
+			return false
+		}
+	}
+	if len(c.AnyRoles) == 0 {
+		return true
+	}
+	for _, id := range c.AnyRoles {
+		if utils.Contains(roleIDs, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveEntitledRoles returns the base roles and the roles granted by eligible entitlements
+//
+// Role entitlements may require roles granted by other entitlements,
+// so the entitlements are evaluated until no more roles are granted
+func ResolveEntitledRoles(base []primitive.ObjectID, ents []Entitlement[EntitlementDataRole], t time.Time) []primitive.ObjectID {
+	roleIDs := make([]primitive.ObjectID, len(base))
+	copy(roleIDs, base)
+
+	granted := make([]bool, len(ents))
+	for changed := true; changed; {
+		changed = false
+		for i, ent := range ents {
+			if granted[i] || !ent.IsEligible(t, roleIDs) {
+				continue
+			}
+
+			granted[i] = true
+			changed = true
+			if !utils.Contains(roleIDs, ent.Data.ObjectReference) {
+				roleIDs = append(roleIDs, ent.Data.ObjectReference)
+			}
+		}
+	}
+	return roleIDs
+}
+
 type EntitlementApp struct {
 	Name  string         `json:"name"`
 	State map[string]any `json:"state"`
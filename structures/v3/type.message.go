@@ -133,6 +133,8 @@ type MessageDataPlaceholder struct {
 type MessageDataModRequest struct {
 	TargetKind ObjectKind         `json:"target_kind" bson:"target_kind"`
 	TargetID   primitive.ObjectID `json:"target_id" bson:"target_id"`
+	// Content flags suggested for the target emote
+	Flags EmoteFlag `json:"flags,omitempty" bson:"flags,omitempty"`
 }
 
 // MessageRead read/unread state for a message
@@ -1,6 +1,7 @@
 package structures
 
 import (
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,18 +23,27 @@ type Report struct {
 	Priority int32 `json:"priority" bson:"priority"`
 	// Whether or not the report is open
 	Status ReportStatus `json:"status" bson:"status"`
+	// Whether or not the status is open or assigned, kept in sync with the status for the open report index
+	Open bool `json:"-" bson:"open"`
 	// The date on which the report was created
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
 	// The IDs of users assigned to this report
 	AssigneeIDs []primitive.ObjectID `json:"assignee_ids" bson:"assignee_ids"`
 	// Notes (moderator comments)
 	Notes []ReportNote `json:"notes" bson:"notes"`
+	// The outcome of the report, set when it is closed
+	Resolution ReportResolution `json:"resolution,omitempty" bson:"resolution,omitempty"`
+	// The date on which the report was closed
+	ClosedAt time.Time `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+	// The date on which the report was last escalated for being left open
+	EscalatedAt time.Time `json:"escalated_at,omitempty" bson:"escalated_at,omitempty"`
 
 	// Relational
 
-	Target    *User  `json:"target" bson:"target,skip,omitempty"`
-	Reporter  *User  `json:"reporter" bson:"reporter,skip,omitempty"`
-	Assignees []User `json:"assignees" bson:"assignees,skip,omitempty"`
+	Target      *User  `json:"target" bson:"target,skip,omitempty"`
+	TargetEmote *Emote `json:"target_emote,omitempty" bson:"target_emote,skip,omitempty"`
+	Reporter    *User  `json:"reporter" bson:"reporter,skip,omitempty"`
+	Assignees   []User `json:"assignees" bson:"assignees,skip,omitempty"`
 }
 
 type ReportStatus string
@@ -44,7 +54,72 @@ const (
 	ReportStatusClosed   ReportStatus = "CLOSED"
 )
 
+type ReportResolution string
+
+const (
+	ReportResolutionActionTaken ReportResolution = "ACTION_TAKEN" // the report was valid and action was taken
+	ReportResolutionNoAction    ReportResolution = "NO_ACTION"    // the report was reviewed but no action was necessary
+	ReportResolutionDuplicate   ReportResolution = "DUPLICATE"    // the report duplicates another report
+	ReportResolutionInvalid     ReportResolution = "INVALID"      // the report was invalid or abusive
+)
+
+func (r ReportResolution) IsValid() bool {
+	switch r {
+	case ReportResolutionActionTaken, ReportResolutionNoAction, ReportResolutionDuplicate, ReportResolutionInvalid:
+		return true
+	}
+	return false
+}
+
+const (
+	ReportPriorityWeightReporters = 10 // added for each reporter beyond the first
+	ReportPriorityWeightChannels  = 5  // added each time the target's channel count doubles
+	ReportPriorityWeightAccuracy  = 20 // scaled by how far the reporter's accuracy is from neutral
+	ReportPriorityWeightBans      = 10 // added for each past ban of the target's owner
+	ReportPriorityMaxBans         = 5
+	ReportPriorityMax             = 100
+)
+
+// ReportPriorityFactors are the signals used to score the priority of a report
+type ReportPriorityFactors struct {
+	// The amount of distinct users with an open report on the same target
+	Reporters int32 `json:"reporters"`
+	// The amount of channels the target is added on
+	ChannelCount int32 `json:"channel_count"`
+	// The share of the reporter's closed reports which led to action, between 0 and 1
+	ReporterAccuracy float64 `json:"reporter_accuracy"`
+	// The amount of bans the owner of the target has received
+	TargetBans int32 `json:"target_bans"`
+}
+
+// Score returns the priority for these factors, between 0 and ReportPriorityMax
+func (f ReportPriorityFactors) Score() int32 {
+	score := 0.0
+	if f.Reporters > 1 {
+		score += float64(f.Reporters-1) * ReportPriorityWeightReporters
+	}
+	if f.ChannelCount > 0 {
+		score += math.Log2(float64(f.ChannelCount)+1) * ReportPriorityWeightChannels
+	}
+	score += (f.ReporterAccuracy - 0.5) * 2 * ReportPriorityWeightAccuracy
+
+	bans := f.TargetBans
+	if bans > ReportPriorityMaxBans {
+		bans = ReportPriorityMaxBans
+	}
+	score += float64(bans) * ReportPriorityWeightBans
+
+	if score < 0 {
+		return 0
+	} else if score > ReportPriorityMax {
+		return ReportPriorityMax
+	}
+	return int32(math.Round(score))
+}
+
 type ReportNote struct {
+	// The ID of the note
+	ID primitive.ObjectID `json:"id" bson:"id"`
 	// The time at which the note was created
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 	// The ID of the user who wrote this note
@@ -58,4 +133,16 @@ type ReportNote struct {
 	Read bool `json:"read" bson:"read"`
 	// A reply to the note by the reporter
 	Reply string `json:"reply" bson:"reply"`
+	// The time at which the reporter replied to the note
+	RepliedAt time.Time `json:"replied_at,omitempty" bson:"replied_at,omitempty"`
+}
+
+// GetNote returns a note of the report, as well as its index
+func (r Report) GetNote(id primitive.ObjectID) (ReportNote, int) {
+	for i, n := range r.Notes {
+		if n.ID == id {
+			return n, i
+		}
+	}
+	return ReportNote{}, -1
 }
@@ -21,6 +21,8 @@ type Role struct {
 	Default bool `json:"default" bson:"default,omitempty"`
 	// whether or not the role
 	Invisible bool `json:"invisible" bson:"invisible,omitempty"`
+	// the default amount of emote slots of the connections of users with this role
+	EmoteSlots int32 `json:"emote_slots,omitempty" bson:"emote_slots,omitempty"`
 }
 
 // HasPermissionBit: Check for specific bit in the role's allowed permissions
@@ -90,16 +92,24 @@ const (
 type RoleBuilder struct {
 	Update UpdateMap
 	Role   Role
+
+	initial Role
 }
 
 // NewRoleBuilder: create a new role builder
 func NewRoleBuilder(role Role) *RoleBuilder {
 	return &RoleBuilder{
-		Update: UpdateMap{},
-		Role:   role,
+		Update:  UpdateMap{},
+		Role:    role,
+		initial: role,
 	}
 }
 
+// Initial returns a pointer to the value first passed to this Builder
+func (rb RoleBuilder) Initial() Role {
+	return rb.initial
+}
+
 func (rb *RoleBuilder) SetName(name string) *RoleBuilder {
 	rb.Role.Name = name
 	rb.Update.Set("name", name)
@@ -129,3 +139,9 @@ func (rb *RoleBuilder) SetDenied(denied RolePermission) *RoleBuilder {
 	rb.Update.Set("denied", denied)
 	return rb
 }
+
+func (rb *RoleBuilder) SetEmoteSlots(slots int32) *RoleBuilder {
+	rb.Role.EmoteSlots = slots
+	rb.Update.Set("emote_slots", slots)
+	return rb
+}
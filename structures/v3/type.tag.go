@@ -0,0 +1,33 @@
+package structures
+
+import (
+	"strings"
+	"time"
+)
+
+// EmoteTag is an entry in the catalog of tags which can be added to emotes
+type EmoteTag struct {
+	ID ObjectID `json:"id" bson:"_id,omitempty"`
+	// The canonical name of the tag
+	Name string `json:"name" bson:"name"`
+	// Alternative names which resolve to this tag
+	Synonyms []string `json:"synonyms" bson:"synonyms"`
+	// The amount of emotes using this tag
+	UsageCount int32 `json:"usage_count" bson:"usage_count"`
+	// Whether or not the tag was blocked by a moderator
+	Blocked bool `json:"blocked" bson:"blocked"`
+	// The reason why the tag was blocked
+	BlockedReason string `json:"blocked_reason,omitempty" bson:"blocked_reason,omitempty"`
+	// The time at which the tag was last modified by a moderator
+	UpdatedAt time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+}
+
+// NormalizeEmoteTag returns the tag in the form it is stored as
+func NormalizeEmoteTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// IsValidEmoteTag returns whether or not a normalized tag passes validation
+func IsValidEmoteTag(tag string) bool {
+	return emoteTagRegex.MatchString(tag)
+}
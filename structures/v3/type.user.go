@@ -1,10 +1,12 @@
 package structures
 
 import (
-	"fmt"
+	"bytes"
 	"sort"
 	"time"
 
+	"github.com/seventv/common/errors"
+	"github.com/seventv/common/mongo/encryption"
 	"github.com/seventv/common/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -22,7 +24,7 @@ type User struct {
 	// the user's discriminatory space
 	Discriminator string `json:"discriminator" bson:"discriminator"`
 	// the user's email
-	Email string `json:"email" bson:"email"`
+	Email encryption.EncryptedString `json:"email" bson:"email"`
 	// list of role IDs directly bound to the user (not via an entitlement)
 	RoleIDs []ObjectID `json:"role_ids" bson:"role_ids"`
 	// the user's editors
@@ -69,14 +71,119 @@ func (u *User) HasPermission(bit RolePermission) bool {
 	return utils.BitField.HasBits(int64(total), int64(bit))
 }
 
+// FinalPermission computes the permissions granted by the user's roles
+//
+// Roles are applied from the lowest position to the highest, so a higher role overrides
+// the bits allowed or denied by the roles below it. Roles at the same position are applied
+// in order of ID. Within a single role, the allowed bits take precedence over the denied bits.
+//
+// A user banned with the no permissions effect is given the revocation role instead
 func (u *User) FinalPermission() (total RolePermission) {
-	for _, r := range u.Roles {
+	for _, r := range u.permissionRoles() {
 		total &= ^r.Denied
 		total |= r.Allowed
 	}
 	return
 }
 
+// ExplainPermission describes how the user's roles decide a permission bit
+func (u *User) ExplainPermission(bit RolePermission) PermissionExplanation {
+	ex := PermissionExplanation{
+		Permission: bit,
+		Steps:      []PermissionStep{},
+	}
+
+	if ban, banned := u.GetActiveBan(BanEffectNoPermissions); banned {
+		ex.Ban = &ban
+	}
+
+	total := RolePermission(0)
+	for _, r := range u.permissionRoles() {
+		step := PermissionStep{Role: r}
+		if r.Denied&bit != 0 {
+			step.Denied = r.Denied & bit
+		}
+		if r.Allowed&bit != 0 {
+			step.Allowed = r.Allowed & bit
+		}
+
+		total &= ^r.Denied
+		total |= r.Allowed
+
+		if step.Allowed != 0 || step.Denied != 0 || r.Allowed&RolePermissionSuperAdministrator != 0 {
+			ex.Steps = append(ex.Steps, step)
+		}
+	}
+
+	ex.SuperAdministrator = total&RolePermissionSuperAdministrator != 0
+	ex.Granted = ex.SuperAdministrator || utils.BitField.HasBits(int64(total), int64(bit))
+	return ex
+}
+
+// permissionRoles returns the roles of the user in the order their permissions are applied
+func (u *User) permissionRoles() []Role {
+	if _, banned := u.GetActiveBan(BanEffectNoPermissions); banned {
+		return []Role{RevocationRole}
+	}
+
+	roles := make([]Role, len(u.Roles))
+	copy(roles, u.Roles)
+	sort.SliceStable(roles, func(i, j int) bool {
+		if roles[i].Position != roles[j].Position {
+			return roles[i].Position < roles[j].Position
+		}
+		return bytes.Compare(roles[i].ID[:], roles[j].ID[:]) < 0
+	})
+	return roles
+}
+
+// PermissionExplanation describes the evaluation of a permission bit
+type PermissionExplanation struct {
+	Permission RolePermission `json:"permission"`
+	// Whether or not the permission is granted
+	Granted bool `json:"granted"`
+	// Whether or not the permission is granted through the super administrator permission
+	SuperAdministrator bool `json:"super_administrator"`
+	// The roles which allowed or denied the permission, in the order they were applied.
+	// The last step decides the outcome, unless granted by super administrator
+	Steps []PermissionStep `json:"steps"`
+	// The ban revoking all of the user's permissions, if any
+	Ban *Ban `json:"ban,omitempty"`
+}
+
+type PermissionStep struct {
+	Role Role `json:"role"`
+	// The bits of the permission allowed by the role
+	Allowed RolePermission `json:"allowed,omitempty"`
+	// The bits of the permission denied by the role
+	Denied RolePermission `json:"denied,omitempty"`
+}
+
+// GetActiveBan returns the first of the user's bans in effect which has the specified effect
+//
+// Bans must have been attached to the user for this to find anything
+func (u *User) GetActiveBan(eff BanEffect) (Ban, bool) {
+	for _, b := range u.Bans {
+		if b.Effects.Has(eff) && b.IsActive() {
+			return b, true
+		}
+	}
+	return Ban{}, false
+}
+
+// CheckAuth returns an error if the user is not allowed to authenticate
+func (u *User) CheckAuth() error {
+	ban, banned := u.GetActiveBan(BanEffectNoAuth)
+	if !banned {
+		return nil
+	}
+
+	return errors.ErrBanned().SetDetail(ban.Reason).SetFields(errors.Fields{
+		"BAN_ID":        ban.ID.Hex(),
+		"BAN_EXPIRE_AT": utils.Ternary(ban.IsPermanent(), "never", ban.ExpireAt.Format(time.RFC3339)),
+	})
+}
+
 func (u *User) AddRoles(roles ...Role) {
 	for _, r := range roles {
 		exists := false
@@ -130,24 +237,12 @@ type UserConnectionList []UserConnection[bson.Raw]
 
 // Twitch returns the first Twitch user connection
 func (ucl UserConnectionList) Twitch() (UserConnection[UserConnectionDataTwitch], int, error) {
-	for idx, v := range ucl {
-		if v.Platform == UserConnectionPlatformTwitch {
-			conn, err := ConvertUserConnection[UserConnectionDataTwitch](v)
-			return conn, idx, err
-		}
-	}
-	return UserConnection[UserConnectionDataTwitch]{}, -1, fmt.Errorf("could not find any twitch connections")
+	return ByPlatform[UserConnectionDataTwitch](ucl)
 }
 
 // YouTube returns the first YouTube user connection
 func (ucl UserConnectionList) YouTube() (UserConnection[UserConnectionDataYoutube], int, error) {
-	for idx, v := range ucl {
-		if v.Platform == UserConnectionPlatformYouTube {
-			conn, err := ConvertUserConnection[UserConnectionDataYoutube](v)
-			return conn, idx, err
-		}
-	}
-	return UserConnection[UserConnectionDataYoutube]{}, -1, fmt.Errorf("could not find any youtube connections")
+	return ByPlatform[UserConnectionDataYoutube](ucl)
 }
 
 // UserConnectionPlatform Represents a platform that the app supports
@@ -156,6 +251,8 @@ type UserConnectionPlatform string
 var (
 	UserConnectionPlatformTwitch  UserConnectionPlatform = "TWITCH"
 	UserConnectionPlatformYouTube UserConnectionPlatform = "YOUTUBE"
+	UserConnectionPlatformKick    UserConnectionPlatform = "KICK"
+	UserConnectionPlatformDiscord UserConnectionPlatform = "DISCORD"
 )
 
 type UserType string
@@ -167,7 +264,7 @@ var (
 )
 
 type UserConnectionData interface {
-	bson.Raw | UserConnectionDataTwitch | UserConnectionDataYoutube
+	bson.Raw | UserConnectionDataTwitch | UserConnectionDataYoutube | UserConnectionDataKick | UserConnectionDataDiscord
 }
 
 // UserConnection: Represents an external connection to a platform for a user
@@ -237,10 +334,16 @@ func ConvertUserConnection[D UserConnectionData](c UserConnection[bson.Raw]) (Us
 }
 
 type UserConnectionGrant struct {
-	AccessToken  string    `json:"access_token" bson:"access_token"`
-	RefreshToken string    `json:"refresh_token" bson:"refresh_token"`
-	Scope        []string  `json:"scope" bson:"scope"`
-	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+	AccessToken  encryption.EncryptedString `json:"access_token" bson:"access_token"`
+	RefreshToken encryption.EncryptedString `json:"refresh_token" bson:"refresh_token"`
+	Scope        []string                   `json:"scope" bson:"scope"`
+	ExpiresAt    time.Time                  `json:"expires_at" bson:"expires_at"`
+	// The time at which the last refresh of the grant failed
+	RefreshFailedAt time.Time `json:"refresh_failed_at,omitempty" bson:"refresh_failed_at,omitempty"`
+	// The error of the last failed refresh
+	RefreshError string `json:"refresh_error,omitempty" bson:"refresh_error,omitempty"`
+	// Whether the grant was revoked by the platform, and the connection must be linked again
+	Revoked bool `json:"revoked,omitempty" bson:"revoked,omitempty"`
 }
 
 // UserConnectionBuilder: utility for creating a new UserConnection
@@ -290,8 +393,8 @@ func (ucb *UserConnectionBuilder[D]) SetData(data D) *UserConnectionBuilder[D] {
 
 func (ucb *UserConnectionBuilder[D]) SetGrant(at string, rt string, ex int, sc []string) *UserConnectionBuilder[D] {
 	g := &UserConnectionGrant{
-		AccessToken:  at,
-		RefreshToken: rt,
+		AccessToken:  encryption.EncryptedString(at),
+		RefreshToken: encryption.EncryptedString(rt),
 		Scope:        sc,
 		ExpiresAt:    time.Now().Add(time.Second * time.Duration(ex)),
 	}
@@ -302,16 +405,16 @@ func (ucb *UserConnectionBuilder[D]) SetGrant(at string, rt string, ex int, sc [
 }
 
 type UserConnectionDataTwitch struct {
-	ID              string    `json:"id" bson:"id"`
-	Login           string    `json:"login" bson:"login"`
-	DisplayName     string    `json:"display_name" bson:"display_name"`
-	BroadcasterType string    `json:"broadcaster_type" bson:"broadcaster_type"`
-	Description     string    `json:"description" bson:"description"`
-	ProfileImageURL string    `json:"profile_image_url" bson:"profile_image_url"`
-	OfflineImageURL string    `json:"offline_image_url" bson:"offline_image_url"`
-	ViewCount       int       `json:"view_count" bson:"view_count"`
-	Email           string    `json:"email" bson:"email"`
-	CreatedAt       time.Time `json:"created_at" bson:"twitch_created_at"`
+	ID              string                     `json:"id" bson:"id"`
+	Login           string                     `json:"login" bson:"login"`
+	DisplayName     string                     `json:"display_name" bson:"display_name"`
+	BroadcasterType string                     `json:"broadcaster_type" bson:"broadcaster_type"`
+	Description     string                     `json:"description" bson:"description"`
+	ProfileImageURL string                     `json:"profile_image_url" bson:"profile_image_url"`
+	OfflineImageURL string                     `json:"offline_image_url" bson:"offline_image_url"`
+	ViewCount       int                        `json:"view_count" bson:"view_count"`
+	Email           encryption.EncryptedString `json:"email" bson:"email"`
+	CreatedAt       time.Time                  `json:"created_at" bson:"twitch_created_at"`
 }
 
 type UserConnectionDataYoutube struct {
@@ -320,6 +423,20 @@ type UserConnectionDataYoutube struct {
 	Description string `json:"description" bson:"description"`
 }
 
+type UserConnectionDataKick struct {
+	ID                string `json:"id" bson:"id"`
+	Username          string `json:"username" bson:"username"`
+	DisplayName       string `json:"display_name" bson:"display_name"`
+	ProfilePictureURL string `json:"profile_picture_url" bson:"profile_picture_url"`
+}
+
+type UserConnectionDataDiscord struct {
+	ID         string `json:"id" bson:"id"`
+	Username   string `json:"username" bson:"username"`
+	GlobalName string `json:"global_name" bson:"global_name"`
+	AvatarHash string `json:"avatar_hash" bson:"avatar_hash"`
+}
+
 type UserEditor struct {
 	ID ObjectID `json:"id" bson:"id"`
 	// The permissions this editor has
@@ -328,6 +445,17 @@ type UserEditor struct {
 	Visible bool `json:"visible" bson:"visible"`
 
 	AddedAt time.Time `json:"added_at,omitempty" bson:"added_at,omitempty"`
+	// The connections the editor's permissions are limited to
+	Connections []string `json:"connections,omitempty" bson:"connections,omitempty"`
+	// The emote sets the editor's permissions are limited to
+	EmoteSets []ObjectID `json:"emote_sets,omitempty" bson:"emote_sets,omitempty"`
+
+	// Whether or not the editor was invited and has yet to accept. Pending editors have no permissions
+	Pending bool `json:"pending,omitempty" bson:"pending,omitempty"`
+	// The user who invited the editor
+	InvitedBy ObjectID `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	// The time after which a pending invitation can no longer be accepted
+	ExpireAt time.Time `json:"expire_at,omitempty" bson:"expire_at,omitempty"`
 
 	// Relational
 	User *User `json:"user" bson:"user,skip,omitempty"`
@@ -335,9 +463,52 @@ type UserEditor struct {
 
 // HasPermission: check whether or not the editor has a permission
 func (ed *UserEditor) HasPermission(bit UserEditorPermission) bool {
+	if ed.Pending {
+		return false
+	}
 	return utils.BitField.HasBits(int64(ed.Permissions), int64(bit))
 }
 
+// IsScoped returns whether or not the editor's permissions are limited to specific connections or emote sets
+//
+// Editors without a scope have their permissions over all of the user's connections and emote sets
+func (ed UserEditor) IsScoped() bool {
+	return len(ed.Connections) > 0 || len(ed.EmoteSets) > 0
+}
+
+// HasConnectionPermission: check whether or not the editor has a permission over a connection
+func (ed *UserEditor) HasConnectionPermission(bit UserEditorPermission, connectionID string) bool {
+	if !ed.HasPermission(bit) {
+		return false
+	}
+	return !ed.IsScoped() || utils.Contains(ed.Connections, connectionID)
+}
+
+// HasEmoteSetPermission: check whether or not the editor has a permission over an emote set
+//
+// Editors scoped to a connection also have their permissions over the emote set active on that connection,
+// for which the connections of the user must be specified
+func (ed *UserEditor) HasEmoteSetPermission(bit UserEditorPermission, setID ObjectID, connections UserConnectionList) bool {
+	if !ed.HasPermission(bit) {
+		return false
+	}
+	if !ed.IsScoped() || utils.Contains(ed.EmoteSets, setID) {
+		return true
+	}
+
+	for _, conn := range connections {
+		if conn.EmoteSetID == setID && utils.Contains(ed.Connections, conn.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired returns whether or not the editor's invitation can no longer be accepted
+func (ed UserEditor) IsExpired() bool {
+	return ed.Pending && !ed.ExpireAt.IsZero() && ed.ExpireAt.Before(time.Now())
+}
+
 type UserEditorPermission int32
 
 const (
@@ -0,0 +1,166 @@
+package structures
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The permission bits used by the generated roles. Few bits and positions make overlaps and ties likely
+var testPermissionBits = []RolePermission{
+	RolePermissionCreateEmote,
+	RolePermissionEditEmote,
+	RolePermissionManageRoles,
+	RolePermissionEditAnyEmote,
+}
+
+// testRoleSet is a random set of roles, implementing quick.Generator
+type testRoleSet []Role
+
+func (testRoleSet) Generate(r *rand.Rand, size int) reflect.Value {
+	n := r.Intn(6)
+	roles := make(testRoleSet, n)
+	for i := range roles {
+		id := primitive.ObjectID{}
+		r.Read(id[:])
+
+		roles[i] = Role{
+			ID:       id,
+			Position: int32(r.Intn(3)),
+			Allowed:  randomPermissions(r),
+			Denied:   randomPermissions(r),
+		}
+	}
+	return reflect.ValueOf(roles)
+}
+
+func randomPermissions(r *rand.Rand) (p RolePermission) {
+	for _, bit := range testPermissionBits {
+		if r.Intn(3) == 0 {
+			p |= bit
+		}
+	}
+	return p
+}
+
+// withSuperAdministrator occasionally allows or denies the super administrator permission
+func (s testRoleSet) withSuperAdministrator(r *rand.Rand) testRoleSet {
+	result := make(testRoleSet, len(s))
+	for i, role := range s {
+		switch r.Intn(4) {
+		case 0:
+			role.Allowed |= RolePermissionSuperAdministrator
+		case 1:
+			role.Denied |= RolePermissionSuperAdministrator
+		}
+		result[i] = role
+	}
+	return result
+}
+
+// expectedPermission is the reference model: the highest positioned role which allows or denies the bit decides it,
+// ties are broken by the highest ID, and within a role allowing takes precedence over denying
+func expectedPermission(roles []Role, bit RolePermission) bool {
+	var decider *Role
+	for i := range roles {
+		r := &roles[i]
+		if (r.Allowed|r.Denied)&bit == 0 {
+			continue
+		}
+
+		if decider == nil || r.Position > decider.Position ||
+			(r.Position == decider.Position && bytes.Compare(r.ID[:], decider.ID[:]) > 0) {
+			decider = r
+		}
+	}
+
+	return decider != nil && decider.Allowed&bit != 0
+}
+
+func TestHighestRoleWins(t *testing.T) {
+	f := func(roles testRoleSet) bool {
+		u := &User{Roles: roles}
+		for _, bit := range testPermissionBits {
+			if u.HasPermission(bit) != expectedPermission(roles, bit) {
+				t.Logf("bit %d: got %v for roles %+v", bit, u.HasPermission(bit), roles)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoleOrderDoesNotMatter(t *testing.T) {
+	f := func(roles testRoleSet, seed int64) bool {
+		shuffled := make([]Role, len(roles))
+		copy(shuffled, roles)
+		rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		a := &User{Roles: roles}
+		b := &User{Roles: shuffled}
+		return a.FinalPermission() == b.FinalPermission()
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 1000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExplainPermissionMatchesHasPermission(t *testing.T) {
+	f := func(roles testRoleSet, seed int64) bool {
+		roles = roles.withSuperAdministrator(rand.New(rand.NewSource(seed)))
+
+		u := &User{Roles: roles}
+		for _, bit := range testPermissionBits {
+			ex := u.ExplainPermission(bit)
+			if ex.Granted != u.HasPermission(bit) {
+				t.Logf("bit %d: explanation says %v for roles %+v", bit, ex.Granted, roles)
+				return false
+			}
+
+			// Unless granted by super administrator, the last step touching the bit decides it
+			if ex.SuperAdministrator {
+				continue
+			}
+			decided := false
+			for _, step := range ex.Steps {
+				if step.Allowed != 0 || step.Denied != 0 {
+					decided = step.Allowed != 0
+				}
+			}
+			if decided != ex.Granted {
+				t.Logf("bit %d: steps decide %v but granted is %v for roles %+v", bit, decided, ex.Granted, roles)
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNoPermissionsBanRevokesRoles(t *testing.T) {
+	u := &User{
+		Roles: []Role{{ID: primitive.NewObjectID(), Allowed: RolePermissionSuperAdministrator}},
+		Bans:  []Ban{{ID: primitive.NewObjectID(), Effects: BanEffectNoPermissions}},
+	}
+
+	if u.HasPermission(RolePermissionCreateEmote) {
+		t.Error("a user banned with the no permissions effect kept their permissions")
+	}
+	if ex := u.ExplainPermission(RolePermissionCreateEmote); ex.Granted || ex.Ban == nil {
+		t.Errorf("explanation = %+v; want not granted with the ban attached", ex)
+	}
+}
@@ -0,0 +1,164 @@
+package structures
+
+import (
+	"math"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/seventv/common/errors"
+)
+
+const (
+	CosmeticBadgeTooltipMaxLength = 100
+	CosmeticPaintMaxStops         = 16
+	CosmeticPaintMaxDropShadows   = 8
+	CosmeticPaintMaxShadowRadius  = 32
+	CosmeticPaintMaxKeyframes     = 32
+	// The shortest and longest duration of an animation cycle, in milliseconds
+	CosmeticPaintAnimationMinSpeed = 100
+	CosmeticPaintAnimationMaxSpeed = 60000
+)
+
+type CosmeticBadgeValidator struct {
+	v *CosmeticDataBadge
+}
+
+func (b *CosmeticDataBadge) Validator() CosmeticBadgeValidator {
+	return CosmeticBadgeValidator{b}
+}
+
+func (x CosmeticBadgeValidator) Tooltip() error {
+	if n := utf8.RuneCountInString(x.v.Tooltip); n == 0 || n > CosmeticBadgeTooltipMaxLength {
+		return errors.ErrValidationRejected().SetDetail("Badge tooltip must be between 1 and %d characters", CosmeticBadgeTooltipMaxLength)
+	}
+	return nil
+}
+
+// Validate runs all validations of the badge
+func (x CosmeticBadgeValidator) Validate() error {
+	return x.Tooltip()
+}
+
+type CosmeticPaintValidator struct {
+	v *CosmeticDataPaint
+}
+
+func (p *CosmeticDataPaint) Validator() CosmeticPaintValidator {
+	return CosmeticPaintValidator{p}
+}
+
+func (x CosmeticPaintValidator) Function() error {
+	switch x.v.Function {
+	case CosmeticPaintFunctionLinearGradient, CosmeticPaintFunctionRadialGradient, CosmeticPaintFunctionImageURL:
+		return nil
+	}
+	return errors.ErrValidationRejected().SetDetail("Unknown paint function '%s'", x.v.Function)
+}
+
+// Stops checks that a gradient has stops positioned between 0 and 1, in ascending order
+func (x CosmeticPaintValidator) Stops() error {
+	if x.v.Function == CosmeticPaintFunctionImageURL {
+		return nil
+	}
+
+	if len(x.v.Stops) < 2 || len(x.v.Stops) > CosmeticPaintMaxStops {
+		return errors.ErrValidationRejected().SetDetail("Gradient must have between 2 and %d stops", CosmeticPaintMaxStops)
+	}
+
+	last := 0.0
+	for i, stop := range x.v.Stops {
+		if stop.At < 0 || stop.At > 1 {
+			return errors.ErrValidationRejected().SetDetail("Gradient stop %d must be positioned between 0 and 1", i)
+		}
+		if stop.At < last {
+			return errors.ErrValidationRejected().SetDetail("Gradient stop %d is positioned before the previous stop", i)
+		}
+		last = stop.At
+	}
+	return nil
+}
+
+func (x CosmeticPaintValidator) Angle() error {
+	if x.v.Angle < 0 || x.v.Angle > 360 {
+		return errors.ErrValidationRejected().SetDetail("Paint angle must be between 0 and 360 degrees")
+	}
+	return nil
+}
+
+func (x CosmeticPaintValidator) Shape() error {
+	if x.v.Function != CosmeticPaintFunctionRadialGradient {
+		if x.v.Shape != "" {
+			return errors.ErrValidationRejected().SetDetail("Only radial gradients can have a shape")
+		}
+		return nil
+	}
+
+	switch x.v.Shape {
+	case "", "circle", "ellipse":
+		return nil
+	}
+	return errors.ErrValidationRejected().SetDetail("Radial gradient shape must be 'circle' or 'ellipse'")
+}
+
+func (x CosmeticPaintValidator) ImageURL() error {
+	if x.v.Function != CosmeticPaintFunctionImageURL {
+		return nil
+	}
+
+	u, err := url.Parse(x.v.ImageURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return errors.ErrValidationRejected().SetDetail("Paint image URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+func (x CosmeticPaintValidator) DropShadows() error {
+	if len(x.v.DropShadows) > CosmeticPaintMaxDropShadows {
+		return errors.ErrValidationRejected().SetDetail("Paint cannot have more than %d drop shadows", CosmeticPaintMaxDropShadows)
+	}
+
+	for i, ds := range x.v.DropShadows {
+		if ds.Radius < 0 || ds.Radius > CosmeticPaintMaxShadowRadius {
+			return errors.ErrValidationRejected().SetDetail("Drop shadow %d must have a radius between 0 and %d", i, CosmeticPaintMaxShadowRadius)
+		}
+	}
+	return nil
+}
+
+// Animation checks the animation's speed, and that its keyframes are positioned between 0 and 1 in ascending order
+func (x CosmeticPaintValidator) Animation() error {
+	a := x.v.Animation
+	if a == nil {
+		return nil
+	}
+
+	if a.Speed < CosmeticPaintAnimationMinSpeed || a.Speed > CosmeticPaintAnimationMaxSpeed {
+		return errors.ErrValidationRejected().SetDetail("Animation speed must be between %d and %d milliseconds", CosmeticPaintAnimationMinSpeed, CosmeticPaintAnimationMaxSpeed)
+	}
+	if len(a.Keyframes) < 2 || len(a.Keyframes) > CosmeticPaintMaxKeyframes {
+		return errors.ErrValidationRejected().SetDetail("Animation must have between 2 and %d keyframes", CosmeticPaintMaxKeyframes)
+	}
+
+	for i, kf := range a.Keyframes {
+		if kf.At < 0 || kf.At > 1 {
+			return errors.ErrValidationRejected().SetDetail("Animation keyframe %d must be positioned between 0 and 1", i)
+		}
+		if i > 0 && kf.At <= a.Keyframes[i-1].At {
+			return errors.ErrValidationRejected().SetDetail("Animation keyframe %d must be positioned after the previous keyframe", i)
+		}
+		if math.IsNaN(kf.X) || math.IsInf(kf.X, 0) || math.IsNaN(kf.Y) || math.IsInf(kf.Y, 0) {
+			return errors.ErrValidationRejected().SetDetail("Animation keyframe %d has an invalid offset", i)
+		}
+	}
+	return nil
+}
+
+// Validate runs all validations of the paint
+func (x CosmeticPaintValidator) Validate() error {
+	for _, f := range []func() error{x.Function, x.Stops, x.Angle, x.Shape, x.ImageURL, x.DropShadows, x.Animation} {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}